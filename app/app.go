@@ -1,103 +1,385 @@
 package app
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/fx"
 	"github.com/clD11/form3-payments/handler"
+	"github.com/clD11/form3-payments/health"
+	"github.com/clD11/form3-payments/iso20022"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/metrics"
 	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/openapi"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/clD11/form3-payments/ratelimit"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/clD11/form3-payments/scheduler"
+	"github.com/clD11/form3-payments/standingorder"
+	"github.com/clD11/form3-payments/tracing"
 	"github.com/go-pg/pg"
 	"github.com/go-pg/pg/orm"
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
-	"log"
+	uuid "github.com/satori/go.uuid"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 type App struct {
-	Router *mux.Router
-	DB     *pg.DB
+	Router  *mux.Router
+	DB      *pg.DB
+	Server  *http.Server
+	config  *Config
+	workers workers
+	// calendars are built once since loading time zones reads the zoneinfo files
+	calendars *calendar.Calendars
 }
 
 func (a *App) Initialize(config *Config) {
+	a.config = config
+	a.configureTracing()
+	a.configureCalendars()
 	a.createDatabaseAndMigration(config)
+	a.AddWorker(&scheduler.Scheduler{DB: a.DB, Interval: config.SchedulerInterval})
+	a.AddWorker(&standingorder.Generator{DB: a.DB, Preparer: a.preparer(), Interval: config.StandingOrderInterval})
 	a.registerRoutes()
+	a.Server = a.newServer()
 }
 
 func (a *App) GetPayment(w http.ResponseWriter, r *http.Request) {
-	handler.GetPayment(a.DB, w, r)
+	handler.GetPayment(a.db(r), w, r)
 }
 
 func (a *App) CreatePayment(w http.ResponseWriter, r *http.Request) {
-	handler.CreatePayment(a.DB, w, r)
+	handler.CreatePayment(a.db(r), a.preparer(), w, r)
 }
 
 func (a *App) DeletePayment(w http.ResponseWriter, r *http.Request) {
-	handler.DeletePayment(a.DB, w, r)
+	handler.DeletePayment(a.db(r), w, r)
+}
+
+func (a *App) PreviewCharges(w http.ResponseWriter, r *http.Request) {
+	handler.PreviewCharges(a.config.FeeSchedule, a.routingTable(), w, r)
 }
 
 func (a *App) UpdatePayment(w http.ResponseWriter, r *http.Request) {
-	handler.UpdatePayment(a.DB, w, r)
+	handler.UpdatePayment(a.db(r), a.fxPolicy(), a.routingTable(), a.calendars, w, r)
 }
 
 func (a *App) GetPayments(w http.ResponseWriter, r *http.Request) {
-	handler.GetPayments(a.DB, w, r)
+	handler.GetPayments(a.db(r), w, r)
+}
+
+func (a *App) ImportPain001(w http.ResponseWriter, r *http.Request) {
+	handler.ImportPain001(a.db(r), a.preparer(), w, r)
+}
+
+// ProcessPain001 creates the payments in a pain.001 document as the import route does
+func (a *App) ProcessPain001(ctx context.Context, doc *iso20022.Pain001, organisationID uuid.UUID) *iso20022.Pain002 {
+	return handler.ProcessPain001(ctx, a.DB.WithContext(ctx), a.preparer(), doc, organisationID)
+}
+
+func (a *App) ExportBacs(w http.ResponseWriter, r *http.Request) {
+	handler.ExportBacs(a.db(r), a.config.BacsServiceUserNumber, w, r)
+}
+
+func (a *App) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	handler.ImportCSV(a.db(r), a.preparer(), w, r)
+}
+
+func (a *App) GetFxRates(w http.ResponseWriter, r *http.Request) {
+	handler.GetFxRates(a.db(r), w, r)
 }
 
+func (a *App) CreateFxRate(w http.ResponseWriter, r *http.Request) {
+	handler.CreateFxRate(a.db(r), w, r)
+}
+
+func (a *App) ImportFxRates(w http.ResponseWriter, r *http.Request) {
+	handler.ImportFxRates(a.db(r), w, r)
+}
+
+func (a *App) CreateFxQuote(w http.ResponseWriter, r *http.Request) {
+	handler.CreateFxQuote(a.db(r), a.fxPolicy(), w, r)
+}
+
+func (a *App) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	handler.GetSchedules(a.db(r), w, r)
+}
+
+func (a *App) CreateStandingOrder(w http.ResponseWriter, r *http.Request) {
+	handler.CreateStandingOrder(a.db(r), a.routingTable(), a.calendars, w, r)
+}
+
+func (a *App) GetStandingOrder(w http.ResponseWriter, r *http.Request) {
+	handler.GetStandingOrder(a.db(r), w, r)
+}
+
+func (a *App) UpdateStandingOrder(w http.ResponseWriter, r *http.Request) {
+	handler.UpdateStandingOrder(a.db(r), a.routingTable(), a.calendars, w, r)
+}
+
+func (a *App) GetStandingOrderPayments(w http.ResponseWriter, r *http.Request) {
+	handler.GetStandingOrderPayments(a.db(r), w, r)
+}
+
+func (a *App) CreateMandate(w http.ResponseWriter, r *http.Request) {
+	handler.CreateMandate(a.db(r), w, r)
+}
+
+func (a *App) GetMandate(w http.ResponseWriter, r *http.Request) {
+	handler.GetMandate(a.db(r), w, r)
+}
+
+func (a *App) UpdateMandate(w http.ResponseWriter, r *http.Request) {
+	handler.UpdateMandate(a.db(r), w, r)
+}
+
+func (a *App) GetMandateEvents(w http.ResponseWriter, r *http.Request) {
+	handler.GetMandateEvents(a.db(r), w, r)
+}
+
+func (a *App) GetNextBusinessDay(w http.ResponseWriter, r *http.Request) {
+	handler.GetNextBusinessDay(a.calendars, w, r)
+}
+
+// configureCalendars uses the default scheme hours without holidays unless calendars were loaded
+func (a *App) configureCalendars() {
+	a.calendars = a.config.Calendars
+	if a.calendars != nil {
+		return
+	}
+	calendars, err := calendar.New()
+	if err != nil {
+		logging.Default.Fatal("could not load scheme time zones", "error", err)
+	}
+	calendars.Rule = a.config.ProcessingDateRule
+	a.calendars = calendars
+}
+
+// routingTable chooses the scheme of payments created without one
+func (a *App) routingTable() *routing.Table {
+	if a.config.RoutingTable == nil {
+		return routing.DefaultTable()
+	}
+	return a.config.RoutingTable
+}
+
+// fxPolicy is how payments' Fx blocks are completed and checked
+func (a *App) fxPolicy() fx.Policy {
+	tolerance := a.config.FxTolerance
+	if tolerance <= 0 {
+		tolerance = fx.DefaultTolerance
+	}
+	return fx.Policy{Rounding: a.config.FxRounding, Tolerance: tolerance, QuoteTTL: a.config.FxQuoteTTL}
+}
+
+// preparer completes and checks new payments for every route that creates them
+func (a *App) preparer() prepare.Preparer {
+	return prepare.Preparer{Policy: a.fxPolicy(), Schedule: a.config.FeeSchedule, Routes: a.routingTable(), Calendars: a.calendars}
+}
+
+// db carries the request context to go-pg so queries are traced as children of the request
+func (a *App) db(r *http.Request) *pg.DB {
+	return a.DB.WithContext(r.Context())
+}
+
+func (a *App) newServer() *http.Server {
+	maxHeaderBytes := a.config.MaxHeaderBytes
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = defaultMaxHeaderBytes
+	}
+	return &http.Server{
+		Handler:           a.Router,
+		ReadHeaderTimeout: orDefault(a.config.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       orDefault(a.config.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      orDefault(a.config.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       orDefault(a.config.IdleTimeout, defaultIdleTimeout),
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+}
+
+// Run serves on host until SIGINT or SIGTERM, then drains in-flight requests within the shutdown timeout
 func (a *App) Run(host string) {
-	log.Fatal(http.ListenAndServe(host, a.Router))
+	listener, err := net.Listen("tcp", host)
+	if err != nil {
+		logging.Default.Fatal("could not listen", "addr", host, "error", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- a.Serve(listener)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-served:
+		logging.Default.Fatal("server stopped", "error", err)
+	case s := <-signals:
+		logging.Default.Info("shutting down", "signal", s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), orDefault(a.config.ShutdownTimeout, defaultShutdownTimeout))
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		logging.Default.Fatal("could not shut down cleanly", "error", err)
+	}
 }
 
-func (a *App) createDatabaseAndMigration(config *Config) {
-	a.ping(config)
+// Serve starts the workers and handles connections from the listener until the app is shut down
+func (a *App) Serve(listener net.Listener) error {
+	a.workers.start()
+	if err := a.Server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
 
+// Shutdown stops accepting connections, waits for in-flight requests and workers to finish and
+// closes the database pool. Requests still running when the context expires are abandoned.
+func (a *App) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+	if a.Server != nil {
+		shutdownErr = a.Server.Shutdown(ctx)
+	}
+	if err := a.workers.stop(ctx); err != nil && shutdownErr == nil {
+		shutdownErr = err
+	}
+	if a.DB != nil {
+		if err := a.DB.Close(); err != nil && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+	return shutdownErr
+}
+
+// tables are created at startup and checked by the readiness probe
+var tables = []interface{}{
+	(*model.Payment)(nil),
+	(*model.Attributes)(nil),
+	(*model.BeneficiaryParty)(nil),
+	(*model.ChargesInformation)(nil),
+	(*model.SponsorParty)(nil),
+	(*model.DebtorParty)(nil),
+	(*model.Charge)(nil),
+	(*model.Fx)(nil),
+	(*model.IdempotencyKey)(nil),
+	(*model.RateLimitBucket)(nil),
+	(*model.FxRate)(nil),
+	(*model.FxQuote)(nil),
+	(*model.PaymentSchedule)(nil),
+	(*model.StandingOrder)(nil),
+	(*model.StandingOrderPayment)(nil),
+	(*model.Mandate)(nil),
+	(*model.MandateEvent)(nil)}
+
+// indexes are created after the tables since go-pg only declares single column constraints
+var indexes = []string{
+	// two requests setting up the same reference can both find it free, the second insert fails
+	"CREATE UNIQUE INDEX IF NOT EXISTS mandates_organisation_id_reference_key ON mandates (organisation_id, reference)",
+}
+
+func (a *App) createDatabaseAndMigration(config *Config) {
 	db := pg.Connect(config.DB)
+	db.AddQueryHook(metrics.QueryHook{})
+	db.AddQueryHook(tracing.QueryHook{})
+	metrics.RegisterPool(db)
 
-	tables := []interface{}{
-		(*model.Payment)(nil),
-		(*model.Attributes)(nil),
-		(*model.BeneficiaryParty)(nil),
-		(*model.ChargesInformation)(nil),
-		(*model.SponsorParty)(nil),
-		(*model.DebtorParty)(nil),
-		(*model.Charge)(nil),
-		(*model.Fx)(nil)}
+	timeout := orDefault(config.DBStartupTimeout, defaultDBStartupTimeout)
+	if err := waitForDatabase(db, timeout); err != nil {
+		logging.Default.Fatal("database unreachable", "addr", config.DB.Addr, "timeout", timeout, "error", err)
+	}
 
 	for _, model := range tables {
-		db.Options()
-		err := db.CreateTable(model, &orm.CreateTableOptions{})
-		if err != nil {
-			log.Print(err)
+		if err := db.CreateTable(model, &orm.CreateTableOptions{IfNotExists: true}); err != nil {
+			logging.Default.Fatal("could not migrate database", "error", err)
+		}
+	}
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			logging.Default.Fatal("could not migrate database", "error", err)
 		}
 	}
 
 	a.DB = db
 }
 
-func (a *App) ping(config *Config) {
-	conn, err := sql.Open("postgres",
-		fmt.Sprintf("host=postgres port=5432 user=%s password=%s dbname=%s sslmode=disable",
-			config.DB.User, config.DB.Password, config.DB.Database))
-	if err != nil {
-		panic(err)
-	}
-	defer conn.Close()
-
-	// ping the database until it comes up
-	timeout := time.Now().Add(time.Second * 20)
-	for time.Now().Before(timeout) {
-		if err = conn.Ping(); err == nil {
-			break
+// waitForDatabase pings the database until it answers or the timeout passes
+func waitForDatabase(db *pg.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := db.Exec("SELECT 1")
+		if err == nil || time.Now().After(deadline) {
+			return err
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
+// newLimiter returns nil when no rate limits are configured
+func (a *App) newLimiter() *ratelimit.Limiter {
+	if a.config.RateLimit.IsZero() && a.config.IPRateLimit.IsZero() && len(a.config.RouteRateLimits) == 0 {
+		return nil
+	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if a.config.SharedRateLimits {
+		store = ratelimit.NewPostgresStore(a.DB)
+	}
+	return ratelimit.New(store, a.config.RateLimit, a.config.RouteRateLimits,
+		ratelimit.WithAPIKeys(a.config.RateLimitAPIKeys), ratelimit.WithIPLimit(a.config.IPRateLimit))
+}
+
 func (a *App) registerRoutes() {
 	a.Router = mux.NewRouter()
+	a.Router.Use(logging.Middleware)
+	a.Router.Use(tracing.Middleware)
+	a.Router.Use(metrics.Middleware)
+	if limiter := a.newLimiter(); limiter != nil {
+		a.Router.Use(handler.RateLimit(limiter))
+	}
+	a.Router.Use(handler.ContentNegotiation)
+	// bodies are limited before the validator reads them
+	imports := orDefaultBytes(a.config.MaxImportBytes, defaultMaxImportBytes)
+	a.Router.Use(handler.LimitBody(orDefaultBytes(a.config.MaxBodyBytes, defaultMaxBodyBytes), map[string]int64{
+		"POST /v1/payments/pain001": imports,
+		"POST /v1/payments/csv":     imports,
+		"POST /v1/fx/rates/csv":     imports,
+	}))
+	if a.config.ValidateOpenAPI {
+		a.Router.Use(openapi.Middleware(openapi.Spec(), handler.WriteError))
+	}
 	a.Router.HandleFunc("/v1/payments/{id}", a.GetPayment).Methods(http.MethodGet)
 	a.Router.HandleFunc("/v1/payments", a.CreatePayment).Methods(http.MethodPost)
 	a.Router.HandleFunc("/v1/payments/{id}", a.DeletePayment).Methods(http.MethodDelete)
-	a.Router.HandleFunc("/v1/payments/{id}", a.UpdatePayment).Methods(http.MethodPut)
+	a.Router.HandleFunc("/v1/payments/{id}", a.UpdatePayment).Methods(http.MethodPut, http.MethodPatch)
 	a.Router.HandleFunc("/v1/payments", a.GetPayments).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/payments/pain001", a.ImportPain001).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/payments/csv", a.ImportCSV).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/payments/charges", a.PreviewCharges).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/exports/bacs", a.ExportBacs).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/fx/rates", a.GetFxRates).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/fx/rates", a.CreateFxRate).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/fx/rates/csv", a.ImportFxRates).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/fx/quotes", a.CreateFxQuote).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/schedules", a.GetSchedules).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/standing-orders", a.CreateStandingOrder).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/standing-orders/{id}", a.GetStandingOrder).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/standing-orders/{id}", a.UpdateStandingOrder).Methods(http.MethodPatch)
+	a.Router.HandleFunc("/v1/standing-orders/{id}/payments", a.GetStandingOrderPayments).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/mandates", a.CreateMandate).Methods(http.MethodPost)
+	a.Router.HandleFunc("/v1/mandates/{id}", a.GetMandate).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/mandates/{id}", a.UpdateMandate).Methods(http.MethodPatch)
+	a.Router.HandleFunc("/v1/mandates/{id}/events", a.GetMandateEvents).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/calendars/{scheme}/next-business-day", a.GetNextBusinessDay).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/openapi.json", handler.GetOpenAPI).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/problems", handler.GetProblems).Methods(http.MethodGet)
+	a.Router.HandleFunc("/v1/problems/{code}", handler.GetProblem).Methods(http.MethodGet)
+	a.Router.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	a.Router.HandleFunc("/healthz", health.Handler(healthCheckTimeout)).Methods(http.MethodGet)
+	a.Router.HandleFunc("/readyz", health.Handler(healthCheckTimeout, a.readinessChecks()...)).Methods(http.MethodGet)
 }
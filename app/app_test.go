@@ -0,0 +1,288 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/clD11/form3-payments/client"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/openapi"
+	"github.com/clD11/form3-payments/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisteredRoutesShouldMatchOpenAPISpec(t *testing.T) {
+	a := &App{config: &Config{}}
+	a.registerRoutes()
+
+	registered := map[string]bool{}
+	a.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			registered[method+" "+template] = true
+		}
+		return nil
+	})
+
+	documented := map[string]bool{}
+	for path, item := range openapi.Spec().Paths {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	assert.Equal(t, keys(documented), keys(registered))
+}
+
+type blockingWorker struct {
+	stopped chan struct{}
+}
+
+func (w *blockingWorker) Name() string { return "blocking" }
+
+func (w *blockingWorker) Run(ctx context.Context) error {
+	<-ctx.Done()
+	close(w.stopped)
+	return nil
+}
+
+func TestShutdownShouldDrainInFlightRequestsAndStopWorkers(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	a := &App{config: &Config{}, Router: mux.NewRouter()}
+	a.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	a.Server = a.newServer()
+	worker := &blockingWorker{stopped: make(chan struct{})}
+	a.AddWorker(worker)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- a.Serve(listener) }()
+
+	responses := make(chan int, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			responses <- 0
+			return
+		}
+		response.Body.Close()
+		responses <- response.StatusCode
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- a.Shutdown(context.Background()) }()
+
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	assert.Equal(t, http.StatusNoContent, <-responses)
+	assert.NoError(t, <-shutdown)
+	assert.NoError(t, <-served)
+	<-worker.stopped
+}
+
+type failingWorker struct{}
+
+func (failingWorker) Name() string { return "failing" }
+
+func (failingWorker) Run(ctx context.Context) error { return errors.New("lost lock") }
+
+func TestWorkersShouldBeUnhealthyWhenAWorkerStopsOnItsOwn(t *testing.T) {
+	a := &App{}
+	a.AddWorker(failingWorker{})
+	a.workers.start()
+	defer a.workers.stop(context.Background())
+
+	for deadline := time.Now().Add(time.Second); a.workers.healthy() == nil && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.EqualError(t, a.workers.healthy(), "stopped workers failing: lost lock")
+}
+
+func TestNewServerShouldApplyDefaultLimits(t *testing.T) {
+	a := &App{config: &Config{WriteTimeout: time.Second}}
+
+	server := a.newServer()
+
+	assert.Equal(t, time.Second, server.WriteTimeout)
+	assert.Equal(t, defaultReadHeaderTimeout, server.ReadHeaderTimeout)
+	assert.Equal(t, defaultMaxHeaderBytes, server.MaxHeaderBytes)
+}
+
+func TestRateLimitShouldRejectClientOnceBucketIsEmpty(t *testing.T) {
+	a := &App{config: &Config{
+		RateLimit:        ratelimit.Limit{Requests: 100, Period: time.Minute},
+		RouteRateLimits:  map[string]ratelimit.Limit{"GET /v1/openapi.json": {Requests: 2, Period: time.Minute}},
+		RateLimitAPIKeys: []string{"a", "b"},
+	}}
+	a.registerRoutes()
+
+	get := func(path, client string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set(ratelimit.APIKeyHeader, client)
+		rw := httptest.NewRecorder()
+		a.Router.ServeHTTP(rw, request)
+		return rw
+	}
+
+	assert.Equal(t, "1", get("/v1/openapi.json", "a").Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "0", get("/v1/openapi.json", "a").Header().Get("RateLimit-Remaining"))
+
+	rejected := get("/v1/openapi.json", "a")
+	assert.Equal(t, http.StatusTooManyRequests, rejected.Code)
+	assert.Equal(t, "2", rejected.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "30", rejected.Header().Get("Retry-After"))
+	assert.Contains(t, rejected.Body.String(), `"code":"rate_limited"`)
+
+	assert.Equal(t, http.StatusOK, get("/v1/openapi.json", "b").Code)
+	// operational routes are never limited
+	assert.Empty(t, get("/healthz", "a").Header().Get("RateLimit-Limit"))
+}
+
+func TestLimitBodyShouldRejectLargeDocuments(t *testing.T) {
+	a := &App{config: &Config{MaxBodyBytes: 16, MaxImportBytes: 32}}
+	a.registerRoutes()
+
+	post := func(path string, body io.Reader) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, body)
+		request.Header.Set("Content-Type", "application/vnd.api+json")
+		rw := httptest.NewRecorder()
+		a.Router.ServeHTTP(rw, request)
+		return rw
+	}
+
+	declared := post("/v1/payments", strings.NewReader(`{"data":{"type":"Payment"}}`))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, declared.Code)
+	assert.Contains(t, declared.Body.String(), `"code":"body_too_large"`)
+
+	// a chunked body has no Content-Length, it is cut off while being read
+	chunked := post("/v1/payments", ioutil.NopCloser(strings.NewReader(`{"data":{"type":"Payment"}}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, chunked.Code)
+}
+
+func TestLimitBodyShouldApplyBeforeOpenAPIValidation(t *testing.T) {
+	a := &App{config: &Config{MaxBodyBytes: 16, ValidateOpenAPI: true}}
+	a.registerRoutes()
+
+	body := &countingReader{Reader: strings.NewReader(`{"data":{"type":"Payment","attributes":{"reference":"` + strings.Repeat("x", 1<<16) + `"}}}`)}
+	request := httptest.NewRequest(http.MethodPost, "/v1/payments", ioutil.NopCloser(body))
+	request.Header.Set("Content-Type", "application/vnd.api+json")
+	rw := httptest.NewRecorder()
+	a.Router.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"body_too_large"`)
+	// the validator stopped reading just past the limit rather than buffering the whole body
+	assert.True(t, body.read <= 17, "read %d bytes", body.read)
+}
+
+func TestOpenAPIValidationShouldNegotiateProblemDetails(t *testing.T) {
+	a := &App{config: &Config{ValidateOpenAPI: true}}
+	a.registerRoutes()
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/payments", strings.NewReader(`{"data":{"type":"Account"}}`))
+	request.Header.Set("Content-Type", "application/vnd.api+json")
+	request.Header.Set("Accept", "application/problem+json")
+	rw := httptest.NewRecorder()
+	a.Router.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Body.String(), `"code":"invalid_document"`)
+}
+
+// routerClient serves the app's router to a client. There is no database behind it, so only requests
+// the middleware answers can be made.
+func routerClient(a *App, retries int) (*client.Client, *int, func()) {
+	a.registerRoutes()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		a.Router.ServeHTTP(w, r)
+	}))
+	return client.New(server.URL, client.WithRetries(retries, time.Millisecond)), &requests, server.Close
+}
+
+func TestClientShouldDecodeErrorsFromRouter(t *testing.T) {
+	c, requests, closeServer := routerClient(&App{config: &Config{MaxBodyBytes: 16}}, 2)
+	defer closeServer()
+
+	_, err := c.Create(context.Background(), model.Payment{Attributes: model.Attributes{Amount: "10.00"}})
+
+	clientErr, ok := err.(*client.Error)
+	if !ok {
+		t.Fatalf("Create returned %v, not a *client.Error", err)
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, clientErr.StatusCode)
+	assert.Equal(t, "body_too_large", clientErr.Code)
+	assert.Equal(t, "Request body must be at most 16 bytes", clientErr.Detail)
+	// a client error is not retried
+	assert.Equal(t, 1, *requests)
+}
+
+func TestClientShouldWaitOutRateLimitFromRouter(t *testing.T) {
+	a := &App{config: &Config{MaxBodyBytes: 16,
+		RouteRateLimits: map[string]ratelimit.Limit{"POST /v1/payments": {Requests: 1, Period: time.Second}}}}
+	c, requests, closeServer := routerClient(a, 1)
+	defer closeServer()
+
+	payment := model.Payment{Attributes: model.Attributes{Amount: "10.00"}}
+	c.Create(context.Background(), payment)
+	start := time.Now()
+	_, err := c.Create(context.Background(), payment)
+
+	// the second request is limited, and retried once Retry-After has passed
+	assert.Equal(t, 3, *requests)
+	assert.True(t, time.Since(start) >= time.Second, "retried after %s", time.Since(start))
+	assert.False(t, client.IsRateLimited(err))
+	assert.Equal(t, "body_too_large", err.(*client.Error).Code)
+
+	c, requests, closeServer = routerClient(a, 0)
+	defer closeServer()
+	c.Create(context.Background(), payment)
+	_, err = c.Create(context.Background(), payment)
+	assert.True(t, client.IsRateLimited(err))
+	assert.Equal(t, 2, *requests)
+}
+
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func keys(m map[string]bool) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,9 +1,108 @@
 package app
 
 import (
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/charges"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/ratelimit"
+	"github.com/clD11/form3-payments/routing"
 	"github.com/go-pg/pg"
+	"time"
+)
+
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 64 << 10
+	defaultMaxBodyBytes      = 1 << 20
+	defaultMaxImportBytes    = 32 << 20
+	defaultShutdownTimeout   = 30 * time.Second
+	defaultDBStartupTimeout  = 20 * time.Second
+)
+
+const (
+	defaultOTLPEndpoint = "http://localhost:4318"
+	defaultServiceName  = "payments"
 )
 
 type Config struct {
 	DB *pg.Options
+	// DBStartupTimeout is how long startup waits for the database before failing
+	DBStartupTimeout time.Duration
+	// BacsServiceUserNumber identifies us in Standard 18 submissions
+	BacsServiceUserNumber string
+	// ValidateOpenAPI checks requests and responses against the OpenAPI document
+	ValidateOpenAPI bool
+
+	// HTTP server limits, zero values use the defaults above
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// MaxBodyBytes limits JSON:API request documents and MaxImportBytes pain.001 and CSV files
+	MaxBodyBytes   int64
+	MaxImportBytes int64
+	// ShutdownTimeout bounds how long Run waits for in-flight requests and workers after a signal
+	ShutdownTimeout time.Duration
+	// SchedulerInterval is how often the scheduler looks for payments due today, zero uses
+	// scheduler.DefaultInterval
+	SchedulerInterval time.Duration
+	// StandingOrderInterval is how often standing orders are checked for occurrences due today, zero
+	// uses standingorder.DefaultInterval
+	StandingOrderInterval time.Duration
+
+	// TracesExporter sends spans to "stdout" or an "otlp" collector, empty or "none" disables export
+	TracesExporter string
+	// OTLPEndpoint is the base URL of the collector's OTLP/HTTP receiver
+	OTLPEndpoint string
+	// ServiceName identifies the app in exported traces
+	ServiceName string
+
+	// RateLimit applies to each client of every API route without its own limit, zero disables it
+	RateLimit ratelimit.Limit
+	// RouteRateLimits are keyed by method and route template such as "GET /v1/payments"
+	RouteRateLimits map[string]ratelimit.Limit
+	// RateLimitAPIKeys are the API keys trusted to identify clients, others are limited by address
+	RateLimitAPIKeys []string
+	// IPRateLimit applies to every API request from an address on top of the client's limit, zero
+	// disables it
+	IPRateLimit ratelimit.Limit
+	// SharedRateLimits keeps the buckets in Postgres so limits hold across replicas
+	SharedRateLimits bool
+
+	// FxRounding rounds converted amounts to the minor units of their currency
+	FxRounding fx.Rounding
+	// FxTolerance is how far a payment's exchange rate may be from the stored rate as a fraction of
+	// it, zero uses fx.DefaultTolerance
+	FxTolerance float64
+	// FxQuoteTTL is how long a quote can be booked against, zero uses fx.DefaultQuoteTTL
+	FxQuoteTTL time.Duration
+
+	// FeeSchedule prices payments created without charges, nil leaves their charges to the client
+	FeeSchedule *charges.Schedule
+	// RoutingTable chooses the scheme of payments created without one, nil uses routing.DefaultTable
+	RoutingTable *routing.Table
+
+	// Calendars hold the holidays and cut-offs processing dates are checked against, nil uses the
+	// default cut-offs without holidays
+	Calendars *calendar.Calendars
+	// ProcessingDateRule applies to the default calendars, loaded ones carry their own
+	ProcessingDateRule calendar.DateRule
+}
+
+func orDefaultBytes(value, fallback int64) int64 {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
 }
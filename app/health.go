@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/clD11/form3-payments/health"
+	"sort"
+	"strings"
+	"time"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// readinessChecks report whether the app can serve requests: the database answers, every table
+// exists and no background worker has failed
+func (a *App) readinessChecks() []health.Check {
+	return []health.Check{
+		{Name: "database", Run: func(ctx context.Context) error {
+			if a.DB == nil {
+				return fmt.Errorf("not connected")
+			}
+			_, err := a.DB.WithContext(ctx).Exec("SELECT 1")
+			return err
+		}},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			if a.DB == nil {
+				return fmt.Errorf("not connected")
+			}
+			db := a.DB.WithContext(ctx)
+			for _, table := range tables {
+				if _, err := db.Model(table).Exists(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{Name: "workers", Run: func(ctx context.Context) error {
+			return a.workers.healthy()
+		}},
+	}
+}
+
+// healthy returns an error naming the workers that stopped on their own
+func (w *workers) healthy() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.failed) == 0 {
+		return nil
+	}
+	var failures []string
+	for name, err := range w.failed {
+		failures = append(failures, name+": "+err.Error())
+	}
+	sort.Strings(failures)
+	return fmt.Errorf("stopped workers %s", strings.Join(failures, "; "))
+}
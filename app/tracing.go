@@ -0,0 +1,32 @@
+package app
+
+import (
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/tracing"
+	"os"
+)
+
+// configureTracing installs the tracer for the configured exporter. The OTLP exporter sends in the
+// background so it runs as a worker and flushes its last spans on shutdown.
+func (a *App) configureTracing() {
+	switch a.config.TracesExporter {
+	case "", "none":
+		tracing.Default = tracing.NewTracer(nil)
+	case "stdout":
+		tracing.Default = tracing.NewTracer(tracing.NewWriterExporter(os.Stdout))
+	case "otlp":
+		endpoint := a.config.OTLPEndpoint
+		if endpoint == "" {
+			endpoint = defaultOTLPEndpoint
+		}
+		serviceName := a.config.ServiceName
+		if serviceName == "" {
+			serviceName = defaultServiceName
+		}
+		exporter := tracing.NewOTLPExporter(endpoint, serviceName)
+		tracing.Default = tracing.NewTracer(exporter)
+		a.AddWorker(exporter)
+	default:
+		logging.Default.Fatal("unknown traces exporter, use none, stdout or otlp", "exporter", a.config.TracesExporter)
+	}
+}
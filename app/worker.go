@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/clD11/form3-payments/logging"
+	"sync"
+)
+
+// Worker is a background job the app runs alongside the HTTP server
+type Worker interface {
+	Name() string
+	// Run does the work until the context is cancelled, returning early only on failure
+	Run(ctx context.Context) error
+}
+
+// workers runs the registered workers and stops them on shutdown
+type workers struct {
+	list   []Worker
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	failed map[string]error
+	done   sync.WaitGroup
+}
+
+// AddWorker registers a worker to start with the server, it must be called before Run or Serve
+func (a *App) AddWorker(w Worker) {
+	a.workers.list = append(a.workers.list, w)
+}
+
+func (w *workers) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.failed = map[string]error{}
+	for _, worker := range w.list {
+		w.done.Add(1)
+		go func(worker Worker) {
+			defer w.done.Done()
+			err := worker.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				err = errors.New("returned before shutdown")
+			}
+			logging.Default.Error("worker stopped", "worker", worker.Name(), "error", err)
+			w.mu.Lock()
+			w.failed[worker.Name()] = err
+			w.mu.Unlock()
+		}(worker)
+	}
+}
+
+// stop cancels the workers and waits for them to return or the context to expire
+func (w *workers) stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel := w.cancel
+	w.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		w.done.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,14 @@
+package attribute
+
+// Error is an attribute of a payment, or of a resource holding one, that cannot be accepted. Code
+// is the problem code it is reported with, Member the path of the attribute at fault, such as
+// fx/exchange_rate, and Meta anything more the response should explain, such as why each scheme
+// refused a payment.
+type Error struct {
+	Code    string
+	Member  string
+	Message string
+	Meta    map[string]interface{}
+}
+
+func (e *Error) Error() string { return e.Message }
@@ -0,0 +1,328 @@
+package bacs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const Scheme = "Bacs"
+
+// Transaction codes for detail and contra records
+const (
+	TransactionCredit      = "99"
+	TransactionDebit       = "17"
+	TransactionFirstDebit  = "01"
+	TransactionReDebit     = "18"
+	TransactionFinalDebit  = "19"
+	TransactionInterest    = "Z4"
+	TransactionDividend    = "Z5"
+	maxAmountPence         = 99999999999
+	labelLength            = 80
+	recordLength           = 100
+	maxUserReferenceLength = 18
+)
+
+var (
+	validTransactionCodes = map[string]bool{
+		TransactionCredit: true, TransactionDebit: true, TransactionFirstDebit: true, TransactionReDebit: true,
+		TransactionFinalDebit: true, TransactionInterest: true, TransactionDividend: true,
+	}
+	sortCodePattern  = regexp.MustCompile(`^[0-9]{6}$`)
+	accountPattern   = regexp.MustCompile(`^[0-9]{8}$`)
+	sunPattern       = regexp.MustCompile(`^[0-9A-Z]{6}$`)
+	referencePattern = regexp.MustCompile(`^[A-Z0-9.&/\- ]*$`)
+	invalidChars     = regexp.MustCompile(`[^A-Z0-9.&/\- ]`)
+)
+
+// Submission holds the details of the service user sending a Standard 18 file
+type Submission struct {
+	ServiceUserNumber string
+	// SerialNumber identifies the volume and must be unique per submission
+	SerialNumber string
+	CreationDate time.Time
+}
+
+type groupKey struct {
+	processingDate string
+	sponsor        model.SponsorParty
+}
+
+type record struct {
+	destinationSortCode string
+	destinationAccount  string
+	transactionCode     string
+	originSortCode      string
+	originAccount       string
+	pence               int64
+	originName          string
+	reference           string
+	destinationName     string
+}
+
+// Generate produces a Standard 18 file for the Bacs payments, with one file per processing date and
+// sponsor. Payments for other schemes are ignored.
+func (s Submission) Generate(payments []model.Payment) ([]byte, error) {
+	if err := ValidateServiceUserNumber(s.ServiceUserNumber); err != nil {
+		return nil, err
+	}
+	if len(s.SerialNumber) == 0 || len(s.SerialNumber) > 6 {
+		return nil, fmt.Errorf("serial number %q must be 1 to 6 characters", s.SerialNumber)
+	}
+
+	groups := map[groupKey][]model.Payment{}
+	var keys []groupKey
+	for _, payment := range payments {
+		if payment.Attributes.PaymentScheme != Scheme {
+			continue
+		}
+		key := groupKey{processingDate: payment.Attributes.ProcessingDate, sponsor: payment.Attributes.SponsorParty}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], payment)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no %s payments to submit", Scheme)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].processingDate != keys[j].processingDate {
+			return keys[i].processingDate < keys[j].processingDate
+		}
+		return keys[i].sponsor.AccountNumber < keys[j].sponsor.AccountNumber
+	})
+
+	var buf bytes.Buffer
+	writeLine(&buf, s.vol1())
+	for i, key := range keys {
+		if err := s.writeFile(&buf, i+1, key, groups[key]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateServiceUserNumber checks the number Bacs issued to the service user is 6 characters
+func ValidateServiceUserNumber(number string) error {
+	if !sunPattern.MatchString(number) {
+		return fmt.Errorf("service user number %q must be 6 characters", number)
+	}
+	return nil
+}
+
+func (s Submission) writeFile(buf *bytes.Buffer, number int, key groupKey, payments []model.Payment) error {
+	processingDate, err := time.Parse("2006-01-02", key.processingDate)
+	if err != nil {
+		return fmt.Errorf("processing_date %q is not a valid date", key.processingDate)
+	}
+
+	var records []record
+	contras := map[[2]string]*record{}
+	var contraKeys [][2]string
+
+	for _, payment := range payments {
+		detail, err := detailRecord(payment)
+		if err != nil {
+			return fmt.Errorf("payment %s: %s", payment.ID, err)
+		}
+		records = append(records, detail)
+
+		// contra records balance each originating account, debiting it for credits and crediting it for debits
+		contraCode := TransactionDebit
+		if detail.transactionCode != TransactionCredit {
+			contraCode = TransactionCredit
+		}
+		contraKey := [2]string{detail.originSortCode + detail.originAccount, contraCode}
+		contra, ok := contras[contraKey]
+		if !ok {
+			contra = &record{
+				destinationSortCode: detail.originSortCode,
+				destinationAccount:  detail.originAccount,
+				transactionCode:     contraCode,
+				originSortCode:      detail.originSortCode,
+				originAccount:       detail.originAccount,
+				originName:          "CONTRA",
+				destinationName:     detail.originName,
+			}
+			contras[contraKey] = contra
+			contraKeys = append(contraKeys, contraKey)
+		}
+		contra.pence += detail.pence
+		if contra.pence > maxAmountPence {
+			return fmt.Errorf("contra total for %s exceeds maximum amount", detail.originAccount)
+		}
+	}
+	for _, key := range contraKeys {
+		records = append(records, *contras[key])
+	}
+
+	fileID := s.fileIdentifier(number)
+	writeLine(buf, s.hdr1(fileID, number))
+	writeLine(buf, hdr2())
+	writeLine(buf, s.uhl1(processingDate, number))
+
+	var debitTotal, creditTotal, debitCount, creditCount int64
+	for _, r := range records {
+		line := r.String()
+		if len(line) != recordLength {
+			return fmt.Errorf("record for %s is %d characters, expected %d", r.destinationAccount, len(line), recordLength)
+		}
+		writeLine(buf, line)
+		if r.transactionCode == TransactionCredit || r.transactionCode == TransactionInterest || r.transactionCode == TransactionDividend {
+			creditTotal += r.pence
+			creditCount++
+		} else {
+			debitTotal += r.pence
+			debitCount++
+		}
+	}
+
+	writeLine(buf, "EOF1"+s.hdr1(fileID, number)[4:])
+	writeLine(buf, "EOF2"+hdr2()[4:])
+	writeLine(buf, fmt.Sprintf("UTL1%013d%013d%07d%07d%s", debitTotal, creditTotal, debitCount, creditCount, spaces(36)))
+	return nil
+}
+
+func detailRecord(payment model.Payment) (record, error) {
+	a := payment.Attributes
+	r := record{transactionCode: transactionCode(a)}
+	if !validTransactionCodes[r.transactionCode] {
+		return r, fmt.Errorf("transaction code %q is not valid", r.transactionCode)
+	}
+
+	debtorSortCode, debtorAccount, debtorName := a.DebtorParty.BankID, a.DebtorParty.AccountNumber, a.DebtorParty.AccountName
+	beneficiarySortCode, beneficiaryAccount, beneficiaryName := a.BeneficiaryParty.BankID, a.BeneficiaryParty.AccountNumber, a.BeneficiaryParty.AccountName
+
+	// for credits the debtor originates the payment, for direct debits the beneficiary collects it
+	if r.transactionCode == TransactionCredit || r.transactionCode == TransactionInterest || r.transactionCode == TransactionDividend {
+		r.originSortCode, r.originAccount, r.originName = debtorSortCode, debtorAccount, debtorName
+		r.destinationSortCode, r.destinationAccount, r.destinationName = beneficiarySortCode, beneficiaryAccount, beneficiaryName
+	} else {
+		r.originSortCode, r.originAccount, r.originName = beneficiarySortCode, beneficiaryAccount, beneficiaryName
+		r.destinationSortCode, r.destinationAccount, r.destinationName = debtorSortCode, debtorAccount, debtorName
+	}
+
+	for _, sortCode := range []string{r.originSortCode, r.destinationSortCode} {
+		if !sortCodePattern.MatchString(sortCode) {
+			return r, fmt.Errorf("sort code %q must be 6 digits", sortCode)
+		}
+	}
+	for _, account := range []string{r.originAccount, r.destinationAccount} {
+		if !accountPattern.MatchString(account) {
+			return r, fmt.Errorf("account number %q must be 8 digits", account)
+		}
+	}
+
+	pence, err := toPence(a.Amount)
+	if err != nil {
+		return r, err
+	}
+	r.pence = pence
+
+	if a.Currency != "GBP" {
+		return r, fmt.Errorf("currency %q is not GBP", a.Currency)
+	}
+
+	r.reference = strings.ToUpper(a.Reference)
+	if len(r.reference) > maxUserReferenceLength {
+		return r, fmt.Errorf("reference %q exceeds %d characters", a.Reference, maxUserReferenceLength)
+	}
+	if !referencePattern.MatchString(r.reference) {
+		return r, fmt.Errorf("reference %q contains characters Bacs does not accept", a.Reference)
+	}
+
+	r.originName = name(r.originName)
+	r.destinationName = name(r.destinationName)
+	return r, nil
+}
+
+// transactionCode uses the scheme payment sub type when it is a Bacs code, otherwise derives it from the payment type
+func transactionCode(a model.Attributes) string {
+	if validTransactionCodes[a.SchemePaymentSubType] {
+		return a.SchemePaymentSubType
+	}
+	if a.PaymentType == "Debit" {
+		return TransactionDebit
+	}
+	if a.PaymentType == "Credit" {
+		return TransactionCredit
+	}
+	return a.PaymentType
+}
+
+func (r record) String() string {
+	return r.destinationSortCode + r.destinationAccount + "0" + r.transactionCode +
+		r.originSortCode + r.originAccount + spaces(4) + fmt.Sprintf("%011d", r.pence) +
+		pad(r.originName, 18) + pad(r.reference, 18) + pad(r.destinationName, 18)
+}
+
+func (s Submission) vol1() string {
+	return "VOL1" + pad(s.SerialNumber, 6) + "0" + spaces(20) + spaces(6) + spaces(4) + s.ServiceUserNumber + spaces(4) + spaces(28) + "1"
+}
+
+func (s Submission) fileIdentifier(number int) string {
+	return "A" + s.ServiceUserNumber + "S" + spaces(2) + fmt.Sprintf("%02d", number%100) + spaces(5)
+}
+
+func (s Submission) hdr1(fileID string, number int) string {
+	return "HDR1" + fileID + pad(s.SerialNumber, 6) + "0001" + fmt.Sprintf("%04d", number) + spaces(4) + spaces(2) +
+		julian(s.CreationDate) + julian(s.CreationDate.AddDate(0, 0, 30)) + " " + "000000" + spaces(13) + spaces(7)
+}
+
+func hdr2() string {
+	return "HDR2" + "F" + "02000" + fmt.Sprintf("%05d", recordLength) + spaces(35) + "00" + spaces(28)
+}
+
+func (s Submission) uhl1(processingDate time.Time, number int) string {
+	return "UHL1" + julian(processingDate) + "999999" + spaces(4) + "00" + "000000" + "1 DAILY  " + fmt.Sprintf("%03d", number) +
+		spaces(7) + spaces(33)
+}
+
+func julian(t time.Time) string {
+	return fmt.Sprintf(" %02d%03d", t.Year()%100, t.YearDay())
+}
+
+func toPence(amount string) (int64, error) {
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok || value.Sign() <= 0 {
+		return 0, fmt.Errorf("amount %q is not a positive decimal", amount)
+	}
+	pence := new(big.Rat).Mul(value, big.NewRat(100, 1))
+	if !pence.IsInt() {
+		return 0, fmt.Errorf("amount %q has more than 2 decimal places", amount)
+	}
+	if !pence.Num().IsInt64() || pence.Num().Int64() > maxAmountPence {
+		return 0, fmt.Errorf("amount %q exceeds maximum Bacs amount", amount)
+	}
+	return pence.Num().Int64(), nil
+}
+
+// name upper cases and strips characters Bacs does not accept, truncating to the 18 character field
+func name(value string) string {
+	value = invalidChars.ReplaceAllString(strings.ToUpper(value), "")
+	if len(value) > 18 {
+		value = value[:18]
+	}
+	return value
+}
+
+func pad(value string, length int) string {
+	if len(value) >= length {
+		return value[:length]
+	}
+	return value + spaces(length-len(value))
+}
+
+func spaces(n int) string {
+	return strings.Repeat(" ", n)
+}
+
+func writeLine(buf *bytes.Buffer, line string) {
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
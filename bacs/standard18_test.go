@@ -0,0 +1,101 @@
+package bacs
+
+import (
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+var submission = Submission{
+	ServiceUserNumber: "123456",
+	SerialNumber:      "000001",
+	CreationDate:      time.Date(2017, 1, 16, 0, 0, 0, 0, time.UTC),
+}
+
+func TestGenerateShouldProduceFixedWidthFile(t *testing.T) {
+	file, err := submission.Generate([]model.Payment{bacsPayment("100.21"), bacsPayment("50.00")})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(file), "\r\n"), "\r\n")
+	labels := []string{"VOL1", "HDR1", "HDR2", "UHL1"}
+	for i, label := range labels {
+		assert.True(t, strings.HasPrefix(lines[i], label), "expected %s at line %d", label, i)
+		assert.Len(t, lines[i], labelLength)
+	}
+
+	records := lines[4:7]
+	for _, record := range records {
+		assert.Len(t, record, recordLength)
+	}
+	assert.Equal(t, "4030003192681909920330110161234    00000010021EJ BROWN BLACK    PIANO LESSONS     W OWENS           ", records[0])
+	assert.Equal(t, "2033011016123401720330110161234    00000015021CONTRA            "+pad("", 18)+"EJ BROWN BLACK    ", records[2])
+
+	assert.True(t, strings.HasPrefix(lines[7], "EOF1"))
+	assert.True(t, strings.HasPrefix(lines[8], "EOF2"))
+	assert.Equal(t, "UTL1"+"0000000015021"+"0000000015021"+"0000001"+"0000002"+spaces(36), lines[9])
+	assert.Equal(t, " 17018", lines[3][4:10])
+}
+
+func TestGenerateShouldGroupByProcessingDateAndSponsor(t *testing.T) {
+	later := bacsPayment("10.00")
+	later.Attributes.ProcessingDate = "2017-01-19"
+	otherSponsor := bacsPayment("20.00")
+	otherSponsor.Attributes.SponsorParty.AccountNumber = "99999999"
+	fps := bacsPayment("30.00")
+	fps.Attributes.PaymentScheme = "FPS"
+
+	file, err := submission.Generate([]model.Payment{bacsPayment("5.00"), later, otherSponsor, fps})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(file), "UHL1"))
+	assert.Equal(t, 3, strings.Count(string(file), "UTL1"))
+}
+
+func TestGenerateShouldRejectInvalidFields(t *testing.T) {
+	invalidSortCode := bacsPayment("1.00")
+	invalidSortCode.Attributes.BeneficiaryParty.BankID = "40-30-00"
+	longReference := bacsPayment("1.00")
+	longReference.Attributes.Reference = "Payment for Em's piano lessons"
+	invalidCode := bacsPayment("1.00")
+	invalidCode.Attributes.PaymentType = "Refund"
+
+	for payment, message := range map[*model.Payment]string{
+		&invalidSortCode: `sort code "40-30-00" must be 6 digits`,
+		&longReference:   `reference "Payment for Em's piano lessons" exceeds 18 characters`,
+		&invalidCode:     `transaction code "Refund" is not valid`,
+	} {
+		_, err := submission.Generate([]model.Payment{*payment})
+		assert.EqualError(t, err, "payment "+payment.ID.String()+": "+message)
+	}
+}
+
+func bacsPayment(amount string) model.Payment {
+	return model.Payment{
+		Type: "Payment",
+		Attributes: model.Attributes{
+			Amount:   amount,
+			Currency: "GBP",
+			BeneficiaryParty: model.BeneficiaryParty{
+				AccountName:   "W Owens",
+				AccountNumber: "31926819",
+				BankID:        "403000",
+			},
+			DebtorParty: model.DebtorParty{
+				AccountName:   "EJ Brown Black",
+				AccountNumber: "10161234",
+				BankID:        "203301",
+			},
+			PaymentScheme:  Scheme,
+			PaymentType:    "Credit",
+			ProcessingDate: "2017-01-18",
+			Reference:      "Piano lessons",
+			SponsorParty: model.SponsorParty{
+				AccountNumber: "56781234",
+				BankID:        "123123",
+				BankIDCode:    "GBDSC",
+			},
+		},
+	}
+}
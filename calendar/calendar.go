@@ -0,0 +1,304 @@
+package calendar
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DateLayout is the format of processing dates
+const DateLayout = "2006-01-02"
+
+// DateRule says what happens to a processing date the scheme does not process payments on
+type DateRule int
+
+const (
+	// RollForward moves the payment to the next business day
+	RollForward DateRule = iota
+	// Reject refuses the payment
+	Reject
+)
+
+var dateRules = map[string]DateRule{"roll_forward": RollForward, "reject": Reject}
+
+// ParseDateRule accepts roll_forward or reject, empty means roll_forward
+func ParseDateRule(name string) (DateRule, error) {
+	if name == "" {
+		return RollForward, nil
+	}
+	rule, ok := dateRules[name]
+	if !ok {
+		return RollForward, fmt.Errorf("processing date rule %q must be roll_forward or reject", name)
+	}
+	return rule, nil
+}
+
+// Scheme is when a scheme processes payments. A scheme that is not always open closes at weekends
+// and on the holidays of its own calendar and of the payment currency's. Payments for today must
+// arrive before CutOff, an HH:MM time in TimeZone, when there is one.
+type Scheme struct {
+	AlwaysOpen bool   `json:"always_open"`
+	CutOff     string `json:"cut_off"`
+	TimeZone   string `json:"time_zone"`
+
+	location *time.Location
+	cutOff   time.Duration
+}
+
+// defaultSchemes are the customer cut-offs of the schemes payments are routed to
+var defaultSchemes = map[string]Scheme{
+	"FPS":    {AlwaysOpen: true},
+	"Bacs":   {CutOff: "22:30", TimeZone: "Europe/London"},
+	"CHAPS":  {CutOff: "17:40", TimeZone: "Europe/London"},
+	"SEPACT": {CutOff: "16:00", TimeZone: "Europe/Brussels"},
+	"SWIFT":  {CutOff: "15:00", TimeZone: "Europe/London"},
+}
+
+func (s *Scheme) init() error {
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return fmt.Errorf("time_zone %q: %s", s.TimeZone, err)
+	}
+	s.location = location
+	if s.CutOff == "" {
+		return nil
+	}
+	at, err := time.Parse("15:04", s.CutOff)
+	if err != nil {
+		return fmt.Errorf("cut_off %q must be an HH:MM time", s.CutOff)
+	}
+	s.cutOff = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	return nil
+}
+
+// Calendars hold holidays keyed by scheme or currency and the hours of each scheme
+type Calendars struct {
+	Rule     DateRule
+	holidays map[string]map[string]string
+	schemes  map[string]Scheme
+}
+
+// New returns calendars with the default scheme hours and no holidays
+func New() (*Calendars, error) {
+	c := &Calendars{holidays: map[string]map[string]string{}, schemes: map[string]Scheme{}}
+	for name, scheme := range defaultSchemes {
+		if err := c.SetScheme(name, scheme); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Load reads the holidays of each {scheme or currency}.csv file in dir, and schemes.json when it
+// exists, a JSON object of scheme hours keyed by scheme that replace the defaults
+func Load(dir string) (*Calendars, error) {
+	c, err := New()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		holidays, err := ReadHolidays(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filepath.Base(path), err)
+		}
+		c.AddHolidays(strings.TrimSuffix(filepath.Base(path), ".csv"), holidays)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "schemes.json"))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	var schemes map[string]Scheme
+	if err := decoder.Decode(&schemes); err != nil {
+		return nil, fmt.Errorf("schemes.json: %s", err)
+	}
+	for name, scheme := range schemes {
+		if err := c.SetScheme(name, scheme); err != nil {
+			return nil, fmt.Errorf("schemes.json %s: %s", name, err)
+		}
+	}
+	return c, nil
+}
+
+// ReadHolidays reads a date,name CSV file, keyed by date
+func ReadHolidays(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+	if header[0] != "date" || header[1] != "name" {
+		return nil, fmt.Errorf("header must be date,name")
+	}
+	holidays := map[string]string{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return holidays, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := time.Parse(DateLayout, record[0]); err != nil {
+			return nil, fmt.Errorf("line %d: date %q is not in YYYY-MM-DD format", line, record[0])
+		}
+		holidays[record[0]] = record[1]
+	}
+}
+
+// AddHolidays adds to the holidays of a scheme or currency
+func (c *Calendars) AddHolidays(key string, holidays map[string]string) {
+	if c.holidays[key] == nil {
+		c.holidays[key] = map[string]string{}
+	}
+	for date, name := range holidays {
+		c.holidays[key][date] = name
+	}
+}
+
+// SetScheme replaces the hours of a scheme
+func (c *Calendars) SetScheme(name string, scheme Scheme) error {
+	if err := scheme.init(); err != nil {
+		return err
+	}
+	c.schemes[name] = scheme
+	return nil
+}
+
+// Known reports whether the scheme has hours of its own
+func (c *Calendars) Known(scheme string) bool {
+	_, ok := c.schemes[scheme]
+	return ok
+}
+
+// scheme returns the hours of a scheme, unknown schemes process payments on weekdays in UTC
+func (c *Calendars) scheme(name string) Scheme {
+	if scheme, ok := c.schemes[name]; ok {
+		return scheme
+	}
+	return Scheme{location: time.UTC}
+}
+
+// Closed returns why the scheme does not process payments in the currency on the date, or "" when
+// it is a business day
+func (c *Calendars) Closed(scheme, currency string, date time.Time) string {
+	if c.scheme(scheme).AlwaysOpen {
+		return ""
+	}
+	day := date.Format(DateLayout)
+	if weekday := date.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return fmt.Sprintf("%s is a %s", day, weekday)
+	}
+	for _, key := range []string{scheme, currency} {
+		if name, ok := c.holidays[key][day]; ok {
+			return fmt.Sprintf("%s is a %s holiday, %s", day, key, name)
+		}
+	}
+	return ""
+}
+
+// NextBusinessDay returns the first business day after the date
+func (c *Calendars) NextBusinessDay(scheme, currency string, date time.Time) (time.Time, error) {
+	// a year of holidays means the calendar is wrong rather than that the scheme is closed
+	for i := 1; i <= 366; i++ {
+		next := date.AddDate(0, 0, i)
+		if c.Closed(scheme, currency, next) == "" {
+			return next, nil
+		}
+	}
+	return date, fmt.Errorf("%s has no business day in the year after %s", scheme, date.Format(DateLayout))
+}
+
+// PreviousBusinessDay returns the last business day before the date
+func (c *Calendars) PreviousBusinessDay(scheme, currency string, date time.Time) (time.Time, error) {
+	for i := 1; i <= 366; i++ {
+		previous := date.AddDate(0, 0, -i)
+		if c.Closed(scheme, currency, previous) == "" {
+			return previous, nil
+		}
+	}
+	return date, fmt.Errorf("%s has no business day in the year before %s", scheme, date.Format(DateLayout))
+}
+
+// Today is the date in the scheme's time zone
+func (c *Calendars) Today(scheme string, now time.Time) time.Time {
+	local := now.In(c.scheme(scheme).location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CutOff returns the time payments for the date must arrive by, ok is false when the scheme has no
+// cut-off
+func (c *Calendars) CutOff(scheme string, date time.Time) (cutOff time.Time, ok bool) {
+	s := c.scheme(scheme)
+	if s.CutOff == "" {
+		return cutOff, false
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, s.location).Add(s.cutOff), true
+}
+
+// Adjustment records a processing date that was rolled forward and why
+type Adjustment struct {
+	Requested      string `json:"requested"`
+	ProcessingDate string `json:"processing_date"`
+	Reason         string `json:"reason"`
+}
+
+// Apply checks the processing date of a payment against its scheme and currency. A date that is
+// not a business day, or today after the cut-off, is rolled forward or rejected by the rule.
+// Earlier dates are only checked for being business days. Payments without a processing date are
+// left alone, the adjustment is nil when the date stands.
+func (c *Calendars) Apply(a *model.Attributes, now time.Time) (*Adjustment, error) {
+	if a.ProcessingDate == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(DateLayout, a.ProcessingDate)
+	if err != nil {
+		return nil, &attribute.Error{Code: "invalid_processing_date", Member: "processing_date", Message: fmt.Sprintf("processing_date %q is not in YYYY-MM-DD format", a.ProcessingDate)}
+	}
+
+	reason := c.Closed(a.PaymentScheme, a.Currency, date)
+	if reason == "" && date.Equal(c.Today(a.PaymentScheme, now)) {
+		if cutOff, ok := c.CutOff(a.PaymentScheme, date); ok && !now.Before(cutOff) {
+			s := c.scheme(a.PaymentScheme)
+			reason = fmt.Sprintf("%s is past the %s cut-off of %s %s", a.ProcessingDate, a.PaymentScheme, s.CutOff, s.TimeZone)
+		}
+	}
+	if reason == "" {
+		return nil, nil
+	}
+
+	next, err := c.NextBusinessDay(a.PaymentScheme, a.Currency, date)
+	if err != nil {
+		return nil, &attribute.Error{Code: "invalid_processing_date", Member: "processing_date", Message: err.Error()}
+	}
+	if c.Rule == Reject {
+		return nil, &attribute.Error{Code: "invalid_processing_date", Member: "processing_date",
+			Message: fmt.Sprintf("%s, the next business day is %s", reason, next.Format(DateLayout))}
+	}
+	adjustment := &Adjustment{Requested: a.ProcessingDate, ProcessingDate: next.Format(DateLayout), Reason: reason}
+	a.ProcessingDate = adjustment.ProcessingDate
+	return adjustment, nil
+}
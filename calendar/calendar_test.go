@@ -0,0 +1,151 @@
+package calendar
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse(DateLayout, s)
+	return d
+}
+
+func load(t *testing.T) *Calendars {
+	c, err := Load("holidays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClosedShouldCombineWeekendsAndSchemeAndCurrencyHolidays(t *testing.T) {
+	c := load(t)
+	c.AddHolidays("Bacs", map[string]string{"2026-10-20": "Bacs outage"})
+
+	assert.Equal(t, "", c.Closed("Bacs", "GBP", date("2026-10-19")))
+	assert.Equal(t, "2026-10-24 is a Saturday", c.Closed("Bacs", "GBP", date("2026-10-24")))
+	assert.Equal(t, "2026-12-28 is a GBP holiday, Boxing Day (substitute day)", c.Closed("CHAPS", "GBP", date("2026-12-28")))
+	assert.Equal(t, "2026-10-20 is a Bacs holiday, Bacs outage", c.Closed("Bacs", "GBP", date("2026-10-20")))
+	assert.Equal(t, "", c.Closed("CHAPS", "GBP", date("2026-10-20")))
+	assert.Equal(t, "", c.Closed("SEPACT", "EUR", date("2026-12-28")))
+	assert.Equal(t, "", c.Closed("FPS", "GBP", date("2026-12-25")))
+}
+
+func TestNextBusinessDayShouldSkipClosedDays(t *testing.T) {
+	c := load(t)
+
+	for _, test := range []struct{ scheme, currency, date, expected string }{
+		{"Bacs", "GBP", "2026-12-24", "2026-12-29"},
+		{"SEPACT", "EUR", "2026-12-24", "2026-12-28"},
+		{"CHAPS", "GBP", "2026-04-02", "2026-04-07"},
+		{"FPS", "GBP", "2026-12-24", "2026-12-25"},
+		{"Unknown", "", "2026-10-23", "2026-10-26"},
+	} {
+		next, err := c.NextBusinessDay(test.scheme, test.currency, date(test.date))
+
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, next.Format(DateLayout), "%s %s after %s", test.scheme, test.currency, test.date)
+	}
+}
+
+func TestPreviousBusinessDayShouldSkipClosedDays(t *testing.T) {
+	c := load(t)
+
+	previous, err := c.PreviousBusinessDay("Bacs", "GBP", date("2026-12-29"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-12-24", previous.Format(DateLayout))
+}
+
+func TestApplyShouldRollForwardClosedDatesAndTodayAfterCutOff(t *testing.T) {
+	c := load(t)
+	// 18:00 in London is after the CHAPS cut-off but before the Bacs one
+	now := time.Date(2026, 10, 19, 17, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		scheme, date string
+		expected     *Adjustment
+	}{
+		{"Bacs", "2026-10-19", nil},
+		{"FPS", "2026-10-18", nil},
+		{"CHAPS", "2026-10-19", &Adjustment{Requested: "2026-10-19", ProcessingDate: "2026-10-20",
+			Reason: "2026-10-19 is past the CHAPS cut-off of 17:40 Europe/London"}},
+		{"CHAPS", "2026-12-25", &Adjustment{Requested: "2026-12-25", ProcessingDate: "2026-12-29",
+			Reason: "2026-12-25 is a GBP holiday, Christmas Day"}},
+		// earlier dates are not checked against the cut-off
+		{"CHAPS", "2026-10-16", nil},
+	} {
+		a := model.Attributes{PaymentScheme: test.scheme, Currency: "GBP", ProcessingDate: test.date}
+		adjustment, err := c.Apply(&a, now)
+
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, adjustment, "%s on %s", test.scheme, test.date)
+		if test.expected != nil {
+			assert.Equal(t, test.expected.ProcessingDate, a.ProcessingDate)
+		}
+	}
+
+	a := model.Attributes{PaymentScheme: "Bacs", Currency: "GBP"}
+	adjustment, err := c.Apply(&a, now)
+	assert.NoError(t, err)
+	assert.Nil(t, adjustment)
+	assert.Equal(t, "", a.ProcessingDate)
+}
+
+func TestApplyShouldRejectClosedDatesUnderRejectRule(t *testing.T) {
+	c := load(t)
+	c.Rule = Reject
+
+	a := model.Attributes{PaymentScheme: "Bacs", Currency: "GBP", ProcessingDate: "2026-10-24"}
+	_, err := c.Apply(&a, time.Now())
+	assert.EqualError(t, err, "2026-10-24 is a Saturday, the next business day is 2026-10-26")
+	assert.Equal(t, "processing_date", err.(*attribute.Error).Member)
+	assert.Equal(t, "2026-10-24", a.ProcessingDate)
+
+	a.ProcessingDate = "24/10/2026"
+	_, err = c.Apply(&a, time.Now())
+	assert.EqualError(t, err, `processing_date "24/10/2026" is not in YYYY-MM-DD format`)
+}
+
+func TestCutOffShouldBeInSchemeTimeZone(t *testing.T) {
+	c := load(t)
+
+	cutOff, ok := c.CutOff("Bacs", date("2026-07-01"))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 7, 1, 21, 30, 0, 0, time.UTC), cutOff.UTC())
+	cutOff, _ = c.CutOff("Bacs", date("2026-12-01"))
+	assert.Equal(t, time.Date(2026, 12, 1, 22, 30, 0, 0, time.UTC), cutOff.UTC())
+
+	_, ok = c.CutOff("FPS", date("2026-07-01"))
+	assert.False(t, ok)
+}
+
+func TestReadHolidaysShouldRejectInvalidFiles(t *testing.T) {
+	_, err := ReadHolidays(strings.NewReader("day,name\n"))
+	assert.EqualError(t, err, "header must be date,name")
+
+	_, err = ReadHolidays(strings.NewReader("date,name\n2026-12-25,Christmas Day\n25/12/2026,Christmas Day\n"))
+	assert.EqualError(t, err, `line 3: date "25/12/2026" is not in YYYY-MM-DD format`)
+}
+
+func TestSetSchemeShouldRejectInvalidHours(t *testing.T) {
+	c, _ := New()
+
+	assert.EqualError(t, c.SetScheme("Bacs", Scheme{CutOff: "10pm"}), `cut_off "10pm" must be an HH:MM time`)
+	assert.Contains(t, c.SetScheme("Bacs", Scheme{TimeZone: "Europe/Nowhere"}).Error(), `time_zone "Europe/Nowhere"`)
+}
+
+func TestParseDateRule(t *testing.T) {
+	rule, err := ParseDateRule("reject")
+	assert.NoError(t, err)
+	assert.Equal(t, Reject, rule)
+
+	rule, _ = ParseDateRule("")
+	assert.Equal(t, RollForward, rule)
+
+	_, err = ParseDateRule("skip")
+	assert.EqualError(t, err, `processing date rule "skip" must be roll_forward or reject`)
+}
@@ -0,0 +1,177 @@
+package charges
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/model"
+	"io"
+	"math/big"
+	"os"
+)
+
+// Fee is a fixed amount plus a percentage of the payment amount, kept between Min and Max when they
+// are set. Every amount is in the payment currency.
+type Fee struct {
+	Fixed   string `json:"fixed"`
+	Percent string `json:"percent"`
+	Min     string `json:"min"`
+	Max     string `json:"max"`
+}
+
+// Rule prices payments of a scheme, currency and payment type whose amount is at least MinAmount and
+// below MaxAmount. Empty members match any payment. Sender is the fee of the debtor's bank and
+// Receiver the fee of the creditor's bank.
+type Rule struct {
+	Name        string `json:"name"`
+	Scheme      string `json:"payment_scheme"`
+	Currency    string `json:"currency"`
+	PaymentType string `json:"payment_type"`
+	MinAmount   string `json:"min_amount"`
+	MaxAmount   string `json:"max_amount"`
+	Sender      Fee    `json:"sender"`
+	Receiver    Fee    `json:"receiver"`
+}
+
+// Schedule is a list of rules, the first that matches a payment prices it
+type Schedule struct {
+	Rules []Rule
+}
+
+// LoadSchedule reads a schedule file
+func LoadSchedule(path string) (*Schedule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseSchedule(file)
+}
+
+// ParseSchedule reads a JSON array of rules
+func ParseSchedule(r io.Reader) (*Schedule, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var rules []Rule
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("fee schedule: %s", err)
+	}
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("fee schedule rule %d: %s", i+1, err)
+		}
+	}
+	return &Schedule{Rules: rules}, nil
+}
+
+func (r Rule) validate() error {
+	for name, value := range map[string]string{
+		"min_amount": r.MinAmount, "max_amount": r.MaxAmount,
+		"sender.fixed": r.Sender.Fixed, "sender.percent": r.Sender.Percent, "sender.min": r.Sender.Min, "sender.max": r.Sender.Max,
+		"receiver.fixed": r.Receiver.Fixed, "receiver.percent": r.Receiver.Percent, "receiver.min": r.Receiver.Min, "receiver.max": r.Receiver.Max,
+	} {
+		if value != "" && fx.Decimal(value) == nil {
+			return fmt.Errorf("%s %q is not a decimal", name, value)
+		}
+	}
+	if r.MinAmount != "" && r.MaxAmount != "" && fx.Decimal(r.MinAmount).Cmp(fx.Decimal(r.MaxAmount)) >= 0 {
+		return fmt.Errorf("min_amount %s must be below max_amount %s", r.MinAmount, r.MaxAmount)
+	}
+	return nil
+}
+
+func (r Rule) matches(a model.Attributes, amount *big.Rat) bool {
+	if (r.Scheme != "" && r.Scheme != a.PaymentScheme) ||
+		(r.Currency != "" && r.Currency != a.Currency) ||
+		(r.PaymentType != "" && r.PaymentType != a.PaymentType) {
+		return false
+	}
+	if r.MinAmount != "" && amount.Cmp(fx.Decimal(r.MinAmount)) < 0 {
+		return false
+	}
+	return r.MaxAmount == "" || amount.Cmp(fx.Decimal(r.MaxAmount)) < 0
+}
+
+func (f Fee) amount(amount *big.Rat) *big.Rat {
+	fee := new(big.Rat)
+	if f.Fixed != "" {
+		fee.Add(fee, fx.Decimal(f.Fixed))
+	}
+	if f.Percent != "" {
+		percent := new(big.Rat).Mul(amount, fx.Decimal(f.Percent))
+		fee.Add(fee, percent.Quo(percent, big.NewRat(100, 1)))
+	}
+	if f.Min != "" && fee.Cmp(fx.Decimal(f.Min)) < 0 {
+		fee = fx.Decimal(f.Min)
+	}
+	if f.Max != "" && fee.Cmp(fx.Decimal(f.Max)) > 0 {
+		fee = fx.Decimal(f.Max)
+	}
+	return fee
+}
+
+// DefaultBearer shares the charges when the payment does not say who bears them
+const DefaultBearer = "SHAR"
+
+// Calculate prices the payment with the first rule that matches it, rule is nil when none does or
+// there is no schedule. The bearer code decides who pays: SHAR leaves the sender fee with the
+// debtor and the receiver fee with the creditor, DEBT charges both to the debtor as sender charges
+// and CRED both to the creditor as receiver charges.
+func (s *Schedule) Calculate(a model.Attributes) (charges model.ChargesInformation, rule *Rule, err error) {
+	if s == nil {
+		return a.ChargesInformation, nil, nil
+	}
+	charges.BearerCode = a.ChargesInformation.BearerCode
+	if charges.BearerCode == "" {
+		charges.BearerCode = DefaultBearer
+	}
+	if charges.BearerCode != "SHAR" && charges.BearerCode != "DEBT" && charges.BearerCode != "CRED" {
+		return charges, nil, &attribute.Error{Code: "invalid_charges", Member: "charges_information/bearer_code",
+			Message: fmt.Sprintf("bearer_code %q must be SHAR, DEBT or CRED", charges.BearerCode)}
+	}
+	amount := fx.Decimal(a.Amount)
+	if amount == nil {
+		return charges, nil, &attribute.Error{Code: "invalid_charges", Member: "amount", Message: fmt.Sprintf("amount %q is not a decimal", a.Amount)}
+	}
+	for i := range s.Rules {
+		if s.Rules[i].matches(a, amount) {
+			rule = &s.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return charges, nil, nil
+	}
+
+	sender, receiver := rule.Sender.amount(amount), rule.Receiver.amount(amount)
+	switch charges.BearerCode {
+	case "DEBT":
+		sender, receiver = new(big.Rat).Add(sender, receiver), new(big.Rat)
+	case "CRED":
+		sender, receiver = new(big.Rat), new(big.Rat).Add(sender, receiver)
+	}
+	places := fx.MinorUnits(a.Currency)
+	if sender.Sign() > 0 {
+		charges.SenderCharges = []model.Charge{{Amount: round(sender, places), Currency: a.Currency}}
+	}
+	if receiver.Sign() > 0 {
+		charges.ReceiverChargesAmount = round(receiver, places)
+		charges.ReceiverChargesCurrency = a.Currency
+	}
+	return charges, rule, nil
+}
+
+// round rounds half up to the minor units of the currency, fees are never negative
+func round(x *big.Rat, places int) string {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	scaled := new(big.Rat).Mul(x, new(big.Rat).SetInt(scale))
+	scaled.Add(scaled, big.NewRat(1, 2))
+	units := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	return new(big.Rat).SetFrac(units, scale).FloatString(places)
+}
+
+// Absent reports whether the payment has no charges of its own, only then are they calculated
+func Absent(c model.ChargesInformation) bool {
+	return len(c.SenderCharges) == 0 && c.ReceiverChargesAmount == ""
+}
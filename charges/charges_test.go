@@ -0,0 +1,99 @@
+package charges
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const schedule = `[
+	{"name": "fps-small", "payment_scheme": "FPS", "currency": "GBP", "max_amount": "1000",
+		"sender": {"fixed": "0.20", "percent": "0.1"}, "receiver": {"fixed": "0.10"}},
+	{"name": "fps-large", "payment_scheme": "FPS", "currency": "GBP", "min_amount": "1000",
+		"sender": {"percent": "0.05", "max": "5.00"}},
+	{"name": "swift", "payment_scheme": "SWIFT",
+		"sender": {"fixed": "15"}, "receiver": {"percent": "0.2", "min": "10"}}
+]`
+
+func TestCalculateShouldPriceWithFirstMatchingRuleAndBearer(t *testing.T) {
+	s, err := ParseSchedule(strings.NewReader(schedule))
+	assert.NoError(t, err)
+
+	for _, c := range []struct {
+		scheme, currency, amount, bearer string
+		rule                             string
+		expected                         model.ChargesInformation
+	}{
+		// 0.20 + 0.1% of 100.21 is 0.30021
+		{"FPS", "GBP", "100.21", "", "fps-small", model.ChargesInformation{BearerCode: "SHAR",
+			SenderCharges: []model.Charge{{Amount: "0.30", Currency: "GBP"}}, ReceiverChargesAmount: "0.10", ReceiverChargesCurrency: "GBP"}},
+		{"FPS", "GBP", "100.21", "DEBT", "fps-small", model.ChargesInformation{BearerCode: "DEBT",
+			SenderCharges: []model.Charge{{Amount: "0.40", Currency: "GBP"}}}},
+		{"FPS", "GBP", "100.21", "CRED", "fps-small", model.ChargesInformation{BearerCode: "CRED",
+			ReceiverChargesAmount: "0.40", ReceiverChargesCurrency: "GBP"}},
+		// the band includes its minimum and the fee is capped
+		{"FPS", "GBP", "1000", "SHAR", "fps-large", model.ChargesInformation{BearerCode: "SHAR",
+			SenderCharges: []model.Charge{{Amount: "0.50", Currency: "GBP"}}}},
+		{"FPS", "GBP", "50000", "SHAR", "fps-large", model.ChargesInformation{BearerCode: "SHAR",
+			SenderCharges: []model.Charge{{Amount: "5.00", Currency: "GBP"}}}},
+		// the receiver fee is raised to its minimum and rounded to the currency's minor units
+		{"SWIFT", "JPY", "1000", "SHAR", "swift", model.ChargesInformation{BearerCode: "SHAR",
+			SenderCharges: []model.Charge{{Amount: "15", Currency: "JPY"}}, ReceiverChargesAmount: "10", ReceiverChargesCurrency: "JPY"}},
+		{"SWIFT", "USD", "10000.25", "SHAR", "swift", model.ChargesInformation{BearerCode: "SHAR",
+			SenderCharges: []model.Charge{{Amount: "15.00", Currency: "USD"}}, ReceiverChargesAmount: "20.00", ReceiverChargesCurrency: "USD"}},
+	} {
+		a := model.Attributes{PaymentScheme: c.scheme, Currency: c.currency, Amount: c.amount,
+			ChargesInformation: model.ChargesInformation{BearerCode: c.bearer}}
+		charges, rule, err := s.Calculate(a)
+
+		assert.NoError(t, err)
+		if assert.NotNil(t, rule, "%s %s %s", c.scheme, c.currency, c.amount) {
+			assert.Equal(t, c.rule, rule.Name)
+		}
+		assert.Equal(t, c.expected, charges, "%s %s %s %s", c.scheme, c.currency, c.amount, c.bearer)
+	}
+}
+
+func TestCalculateShouldLeaveUnmatchedPaymentsAlone(t *testing.T) {
+	s, _ := ParseSchedule(strings.NewReader(schedule))
+
+	charges, rule, err := s.Calculate(model.Attributes{PaymentScheme: "FPS", Currency: "EUR", Amount: "10.00"})
+	assert.NoError(t, err)
+	assert.Nil(t, rule)
+	assert.Equal(t, model.ChargesInformation{BearerCode: "SHAR"}, charges)
+
+	var none *Schedule
+	_, rule, err = none.Calculate(model.Attributes{Amount: "10.00", ChargesInformation: model.ChargesInformation{BearerCode: "OUR"}})
+	assert.NoError(t, err)
+	assert.Nil(t, rule)
+}
+
+func TestCalculateShouldRejectUnknownBearer(t *testing.T) {
+	s, _ := ParseSchedule(strings.NewReader(schedule))
+
+	_, _, err := s.Calculate(model.Attributes{Amount: "10.00", ChargesInformation: model.ChargesInformation{BearerCode: "OUR"}})
+	assert.EqualError(t, err, `bearer_code "OUR" must be SHAR, DEBT or CRED`)
+	assert.Equal(t, "charges_information/bearer_code", err.(*attribute.Error).Member)
+
+	_, _, err = s.Calculate(model.Attributes{Amount: "ten"})
+	assert.EqualError(t, err, `amount "ten" is not a decimal`)
+}
+
+func TestParseScheduleShouldRejectInvalidRules(t *testing.T) {
+	for document, message := range map[string]string{
+		`[{"min_amount": "100", "max_amount": "100"}]`: "fee schedule rule 1: min_amount 100 must be below max_amount 100",
+		`[{}, {"sender": {"percent": "1%"}}]`:          `fee schedule rule 2: sender.percent "1%" is not a decimal`,
+		`[{"bearer_code": "SHAR"}]`:                    `fee schedule: json: unknown field "bearer_code"`,
+	} {
+		_, err := ParseSchedule(strings.NewReader(document))
+		assert.EqualError(t, err, message)
+	}
+}
+
+func TestAbsent(t *testing.T) {
+	assert.True(t, Absent(model.ChargesInformation{BearerCode: "SHAR"}))
+	assert.False(t, Absent(model.ChargesInformation{ReceiverChargesAmount: "1.00"}))
+	assert.False(t, Absent(model.ChargesInformation{SenderCharges: []model.Charge{{Amount: "1.00", Currency: "GBP"}}}))
+}
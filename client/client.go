@@ -0,0 +1,256 @@
+// Package client calls the payment API using the model types
+package client
+
+import (
+	"bytes"
+	"context"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 100 * time.Millisecond
+)
+
+// Client calls the payment API at a base URL such as http://localhost:8080
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests with the given client instead of http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the delay before the first
+// retry, which doubles on every further attempt
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Get fetches a payment by ID
+func (c *Client) Get(ctx context.Context, id uuid.UUID) (model.Payment, error) {
+	body, err := c.do(ctx, http.MethodGet, jsonapi.PaymentLink(id), nil, "")
+	if err != nil {
+		return model.Payment{}, err
+	}
+	return jsonapi.DecodePayment(bytes.NewReader(body))
+}
+
+// ListOptions selects a page of payments, zero values use the server defaults
+type ListOptions struct {
+	PageNumber int
+	PageSize   int
+	// Filters match payments by attribute, such as "currency" or "payment_scheme"
+	Filters map[string]string
+}
+
+func (o ListOptions) path() string {
+	query := url.Values{}
+	for name, value := range o.Filters {
+		query.Set("filter["+name+"]", value)
+	}
+	if o.PageNumber > 0 {
+		query.Set("page[number]", strconv.Itoa(o.PageNumber))
+	}
+	if o.PageSize > 0 {
+		query.Set("page[size]", strconv.Itoa(o.PageSize))
+	}
+	if len(query) == 0 {
+		return "/v1/payments"
+	}
+	return "/v1/payments?" + query.Encode()
+}
+
+// Page is one page of payments
+type Page struct {
+	Payments []model.Payment
+	Total    int
+	next     string
+}
+
+// HasNext reports whether the server has a further page
+func (p *Page) HasNext() bool {
+	return p.next != ""
+}
+
+// List fetches a single page of payments, use Payments to iterate over every page
+func (c *Client) List(ctx context.Context, options ListOptions) (*Page, error) {
+	return c.list(ctx, options.path())
+}
+
+func (c *Client) list(ctx context.Context, path string) (*Page, error) {
+	body, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	payments, doc, err := jsonapi.DecodePayments(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Payments: payments}
+	if total, ok := doc.Meta["total"].(float64); ok {
+		page.Total = int(total)
+	}
+	if doc.Links != nil {
+		page.next = doc.Links.Next
+	}
+	return page, nil
+}
+
+// Payments iterates over every payment starting from the page selected by the options
+func (c *Client) Payments(ctx context.Context, options ListOptions) *Iterator {
+	return &Iterator{client: c, ctx: ctx, next: options.path()}
+}
+
+// Create stores a new payment. A payment without an ID is given one before it is sent and the
+// request carries an Idempotency-Key so retries cannot create it twice.
+func (c *Client) Create(ctx context.Context, payment model.Payment) (model.Payment, error) {
+	if uuid.Equal(payment.ID, uuid.Nil) {
+		payment.ID = uuid.NewV4()
+	}
+	if payment.Type == "" {
+		payment.Type = jsonapi.PaymentType
+	}
+	document, err := jsonapi.EncodePayment(payment)
+	if err != nil {
+		return model.Payment{}, err
+	}
+
+	body, err := c.do(ctx, http.MethodPost, "/v1/payments", document, uuid.NewV4().String())
+	if err != nil {
+		return model.Payment{}, err
+	}
+	return jsonapi.DecodePayment(bytes.NewReader(body))
+}
+
+// Update changes the stored payment to the members of the one given, which are merged like PATCH
+// merges them. The payment's version must be the one it was read at. A lost response is not retried,
+// the update may have been applied and a retry would fail with version_conflict, so the caller should
+// get the payment to see whether it was.
+func (c *Client) Update(ctx context.Context, payment model.Payment) (model.Payment, error) {
+	if payment.Type == "" {
+		payment.Type = jsonapi.PaymentType
+	}
+	document, err := jsonapi.EncodePayment(payment)
+	if err != nil {
+		return model.Payment{}, err
+	}
+
+	body, err := c.do(ctx, http.MethodPut, jsonapi.PaymentLink(payment.ID), document, "")
+	if err != nil {
+		return model.Payment{}, err
+	}
+	return jsonapi.DecodePayment(bytes.NewReader(body))
+}
+
+// Delete removes a payment. A retry after a lost response reports the payment as not found.
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := c.do(ctx, http.MethodDelete, jsonapi.PaymentLink(id), nil, "")
+	return err
+}
+
+// do sends the request, retrying network failures and transient statuses until the retries are
+// used up or the context is done, and returns the body of a successful response
+func (c *Client) do(ctx context.Context, method, path string, body []byte, idempotencyKey string) ([]byte, error) {
+	// an update is versioned so it can only be retried when it was rate limited, which it is before
+	// the server applies it
+	versioned := method == http.MethodPut
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request = request.WithContext(ctx)
+		request.Header.Set("Accept", jsonapi.MediaType)
+		if body != nil {
+			request.Header.Set("Content-Type", jsonapi.MediaType)
+		}
+		if idempotencyKey != "" {
+			request.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+
+		var wait time.Duration
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if versioned {
+				return nil, err
+			}
+		} else {
+			data, readErr := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			if response.StatusCode < 400 {
+				return data, readErr
+			}
+			err = newError(response.StatusCode, data)
+			if !retryable(response.StatusCode) || (versioned && response.StatusCode != http.StatusTooManyRequests) {
+				return nil, err
+			}
+			wait = retryAfter(response.Header.Get("Retry-After"))
+		}
+
+		if attempt >= c.retries {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.backoff << uint(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header given in seconds
+func retryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
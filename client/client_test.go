@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	return New(server.URL, WithRetries(2, time.Millisecond)), server.Close
+}
+
+func writeDocument(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", jsonapi.MediaType)
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+func TestCreateShouldRetryWithTheSameIdempotencyKey(t *testing.T) {
+	var keys []string
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		resource, _ := jsonapi.DecodeResource(r.Body)
+		payment, _ := resource.Payment()
+		body, _ := jsonapi.EncodePayment(payment)
+		writeDocument(w, http.StatusCreated, string(body))
+	})
+	defer closeServer()
+
+	payment, err := c.Create(context.Background(), model.Payment{Attributes: model.Attributes{Amount: "10.00"}})
+
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.False(t, uuid.Equal(uuid.Nil, payment.ID))
+	assert.Equal(t, "10.00", payment.Attributes.Amount)
+}
+
+func TestUpdateShouldOnlyRetryWhenRateLimited(t *testing.T) {
+	statuses := []int{http.StatusTooManyRequests, http.StatusBadGateway}
+	calls := 0
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[calls])
+		calls++
+	})
+	defer closeServer()
+
+	_, err := c.Update(context.Background(), model.Payment{ID: uuid.NewV4()})
+
+	// the 502 may have come after the update was applied so it is not retried
+	assert.Equal(t, http.StatusBadGateway, err.(*Error).StatusCode)
+	assert.Equal(t, 2, calls)
+}
+
+func TestGetShouldReturnTypedErrorFromErrorDocument(t *testing.T) {
+	calls := 0
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeDocument(w, http.StatusNotFound, `{"errors":[{"status":"404","code":"payment_not_found","detail":"Payment not found"}]}`)
+	})
+	defer closeServer()
+
+	_, err := c.Get(context.Background(), uuid.NewV4())
+
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsConflict(err))
+	assert.Equal(t, "payment_not_found", err.(*Error).Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoShouldReturnLastErrorWhenRetriesUsedUp(t *testing.T) {
+	calls := 0
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	defer closeServer()
+
+	err := c.Delete(context.Background(), uuid.NewV4())
+
+	assert.True(t, IsRateLimited(err))
+	assert.Equal(t, 3, calls)
+}
+
+func TestDoShouldStopRetryingWhenContextIsDone(t *testing.T) {
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, uuid.NewV4())
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestPaymentsShouldFollowNextLinks(t *testing.T) {
+	first, second := model.Payment{ID: uuid.NewV4(), Type: jsonapi.PaymentType}, model.Payment{ID: uuid.NewV4(), Type: jsonapi.PaymentType}
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		document := jsonapi.NewPaymentsDocument([]model.Payment{first}, r.URL.RequestURI())
+		document.Links.Next = "/v1/payments?page%5Bnumber%5D=2&page%5Bsize%5D=1"
+		if r.URL.Query().Get("page[number]") == "2" {
+			document = jsonapi.NewPaymentsDocument([]model.Payment{second}, r.URL.RequestURI())
+		}
+		body, _ := json.Marshal(document)
+		writeDocument(w, http.StatusOK, string(body))
+	})
+	defer closeServer()
+
+	var ids []uuid.UUID
+	it := c.Payments(context.Background(), ListOptions{PageSize: 1})
+	for it.Next() {
+		ids = append(ids, it.Payment().ID)
+	}
+
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []uuid.UUID{first.ID, second.ID}, ids)
+}
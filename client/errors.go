@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"github.com/clD11/form3-payments/jsonapi"
+	"net/http"
+	"strings"
+)
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int
+	// Code and Detail come from the first error object of the response
+	Code    string
+	Detail  string
+	Pointer string
+	Errors  []jsonapi.Error
+}
+
+func newError(status int, body []byte) *Error {
+	e := &Error{StatusCode: status}
+	// the decode error is the first error object, the document holds all of them
+	doc, _ := jsonapi.DecodeDocument(bytes.NewReader(body), nil)
+	if doc == nil || len(doc.Errors) == 0 {
+		e.Detail = strings.TrimSpace(string(body))
+		if e.Detail == "" {
+			e.Detail = http.StatusText(status)
+		}
+		return e
+	}
+
+	e.Errors = doc.Errors
+	e.Code = doc.Errors[0].Code
+	e.Detail = doc.Errors[0].Detail
+	if doc.Errors[0].Source != nil {
+		e.Pointer = doc.Errors[0].Source.Pointer
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return http.StatusText(e.StatusCode) + ": " + e.Detail
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func statusOf(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether the payment does not exist
+func IsNotFound(err error) bool {
+	return statusOf(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether the request conflicts with a stored payment, such as creating a
+// payment whose ID is taken
+func IsConflict(err error) bool {
+	return statusOf(err) == http.StatusConflict
+}
+
+// IsInvalid reports whether the server rejected the request content
+func IsInvalid(err error) bool {
+	status := statusOf(err)
+	return status == http.StatusBadRequest || status == http.StatusUnprocessableEntity
+}
+
+// IsRateLimited reports whether the request was still rate limited after retrying
+func IsRateLimited(err error) bool {
+	return statusOf(err) == http.StatusTooManyRequests
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"github.com/clD11/form3-payments/model"
+)
+
+// Iterator walks every payment a page at a time following the next links
+//
+//	it := c.Payments(ctx, client.ListOptions{})
+//	for it.Next() {
+//		process(it.Payment())
+//	}
+//	return it.Err()
+type Iterator struct {
+	client  *Client
+	ctx     context.Context
+	next    string
+	page    []model.Payment
+	index   int
+	current model.Payment
+	err     error
+}
+
+// Next fetches the next page when needed and reports whether there is another payment
+func (it *Iterator) Next() bool {
+	for it.index >= len(it.page) {
+		if it.err != nil || it.next == "" {
+			return false
+		}
+		page, err := it.client.list(it.ctx, it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index, it.next = page.Payments, 0, page.next
+	}
+	it.current = it.page[it.index]
+	it.index++
+	return true
+}
+
+// Payment returns the payment Next moved to
+func (it *Iterator) Payment() model.Payment {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration
+func (it *Iterator) Err() error {
+	return it.err
+}
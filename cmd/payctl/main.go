@@ -0,0 +1,383 @@
+// Command payctl operates a running payments service
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/clD11/form3-payments/client"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/paymentcsv"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const usage = `usage: payctl [-profile name] [-url url] [-o table|json|yaml] <command> [arguments]
+
+commands:
+  get {id}                                print a payment
+  list [-filter name=value]... [-limit n] print payments, optionally filtered
+  create -f {file}                        create the payment in a JSON file, - reads stdin
+  update -f {file}                        replace a payment with the one in a JSON file
+  delete {id}                             delete a payment
+  import {file}                           create every payment in a seeddata.json style file
+  export -format csv|json [-filter ...]   write every payment, optionally filtered
+
+Profiles are read from $PAYCTL_CONFIG_DIR/{name}.json, by default ~/.payctl/default.json:
+  {"url": "https://payments.example.com", "output": "yaml", "timeout": "10s", "retries": 3}
+`
+
+var commands = map[string]func(*environment, []string) error{
+	"get":    get,
+	"list":   list,
+	"create": create,
+	"update": update,
+	"delete": remove,
+	"import": importPayments,
+	"export": export,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "payctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	env := &environment{profile: defaultProfile, stdout: stdout, stderr: stderr}
+	if profile := os.Getenv("PAYCTL_PROFILE"); profile != "" {
+		env.profile = profile
+	}
+
+	flags := env.flagSet("payctl")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no command given")
+	}
+
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", flags.Arg(0))
+	}
+	return command(env, flags.Args()[1:])
+}
+
+// environment holds the options shared by every command, which may be given before or after the
+// command name, and the client built from the selected profile
+type environment struct {
+	profile string
+	url     string
+	output  string
+	stdout  io.Writer
+	stderr  io.Writer
+	client  *client.Client
+	ctx     context.Context
+}
+
+func (env *environment) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.Usage = func() { fmt.Fprint(env.stderr, usage) }
+	flags.StringVar(&env.profile, "profile", env.profile, "profile to read the configuration from")
+	flags.StringVar(&env.url, "url", env.url, "base URL of the payments service, overrides the profile")
+	flags.StringVar(&env.output, "o", env.output, "output format: table, json or yaml")
+	return flags
+}
+
+// connect loads the profile, applies the command line overrides and builds the client
+func (env *environment) connect() error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	profile, err := loadProfile(dir, env.profile)
+	if err != nil {
+		return err
+	}
+	if env.url == "" {
+		env.url = profile.URL
+	}
+	if env.output == "" {
+		env.output = profile.Output
+	}
+
+	timeout, _ := time.ParseDuration(profile.Timeout)
+	options := []client.Option{client.WithHTTPClient(&http.Client{Timeout: timeout})}
+	if profile.Retries != nil {
+		options = append(options, client.WithRetries(*profile.Retries, 200*time.Millisecond))
+	}
+	env.client = client.New(env.url, options...)
+	env.ctx = context.Background()
+	return nil
+}
+
+func (env *environment) print(payments []model.Payment, single bool) error {
+	return printPayments(env.stdout, env.output, payments, single)
+}
+
+// filters collects repeated -filter name=value flags
+type filters map[string]string
+
+func (f filters) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, value := range f {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f filters) Set(pair string) error {
+	parts := strings.SplitN(pair, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("filter %q must be name=value", pair)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// get {id}
+func get(env *environment, args []string) error {
+	flags := env.flagSet("get")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	id, err := idArgument(flags)
+	if err != nil {
+		return err
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	payment, err := env.client.Get(env.ctx, id)
+	if err != nil {
+		return err
+	}
+	return env.print([]model.Payment{payment}, true)
+}
+
+// list [-filter name=value]... [-limit n] [-page-size n]
+func list(env *environment, args []string) error {
+	flags := env.flagSet("list")
+	filter := filters{}
+	flags.Var(filter, "filter", "name=value to match, may be repeated")
+	limit := flags.Int("limit", 0, "stop after this many payments, 0 lists every payment")
+	pageSize := flags.Int("page-size", 0, "payments fetched per request")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	payments, err := env.fetch(client.ListOptions{PageSize: *pageSize, Filters: filter}, *limit)
+	if err != nil {
+		return err
+	}
+	return env.print(payments, false)
+}
+
+func (env *environment) fetch(options client.ListOptions, limit int) ([]model.Payment, error) {
+	payments := []model.Payment{}
+	it := env.client.Payments(env.ctx, options)
+	for (limit == 0 || len(payments) < limit) && it.Next() {
+		payments = append(payments, it.Payment())
+	}
+	return payments, it.Err()
+}
+
+// create -f {file}
+func create(env *environment, args []string) error {
+	flags := env.flagSet("create")
+	file := flags.String("f", "", "JSON file holding the payment, - reads stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	payment, err := readPayment(*file)
+	if err != nil {
+		return err
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	created, err := env.client.Create(env.ctx, payment)
+	if err != nil {
+		return err
+	}
+	return env.print([]model.Payment{created}, true)
+}
+
+// update -f {file}
+func update(env *environment, args []string) error {
+	flags := env.flagSet("update")
+	file := flags.String("f", "", "JSON file holding the payment, - reads stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	payment, err := readPayment(*file)
+	if err != nil {
+		return err
+	}
+	if uuid.Equal(payment.ID, uuid.Nil) {
+		return errors.New("the payment to update must have an id")
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	updated, err := env.client.Update(env.ctx, payment)
+	if err != nil {
+		return err
+	}
+	return env.print([]model.Payment{updated}, true)
+}
+
+// delete {id}
+func remove(env *environment, args []string) error {
+	flags := env.flagSet("delete")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	id, err := idArgument(flags)
+	if err != nil {
+		return err
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	if err := env.client.Delete(env.ctx, id); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stdout, "deleted %s\n", id)
+	return nil
+}
+
+// import {file} creates every payment in the file, payments that already exist are skipped so a
+// file can be imported again after a failure
+func importPayments(env *environment, args []string) error {
+	flags := env.flagSet("import")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: import {file}")
+	}
+	var payments []model.Payment
+	if err := readJSON(flags.Arg(0), &payments); err != nil {
+		return err
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	created, skipped, failed := 0, 0, 0
+	for _, payment := range payments {
+		_, err := env.client.Create(env.ctx, payment)
+		switch {
+		case err == nil:
+			created++
+		case client.IsConflict(err):
+			skipped++
+		default:
+			failed++
+			fmt.Fprintf(env.stderr, "payment %s: %s\n", payment.ID, err)
+		}
+	}
+
+	fmt.Fprintf(env.stdout, "created %d, skipped %d existing, failed %d\n", created, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d payments could not be imported", failed)
+	}
+	return nil
+}
+
+// export -format csv|json [-filter name=value]... [-out file]
+func export(env *environment, args []string) error {
+	flags := env.flagSet("export")
+	format := flags.String("format", "csv", "csv or json")
+	filter := filters{}
+	flags.Var(filter, "filter", "name=value to match, may be repeated")
+	out := flags.String("out", "", "file to write instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown export format %q, use csv or json", *format)
+	}
+	if err := env.connect(); err != nil {
+		return err
+	}
+
+	payments, err := env.fetch(client.ListOptions{PageSize: 1000, Filters: filter}, 0)
+	if err != nil {
+		return err
+	}
+
+	w := env.stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "csv" {
+		return paymentcsv.Write(w, payments)
+	}
+	return printPayments(w, "json", payments, false)
+}
+
+func idArgument(flags *flag.FlagSet) (uuid.UUID, error) {
+	if flags.NArg() != 1 {
+		return uuid.Nil, fmt.Errorf("usage: %s {id}", flags.Name())
+	}
+	id, err := uuid.FromString(flags.Arg(0))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid payment ID: %s", err)
+	}
+	return id, nil
+}
+
+func readPayment(path string) (model.Payment, error) {
+	var payment model.Payment
+	if path == "" {
+		return payment, errors.New("a payment file must be given with -f")
+	}
+	err := readJSON(path, &payment)
+	return payment, err
+}
+
+func readJSON(path string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("could not read %s: %s", path, err)
+	}
+	return nil
+}
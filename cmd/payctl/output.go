@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"io"
+	"text/tabwriter"
+)
+
+var outputFormats = []string{"table", "json", "yaml"}
+
+// printPayments writes payments in the chosen output format, a single payment is printed as an
+// object rather than a list in JSON and YAML
+func printPayments(w io.Writer, format string, payments []model.Payment, single bool) error {
+	var value interface{} = payments
+	if single && len(payments) == 1 {
+		value = payments[0]
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "yaml":
+		data, err := marshalYAML(value)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "table":
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tORGANISATION\tAMOUNT\tCURRENCY\tSCHEME\tTYPE\tPROCESSING DATE\tREFERENCE")
+		for _, p := range payments {
+			a := p.Attributes
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.ID, p.OrganisationID, a.Amount, a.Currency,
+				a.PaymentScheme, a.PaymentType, a.ProcessingDate, a.Reference)
+		}
+		return table.Flush()
+	}
+	return fmt.Errorf("unknown output format %q, use one of %v", format, outputFormats)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarshalYAMLShouldQuoteAmbiguousStrings(t *testing.T) {
+	value := map[string]interface{}{
+		"amount":  "100.21",
+		"name":    "W Owens",
+		"charges": []interface{}{map[string]interface{}{"amount": "5.00", "currency": "GBP"}},
+		"flag":    "yes",
+		"empty":   []interface{}{},
+		"version": 0,
+	}
+
+	data, err := marshalYAML(value)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `amount: "100.21"
+charges:
+  - amount: "5.00"
+    currency: GBP
+empty: []
+flag: "yes"
+name: W Owens
+version: 0
+`, string(data))
+}
+
+func TestLoadProfileShouldFallBackOnlyForDefaultProfile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "payctl")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "staging.json"), []byte(`{"url":"https://staging.example.com","output":"yaml"}`), 0600)
+
+	staging, err := loadProfile(dir, "staging")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://staging.example.com", staging.URL)
+	assert.Equal(t, "yaml", staging.Output)
+	assert.Equal(t, "30s", staging.Timeout)
+
+	local, err := loadProfile(dir, defaultProfile)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080", local.URL)
+
+	_, err = loadProfile(dir, "production")
+	assert.Error(t, err)
+}
+
+func TestListShouldSendFiltersAndPrintTable(t *testing.T) {
+	payment := model.Payment{ID: uuid.NewV4(), Type: jsonapi.PaymentType, Attributes: model.Attributes{Amount: "10.00", Currency: "GBP"}}
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("filter[currency]")
+		body, _ := json.Marshal(jsonapi.NewPaymentsDocument([]model.Payment{payment}, r.URL.RequestURI()))
+		w.Header().Set("Content-Type", jsonapi.MediaType)
+		w.Write(body)
+	}))
+	defer server.Close()
+	os.Setenv("PAYCTL_CONFIG_DIR", os.TempDir())
+	defer os.Unsetenv("PAYCTL_CONFIG_DIR")
+
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-url", server.URL, "list", "-filter", "currency=GBP"}, &stdout, &stderr)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "GBP", query)
+	assert.Contains(t, stdout.String(), "ID")
+	assert.Contains(t, stdout.String(), payment.ID.String())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultProfile = "default"
+
+// Profile is the configuration for one environment, read from {name}.json in the config directory
+type Profile struct {
+	URL     string `json:"url"`
+	Output  string `json:"output"`
+	Timeout string `json:"timeout"`
+	Retries *int   `json:"retries"`
+}
+
+// configDir is $PAYCTL_CONFIG_DIR or ~/.payctl
+func configDir() (string, error) {
+	if dir := os.Getenv("PAYCTL_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".payctl"), nil
+}
+
+// loadProfile reads the named profile. The default profile is optional and falls back to a local
+// instance, any other profile must exist.
+func loadProfile(dir, name string) (Profile, error) {
+	profile := Profile{URL: "http://localhost:8080", Output: "table", Timeout: "30s"}
+
+	file, err := os.Open(filepath.Join(dir, name+".json"))
+	if err != nil {
+		if os.IsNotExist(err) && name == defaultProfile {
+			return profile, nil
+		}
+		return profile, fmt.Errorf("could not read profile %q: %s", name, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&profile); err != nil {
+		return profile, fmt.Errorf("invalid profile %q: %s", name, err)
+	}
+	if _, err := time.ParseDuration(profile.Timeout); err != nil {
+		return profile, fmt.Errorf("invalid timeout in profile %q: %s", name, err)
+	}
+	return profile, nil
+}
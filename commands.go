@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/clD11/form3-payments/app"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/iso20022"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/seed"
+	uuid "github.com/satori/go.uuid"
+	"os"
+)
+
+// generateSeed writes synthetic payments as JSON without connecting to the database
+func generateSeed(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	count := flags.Int("count", 1000, "number of payments to generate")
+	randomSeed := flags.Int64("seed", 1, "the same seed always generates the same payments")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	generator := seed.NewGenerator(*randomSeed)
+	generated := 0
+	return seed.Encode(os.Stdout, func() (model.Payment, bool) {
+		if generated == *count {
+			return model.Payment{}, false
+		}
+		generated++
+		return generator.Next(), true
+	})
+}
+
+// seed {file} loads a file in the seeddata.json format, seed -generate {n} -seed {s} loads synthetic payments.
+// Payments that already exist are skipped so seeding can be repeated.
+func loadSeed(a *app.App, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	generate := flags.Int("generate", 0, "number of synthetic payments to load instead of a file")
+	randomSeed := flags.Int64("seed", 1, "the same seed always generates the same payments")
+	batchSize := flags.Int("batch", seed.DefaultBatchSize, "payments inserted per statement")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	loader := seed.NewLoader(a.DB, *batchSize)
+	switch {
+	case *generate > 0:
+		generator := seed.NewGenerator(*randomSeed)
+		for i := 0; i < *generate; i++ {
+			if err := loader.Add(generator.Next()); err != nil {
+				return err
+			}
+		}
+	case flags.NArg() == 1:
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := seed.Decode(file, loader.Add); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("usage: seed {file} | seed -generate {n} [-seed {s}]")
+	}
+	if err := loader.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("inserted %d, skipped %d existing\n", loader.Inserted, loader.Skipped)
+	return nil
+}
+
+func runCommand(a *app.App, name string, args []string) error {
+	switch name {
+	case "fxrates":
+		return importFxRates(a, args)
+	case "pain001":
+		return importPain001(a, args)
+	case "seed":
+		return loadSeed(a, args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// fxrates {file} stores the rates in a base_currency,quote_currency,rate,effective_at file
+func importFxRates(a *app.App, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: fxrates {file}")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rates, err := fx.ReadRates(file)
+	if err != nil {
+		return err
+	}
+	if err := fx.SaveRates(a.DB, rates); err != nil {
+		return err
+	}
+
+	fmt.Printf("stored %d rates\n", len(rates))
+	return nil
+}
+
+// pain001 -organisation {id} {file} creates the payments in a pain.001 file and prints the pain.002 report
+func importPain001(a *app.App, args []string) error {
+	flags := flag.NewFlagSet("pain001", flag.ContinueOnError)
+	organisation := flags.String("organisation", "", "organisation ID that owns the payments")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: pain001 -organisation {id} {file}")
+	}
+
+	organisationID, err := uuid.FromString(*organisation)
+	if err != nil {
+		return fmt.Errorf("invalid organisation ID: %s", err)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	doc, err := iso20022.ParsePain001(file)
+	if err != nil {
+		return err
+	}
+
+	report, err := a.ProcessPain001(context.Background(), doc, organisationID).Marshal()
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(report)
+	return err
+}
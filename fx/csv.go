@@ -0,0 +1,57 @@
+package fx
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"io"
+	"strings"
+	"time"
+)
+
+// rateColumns is the header of a rates file, effective_at is RFC 3339
+var rateColumns = []string{"base_currency", "quote_currency", "rate", "effective_at"}
+
+// ReadRates decodes a rates file. Unlike payment imports a single invalid row rejects the whole
+// file, so a partial set of rates is never loaded.
+func ReadRates(r io.Reader) ([]model.FxRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(rateColumns)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("rates file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range rateColumns {
+		if strings.TrimSpace(header[i]) != column {
+			return nil, fmt.Errorf("rates file header must be %s", strings.Join(rateColumns, ","))
+		}
+	}
+
+	var rates []model.FxRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		effectiveAt, err := time.Parse(time.RFC3339, strings.TrimSpace(record[3]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: effective_at %q is not an RFC 3339 time", line, record[3])
+		}
+		rate := model.FxRate{
+			BaseCurrency:  strings.TrimSpace(record[0]),
+			QuoteCurrency: strings.TrimSpace(record[1]),
+			Rate:          strings.TrimSpace(record[2]),
+			EffectiveAt:   effectiveAt,
+		}
+		if err := ValidateRate(rate); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		rates = append(rates, rate)
+	}
+}
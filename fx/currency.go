@@ -0,0 +1,15 @@
+package fx
+
+// minorUnits lists the ISO 4217 currencies that do not have two decimal places
+var minorUnits = map[string]int{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3,
+	"LYD": 3, "OMR": 3, "PYG": 0, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// MinorUnits is the number of decimal places amounts in the currency are rounded to
+func MinorUnits(currency string) int {
+	if places, ok := minorUnits[currency]; ok {
+		return places
+	}
+	return 2
+}
@@ -0,0 +1,71 @@
+package fx
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// Rounding says which way a conversion that falls between two minor units goes
+type Rounding int
+
+const (
+	HalfUp Rounding = iota
+	HalfEven
+	Down
+	Up
+)
+
+var roundingNames = []string{"half_up", "half_even", "down", "up"}
+
+func (r Rounding) String() string { return roundingNames[r] }
+
+// ParseRounding reads half_up, half_even, down or up, empty is half_up
+func ParseRounding(s string) (Rounding, error) {
+	if s == "" {
+		return HalfUp, nil
+	}
+	for i, name := range roundingNames {
+		if s == name {
+			return Rounding(i), nil
+		}
+	}
+	return HalfUp, fmt.Errorf("rounding %q must be one of half_up, half_even, down or up", s)
+}
+
+var decimalPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// Decimal reads an unsigned decimal string such as an amount or rate exactly, it is nil when s is
+// not one
+func Decimal(s string) *big.Rat {
+	if !decimalPattern.MatchString(s) {
+		return nil
+	}
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+// round rounds a non-negative x to places decimal places and formats it
+func round(x *big.Rat, places int, mode Rounding) string {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	scaled := new(big.Rat).Mul(x, new(big.Rat).SetInt(scale))
+
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		// compare the remainder with half the denominator
+		half := new(big.Int).Lsh(remainder, 1).Cmp(scaled.Denom())
+		var up bool
+		switch mode {
+		case HalfUp:
+			up = half >= 0
+		case HalfEven:
+			up = half > 0 || (half == 0 && quotient.Bit(0) == 1)
+		case Up:
+			up = true
+		}
+		if up {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return new(big.Rat).SetFrac(quotient, scale).FloatString(places)
+}
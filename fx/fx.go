@@ -0,0 +1,133 @@
+package fx
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg/orm"
+	"math/big"
+	"time"
+)
+
+// A payment's Fx block records the amount before conversion: amount in the payment currency times
+// exchange_rate is original_amount in original_currency. The rate is therefore the stored rate with
+// the payment currency as base and the original currency as quote.
+
+// Convert returns amount converted at rate, rounded to the minor units of the currency converted into
+func Convert(amount, rate, currency string, rounding Rounding) (string, error) {
+	a := Decimal(amount)
+	if a == nil {
+		return "", fmt.Errorf("amount %q is not a decimal", amount)
+	}
+	r := Decimal(rate)
+	if r == nil {
+		return "", fmt.Errorf("rate %q is not a decimal", rate)
+	}
+	return round(new(big.Rat).Mul(a, r), MinorUnits(currency), rounding), nil
+}
+
+// DefaultTolerance lets a payment's rate differ from the stored rate by half a percent
+const DefaultTolerance = 0.005
+
+// Policy says how conversions are rounded, how far the rate of a payment may be from the stored
+// rate as a fraction of the stored rate, and how long quotes last
+type Policy struct {
+	Rounding  Rounding
+	Tolerance float64
+	QuoteTTL  time.Duration
+}
+
+// Apply completes and checks the Fx block of a payment. A payment booked against a contract without
+// a rate takes the rate in effect at the time, and a missing original amount is converted from the
+// amount. A rate and original amount that are both supplied must agree to within one minor unit, and
+// the rate must be within tolerance of the stored rate when the pair has one. Errors other than
+// *attribute.Error come from the database.
+func (p Policy) Apply(db orm.DB, payment *model.Payment, at time.Time) error {
+	a := &payment.Attributes
+	fx := &a.Fx
+	if *fx == (model.Fx{}) {
+		return nil
+	}
+
+	stored := false
+	if fx.ExchangeRate == "" && fx.ContractReference != "" {
+		if fx.OriginalCurrency == "" {
+			return &attribute.Error{Code: "invalid_fx", Member: "fx/original_currency",
+				Message: "original_currency is required to book a payment against a contract"}
+		}
+		rate, err := FindRate(db, a.Currency, fx.OriginalCurrency, at)
+		if err == ErrNoRate {
+			return &attribute.Error{Code: "fx_rate_not_found", Member: "fx/exchange_rate",
+				Message: fmt.Sprintf("No %s/%s rate is in effect", a.Currency, fx.OriginalCurrency)}
+		}
+		if err != nil {
+			return err
+		}
+		fx.ExchangeRate = rate.Rate
+		stored = true
+	}
+	if fx.ExchangeRate == "" {
+		return nil
+	}
+
+	rate := Decimal(fx.ExchangeRate)
+	if rate == nil || rate.Sign() == 0 {
+		return &attribute.Error{Code: "invalid_fx", Member: "fx/exchange_rate",
+			Message: fmt.Sprintf("exchange_rate %q is not a positive decimal", fx.ExchangeRate)}
+	}
+	if fx.OriginalCurrency == "" {
+		return nil
+	}
+	converted, err := Convert(a.Amount, fx.ExchangeRate, fx.OriginalCurrency, p.Rounding)
+	if err != nil {
+		return &attribute.Error{Code: "invalid_fx", Member: "amount", Message: err.Error()}
+	}
+
+	if fx.OriginalAmount == "" {
+		fx.OriginalAmount = converted
+	} else if err := p.checkAmount(fx, a.Amount, converted); err != nil {
+		return err
+	}
+	if stored {
+		return nil
+	}
+	return p.checkRate(db, a.Currency, fx, rate, at)
+}
+
+// checkAmount allows the original amount to be less than one minor unit from the unrounded
+// conversion, since clients may round differently
+func (p Policy) checkAmount(fx *model.Fx, amount, converted string) error {
+	original := Decimal(fx.OriginalAmount)
+	if original == nil {
+		return &attribute.Error{Code: "invalid_fx", Member: "fx/original_amount",
+			Message: fmt.Sprintf("original_amount %q is not a decimal", fx.OriginalAmount)}
+	}
+	a := Decimal(amount)
+	rate := Decimal(fx.ExchangeRate)
+	expected := new(big.Rat).Mul(a, rate)
+	unit := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(MinorUnits(fx.OriginalCurrency))), nil))
+	if new(big.Rat).Abs(new(big.Rat).Sub(original, expected)).Cmp(unit) >= 0 {
+		return &attribute.Error{Code: "fx_amount_mismatch", Member: "fx/original_amount",
+			Message: fmt.Sprintf("original_amount %s is not amount converted at exchange_rate %s, expected %s",
+				fx.OriginalAmount, fx.ExchangeRate, converted)}
+	}
+	return nil
+}
+
+func (p Policy) checkRate(db orm.DB, currency string, fx *model.Fx, rate *big.Rat, at time.Time) error {
+	stored, err := FindRate(db, currency, fx.OriginalCurrency, at)
+	if err == ErrNoRate {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	expected := Decimal(stored.Rate)
+	tolerance := new(big.Rat).Mul(expected, new(big.Rat).SetFloat64(p.Tolerance))
+	if new(big.Rat).Abs(new(big.Rat).Sub(rate, expected)).Cmp(tolerance) > 0 {
+		return &attribute.Error{Code: "fx_rate_mismatch", Member: "fx/exchange_rate",
+			Message: fmt.Sprintf("exchange_rate %s is more than %g%% from the %s/%s rate %s",
+				fx.ExchangeRate, p.Tolerance*100, currency, fx.OriginalCurrency, stored.Rate)}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package fx
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertShouldRoundToMinorUnitsOfCurrency(t *testing.T) {
+	for _, c := range []struct {
+		amount, rate, currency string
+		rounding               Rounding
+		expected               string
+	}{
+		{"100.21", "2.00000", "USD", HalfUp, "200.42"},
+		{"10.05", "0.5", "EUR", HalfUp, "5.03"},
+		{"10.05", "0.5", "EUR", HalfEven, "5.02"},
+		{"10.07", "0.5", "EUR", HalfEven, "5.04"},
+		{"10.01", "0.5", "EUR", Down, "5.00"},
+		{"10.01", "0.5", "EUR", Up, "5.01"},
+		{"100.00", "187.456", "JPY", HalfUp, "18746"},
+		{"1.00", "0.3775", "KWD", HalfUp, "0.378"},
+	} {
+		converted, err := Convert(c.amount, c.rate, c.currency, c.rounding)
+
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, converted, "%s at %s %s", c.amount, c.rate, c.rounding)
+	}
+
+	_, err := Convert("-1.00", "2", "USD", HalfUp)
+	assert.EqualError(t, err, `amount "-1.00" is not a decimal`)
+}
+
+func TestParseRounding(t *testing.T) {
+	rounding, err := ParseRounding("half_even")
+	assert.NoError(t, err)
+	assert.Equal(t, HalfEven, rounding)
+
+	rounding, err = ParseRounding("")
+	assert.NoError(t, err)
+	assert.Equal(t, HalfUp, rounding)
+
+	_, err = ParseRounding("bankers")
+	assert.Error(t, err)
+}
+
+func TestCheckAmountShouldAllowLessThanOneMinorUnit(t *testing.T) {
+	policy := Policy{Rounding: HalfUp, Tolerance: DefaultTolerance}
+	fx := &model.Fx{ExchangeRate: "1.23456", OriginalAmount: "123.45", OriginalCurrency: "USD"}
+
+	// 100.00 at 1.23456 is 123.456
+	assert.NoError(t, policy.checkAmount(fx, "100.00", "123.46"))
+
+	fx.OriginalAmount = "123.46"
+	assert.NoError(t, policy.checkAmount(fx, "100.00", "123.46"))
+
+	fx.OriginalAmount = "123.44"
+	err := policy.checkAmount(fx, "100.00", "123.46")
+	assert.Equal(t, &attribute.Error{Code: "fx_amount_mismatch", Member: "fx/original_amount",
+		Message: "original_amount 123.44 is not amount converted at exchange_rate 1.23456, expected 123.46"}, err)
+}
+
+func TestReadRatesShouldDecodeFileOrRejectItWhole(t *testing.T) {
+	rates, err := ReadRates(strings.NewReader("base_currency,quote_currency,rate,effective_at\n" +
+		"GBP,USD,1.28150,2019-05-01T09:00:00Z\n" +
+		"GBP,EUR,1.15800,2019-05-01T10:00:00+01:00\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.FxRate{
+		{BaseCurrency: "GBP", QuoteCurrency: "USD", Rate: "1.28150", EffectiveAt: time.Date(2019, 5, 1, 9, 0, 0, 0, time.UTC)},
+		{BaseCurrency: "GBP", QuoteCurrency: "EUR", Rate: "1.15800", EffectiveAt: time.Date(2019, 5, 1, 10, 0, 0, 0, time.FixedZone("", 3600))},
+	}, rates)
+
+	for file, message := range map[string]string{
+		"":                            "rates file is empty",
+		"base,quote,rate,effective\n": "rates file header must be base_currency,quote_currency,rate,effective_at",
+		"base_currency,quote_currency,rate,effective_at\nGBP,USD,1.2,2019-05-01\n":           `line 2: effective_at "2019-05-01" is not an RFC 3339 time`,
+		"base_currency,quote_currency,rate,effective_at\nGBP,gbp,1.2,2019-05-01T09:00:00Z\n": `line 2: quote_currency "gbp" is not an ISO 4217 code`,
+		"base_currency,quote_currency,rate,effective_at\nGBP,GBP,1.2,2019-05-01T09:00:00Z\n": "line 2: base_currency and quote_currency must differ",
+		"base_currency,quote_currency,rate,effective_at\nGBP,USD,0,2019-05-01T09:00:00Z\n":   `line 2: rate "0" is not a positive decimal`,
+	} {
+		_, err := ReadRates(strings.NewReader(file))
+
+		assert.EqualError(t, err, message, file)
+	}
+}
+
+func TestSameValueShouldCompareDecimalsByValue(t *testing.T) {
+	assert.True(t, sameValue("10.5", "10.50", true))
+	assert.False(t, sameValue("10.51", "10.50", true))
+	assert.False(t, sameValue("", "10.50", true))
+	assert.False(t, sameValue("gbp", "GBP", false))
+}
+
+func TestNewContractReferenceShouldBeUnique(t *testing.T) {
+	first, err := newContractReference()
+	assert.NoError(t, err)
+	second, _ := newContractReference()
+
+	assert.Len(t, first, 19)
+	assert.True(t, strings.HasPrefix(first, "FXQ"))
+	assert.NotEqual(t, first, second)
+}
+
+func TestAmendShouldKeepQuotedConversion(t *testing.T) {
+	stored := model.Attributes{Amount: "100.21", Currency: "GBP",
+		Fx: model.Fx{ContractReference: "FXQ1", ExchangeRate: "1.25000", OriginalAmount: "125.26", OriginalCurrency: "USD"}}
+	policy := Policy{Tolerance: DefaultTolerance}
+
+	unchanged := &model.Payment{Attributes: stored}
+	assert.NoError(t, policy.Amend(nil, unchanged, stored, time.Now()))
+
+	changed := &model.Payment{Attributes: stored}
+	changed.Attributes.Currency = "EUR"
+	err := policy.Amend(nil, changed, stored, time.Now())
+	assert.Equal(t, &attribute.Error{Code: "fx_quote_booked", Member: "currency",
+		Message: "The payment was booked against quote FXQ1 so currency cannot change"}, err)
+
+	unquoted := model.Attributes{Amount: "100.21", Currency: "GBP"}
+	booking := &model.Payment{Attributes: unquoted}
+	booking.Attributes.Fx.ContractReference = "FXQ2"
+	err = policy.Amend(nil, booking, unquoted, time.Now())
+	assert.Equal(t, "fx/contract_reference", err.(*attribute.Error).Member)
+}
+
+func TestDecimalShouldOnlyReadUnsignedDecimals(t *testing.T) {
+	assert.Equal(t, big.NewRat(12345, 100), Decimal("123.45"))
+	for _, s := range []string{"", "-1.00", "1e3", "1.", ".5", "1,000.00"} {
+		assert.Nil(t, Decimal(s), s)
+	}
+}
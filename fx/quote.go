@@ -0,0 +1,173 @@
+package fx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"strings"
+	"time"
+)
+
+// DefaultQuoteTTL is how long a quote can be booked against
+const DefaultQuoteTTL = time.Minute
+
+// QuotePrefix starts the contract reference of every quote. Contract references without it name
+// contracts agreed outside the service, which are booked at the stored rate.
+const QuotePrefix = "FXQ"
+
+// IsQuote reports whether a contract reference names one of our quotes
+func IsQuote(contractReference string) bool {
+	return strings.HasPrefix(contractReference, QuotePrefix)
+}
+
+// NewQuote prices converting amount in currency into originalCurrency at the rate in effect now and
+// stores the quote so a payment can be booked against it until it expires
+func (p Policy) NewQuote(db orm.DB, amount, currency, originalCurrency string, now time.Time) (model.FxQuote, error) {
+	quote := model.FxQuote{Amount: amount, Currency: currency, OriginalCurrency: originalCurrency}
+	if a := Decimal(amount); a == nil || a.Sign() == 0 {
+		return quote, &attribute.Error{Code: "invalid_fx", Member: "amount", Message: fmt.Sprintf("amount %q is not a positive decimal", amount)}
+	}
+	if !currencyPattern.MatchString(currency) {
+		return quote, &attribute.Error{Code: "invalid_fx", Member: "currency", Message: fmt.Sprintf("currency %q is not an ISO 4217 code", currency)}
+	}
+	if !currencyPattern.MatchString(originalCurrency) || originalCurrency == currency {
+		return quote, &attribute.Error{Code: "invalid_fx", Member: "original_currency",
+			Message: fmt.Sprintf("original_currency %q is not an ISO 4217 code other than currency", originalCurrency)}
+	}
+
+	rate, err := FindRate(db, currency, originalCurrency, now)
+	if err == ErrNoRate {
+		return quote, &attribute.Error{Code: "fx_rate_not_found", Member: "original_currency",
+			Message: fmt.Sprintf("No %s/%s rate is in effect", currency, originalCurrency)}
+	}
+	if err != nil {
+		return quote, err
+	}
+	quote.ExchangeRate = rate.Rate
+	quote.OriginalAmount, _ = Convert(amount, rate.Rate, originalCurrency, p.Rounding)
+	ttl := p.QuoteTTL
+	if ttl <= 0 {
+		ttl = DefaultQuoteTTL
+	}
+	quote.ExpiresAt = now.Add(ttl).UTC()
+	if quote.ContractReference, err = newContractReference(); err != nil {
+		return quote, err
+	}
+	return quote, db.Insert(&quote)
+}
+
+func newContractReference() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return QuotePrefix + strings.ToUpper(hex.EncodeToString(b[:])), nil
+}
+
+// BookQuote uses up the quote named by the payment's contract reference and copies its rate and
+// original amount onto the payment. The quote must be unexpired, unused and for the payment's amount
+// and currencies, and any rate or original amount the payment already has must be the quoted one.
+// It locks the quote, so run it in the transaction that stores the payment.
+func BookQuote(db orm.DB, payment *model.Payment, now time.Time) error {
+	a := &payment.Attributes
+	fx := &a.Fx
+	quote := model.FxQuote{ContractReference: fx.ContractReference}
+	err := db.Model(&quote).WherePK().For("UPDATE").Select()
+	if err == pg.ErrNoRows {
+		return &attribute.Error{Code: "fx_quote_not_found", Member: "fx/contract_reference",
+			Message: fmt.Sprintf("No quote has contract reference %q", fx.ContractReference)}
+	}
+	if err != nil {
+		return err
+	}
+	if quote.PaymentID != nil {
+		return &attribute.Error{Code: "fx_quote_used", Member: "fx/contract_reference",
+			Message: fmt.Sprintf("Quote %s was booked by payment %s", quote.ContractReference, quote.PaymentID)}
+	}
+	if !now.Before(quote.ExpiresAt) {
+		return &attribute.Error{Code: "fx_quote_expired", Member: "fx/contract_reference",
+			Message: fmt.Sprintf("Quote %s expired at %s", quote.ContractReference, quote.ExpiresAt.UTC().Format(time.RFC3339))}
+	}
+
+	for _, member := range []struct {
+		name            string
+		actual, quoted  string
+		decimal, absent bool
+	}{
+		{"amount", a.Amount, quote.Amount, true, false},
+		{"currency", a.Currency, quote.Currency, false, false},
+		{"fx/original_currency", fx.OriginalCurrency, quote.OriginalCurrency, false, true},
+		{"fx/exchange_rate", fx.ExchangeRate, quote.ExchangeRate, true, true},
+		{"fx/original_amount", fx.OriginalAmount, quote.OriginalAmount, true, true},
+	} {
+		if member.absent && member.actual == "" {
+			continue
+		}
+		if !sameValue(member.actual, member.quoted, member.decimal) {
+			return &attribute.Error{Code: "fx_quote_mismatch", Member: member.name,
+				Message: fmt.Sprintf("%s %q is not the quoted %s", member.name, member.actual, member.quoted)}
+		}
+	}
+	fx.ExchangeRate = quote.ExchangeRate
+	fx.OriginalAmount = quote.OriginalAmount
+	fx.OriginalCurrency = quote.OriginalCurrency
+
+	id := payment.ID
+	quote.PaymentID = &id
+	_, err = db.Model(&quote).Column("payment_id").WherePK().Update()
+	return err
+}
+
+// sameValue compares decimals by value so 10.5 matches a quoted 10.50
+func sameValue(actual, quoted string, decimal bool) bool {
+	if !decimal {
+		return actual == quoted
+	}
+	a := Decimal(actual)
+	return a != nil && a.Cmp(Decimal(quoted)) == 0
+}
+
+// Book completes and checks the Fx block of a new payment. A payment whose contract reference names
+// a quote is booked against it, any other is checked by Apply.
+func (p Policy) Book(db orm.DB, payment *model.Payment, now time.Time) error {
+	if IsQuote(payment.Attributes.Fx.ContractReference) {
+		return BookQuote(db, payment, now)
+	}
+	return p.Apply(db, payment, now)
+}
+
+// Amend checks the Fx block of a payment being updated from its stored attributes. A quote is only
+// booked by creating a payment, and a payment booked against one keeps its quoted amount, currency and
+// conversion. Any other change to the conversion is checked by Apply.
+func (p Policy) Amend(db orm.DB, payment *model.Payment, stored model.Attributes, now time.Time) error {
+	a := payment.Attributes
+	for _, member := range []struct {
+		name            string
+		actual, current string
+	}{
+		{"amount", a.Amount, stored.Amount},
+		{"currency", a.Currency, stored.Currency},
+		{"fx/contract_reference", a.Fx.ContractReference, stored.Fx.ContractReference},
+		{"fx/exchange_rate", a.Fx.ExchangeRate, stored.Fx.ExchangeRate},
+		{"fx/original_amount", a.Fx.OriginalAmount, stored.Fx.OriginalAmount},
+		{"fx/original_currency", a.Fx.OriginalCurrency, stored.Fx.OriginalCurrency},
+	} {
+		if member.actual == member.current {
+			continue
+		}
+		if IsQuote(stored.Fx.ContractReference) {
+			return &attribute.Error{Code: "fx_quote_booked", Member: member.name,
+				Message: fmt.Sprintf("The payment was booked against quote %s so %s cannot change", stored.Fx.ContractReference, member.name)}
+		}
+		if IsQuote(a.Fx.ContractReference) {
+			return &attribute.Error{Code: "fx_quote_booked", Member: "fx/contract_reference",
+				Message: fmt.Sprintf("Quote %s can only be booked by creating a payment", a.Fx.ContractReference)}
+		}
+		return p.Apply(db, payment, now)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package fx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"regexp"
+	"time"
+)
+
+// ErrNoRate is returned when no rate for the pair has taken effect yet
+var ErrNoRate = errors.New("no rate for the currency pair")
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidateRate checks a rate before it is stored
+func ValidateRate(rate model.FxRate) error {
+	if !currencyPattern.MatchString(rate.BaseCurrency) {
+		return fmt.Errorf("base_currency %q is not an ISO 4217 code", rate.BaseCurrency)
+	}
+	if !currencyPattern.MatchString(rate.QuoteCurrency) {
+		return fmt.Errorf("quote_currency %q is not an ISO 4217 code", rate.QuoteCurrency)
+	}
+	if rate.BaseCurrency == rate.QuoteCurrency {
+		return errors.New("base_currency and quote_currency must differ")
+	}
+	if r := Decimal(rate.Rate); r == nil || r.Sign() == 0 {
+		return fmt.Errorf("rate %q is not a positive decimal", rate.Rate)
+	}
+	if rate.EffectiveAt.IsZero() {
+		return errors.New("effective_at is required")
+	}
+	return nil
+}
+
+// FindRate returns the rate converting base into quote that is in effect at the time
+func FindRate(db orm.DB, base, quote string, at time.Time) (model.FxRate, error) {
+	var rate model.FxRate
+	err := db.Model(&rate).
+		Where("base_currency = ?", base).
+		Where("quote_currency = ?", quote).
+		Where("effective_at <= ?", at).
+		Order("effective_at DESC").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return rate, ErrNoRate
+	}
+	return rate, err
+}
+
+// SaveRates stores the rates, replacing any already stored for the same pair and effective time
+func SaveRates(db orm.DB, rates []model.FxRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	for i := range rates {
+		rates[i].EffectiveAt = rates[i].EffectiveAt.UTC()
+	}
+	_, err := db.Model(&rates).
+		OnConflict("(base_currency, quote_currency, effective_at) DO UPDATE").
+		Set("rate = EXCLUDED.rate").
+		Insert()
+	return err
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/bacs"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"net/http"
+	"time"
+)
+
+// GET /v1/exports/bacs?processing_date={date}&serial={serial}
+func ExportBacs(db *pg.DB, serviceUserNumber string, w http.ResponseWriter, r *http.Request) {
+	// a missing service user number is our misconfiguration rather than a problem with the request
+	if err := bacs.ValidateServiceUserNumber(serviceUserNumber); err != nil {
+		logError(r, "Bacs exports are not configured", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not export Bacs payments")
+		return
+	}
+
+	payments := []model.Payment{}
+
+	query := db.Model(&payments).Where("attributes->>'payment_scheme' = ?", bacs.Scheme)
+	if date := r.URL.Query().Get("processing_date"); date != "" {
+		query = query.Where("attributes->>'processing_date' = ?", date)
+	}
+	if err := query.Select(); err != nil {
+		logError(r, "could not select Bacs payments", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get Bacs payments")
+		return
+	}
+
+	now := time.Now()
+	submission := bacs.Submission{
+		ServiceUserNumber: serviceUserNumber,
+		SerialNumber:      r.URL.Query().Get("serial"),
+		CreationDate:      now,
+	}
+	if submission.SerialNumber == "" {
+		submission.SerialNumber = now.Format("150405")
+	}
+
+	file, err := submission.Generate(payments)
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusUnprocessableEntity, "invalid_submission", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"bacs-"+submission.SerialNumber+".txt\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(file)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// bodyTooLargeError is returned by reads past the limit set by LimitBody
+type bodyTooLargeError struct {
+	max int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return "request body too large"
+}
+
+// LimitBody answers 413 Payload Too Large when the Content-Length is over max bytes, and cuts off
+// bodies of unknown length at max so reading them fails. Routes keyed by method and route template,
+// such as "POST /v1/payments/csv", have their own limit. It runs before anything reads the body.
+func LimitBody(max int64, routes map[string]int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := max
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					if routeLimit, ok := routes[r.Method+" "+template]; ok {
+						limit = routeLimit
+					}
+				}
+			}
+
+			if r.ContentLength > limit {
+				writeError(w, r, bodyTooLarge(limit))
+				return
+			}
+			if r.Body != nil {
+				r.Body = &limitedBody{ReadCloser: r.Body, max: limit, remaining: limit}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bodyTooLarge(max int64) *jsonapi.Error {
+	return jsonapi.NewError(http.StatusRequestEntityTooLarge, "body_too_large",
+		"Request body must be at most "+strconv.FormatInt(max, 10)+" bytes")
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	max       int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// a body of exactly the limit is allowed, only a further byte is too much
+		var extra [1]byte
+		if n, err := b.ReadCloser.Read(extra[:]); n == 0 {
+			return 0, err
+		}
+		return 0, &bodyTooLargeError{max: b.max}
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// readBody reads the whole request body, reporting bodies over the limit as 413
+func readBody(r *http.Request) ([]byte, *jsonapi.Error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if tooLarge, ok := err.(*bodyTooLargeError); ok {
+		return nil, bodyTooLarge(tooLarge.max)
+	}
+	if err != nil {
+		return nil, jsonapi.NewError(http.StatusBadRequest, "invalid_document", "Could not read request body")
+	}
+	return body, nil
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// GET /v1/calendars/{scheme}/next-business-day?currency={currency}&date={date}
+func GetNextBusinessDay(calendars *calendar.Calendars, w http.ResponseWriter, r *http.Request) {
+	scheme := mux.Vars(r)["scheme"]
+	if !calendars.Known(scheme) {
+		writeErrorResponse(w, r, http.StatusNotFound, "calendar_not_found", "No calendar for scheme "+scheme)
+		return
+	}
+
+	// without a date the next business day is the one after today where the scheme is
+	values := r.URL.Query()
+	date := calendars.Today(scheme, time.Now())
+	if raw := values.Get("date"); raw != "" {
+		parsed, err := time.Parse(calendar.DateLayout, raw)
+		if err != nil {
+			writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_date", "date must be in YYYY-MM-DD format").WithParameter("date"))
+			return
+		}
+		date = parsed
+	}
+
+	currency := values.Get("currency")
+	next, err := calendars.NextBusinessDay(scheme, currency, date)
+	if err != nil {
+		logError(r, "could not find business day", err, "payment_scheme", scheme, "currency", currency)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not find the next business day")
+		return
+	}
+	day := jsonapi.BusinessDay{PaymentScheme: scheme, Currency: currency, Date: next.Format(calendar.DateLayout)}
+	if cutOff, ok := calendars.CutOff(scheme, next); ok {
+		day.CutOff = &cutOff
+	}
+	writeResponse(w, http.StatusOK, jsonapi.NewBusinessDayDocument(day, r.URL.RequestURI()))
+}
+
+// applyCalendar rolls forward or rejects a processing date the payment's scheme is closed on
+func applyCalendar(calendars *calendar.Calendars, payment *model.Payment) (*calendar.Adjustment, *jsonapi.Error) {
+	adjustment, err := calendars.Apply(&payment.Attributes, time.Now())
+	if err == nil {
+		return adjustment, nil
+	}
+	return nil, attributeError(err.(*attribute.Error))
+}
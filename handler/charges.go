@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/charges"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	"net/http"
+)
+
+// POST /v1/payments/charges
+func PreviewCharges(schedule *charges.Schedule, table *routing.Table, w http.ResponseWriter, r *http.Request) {
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	var payment model.Payment
+	if apiErr := resource.ApplyTo(&payment); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	decision, apiErr := applyRouting(table, &payment)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	// the draft is priced as if its charges were absent, so clients can see what create would do
+	payment.Attributes.ChargesInformation = model.ChargesInformation{BearerCode: payment.Attributes.ChargesInformation.BearerCode}
+	rule, apiErr := applyCharges(schedule, &payment)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	name := ""
+	if rule != nil {
+		name = rule.Name
+	}
+	document := jsonapi.NewChargesPreviewDocument(payment.Attributes.ChargesInformation, name)
+	if decision != nil {
+		document.Meta["routing"] = decision
+	}
+	writeResponse(w, http.StatusOK, document)
+}
+
+// applyCharges populates the charges of a payment that has none from the fee schedule
+func applyCharges(schedule *charges.Schedule, payment *model.Payment) (*charges.Rule, *jsonapi.Error) {
+	if !charges.Absent(payment.Attributes.ChargesInformation) {
+		return nil, nil
+	}
+	calculated, rule, err := schedule.Calculate(payment.Attributes)
+	if err != nil {
+		return nil, attributeError(err.(*attribute.Error))
+	}
+	if rule != nil {
+		payment.Attributes.ChargesInformation = calculated
+	}
+	return rule, nil
+}
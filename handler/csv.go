@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/paymentcsv"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/go-pg/pg"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"strings"
+)
+
+type csvImportError struct {
+	Row int `json:"row"`
+	paymentcsv.FieldError
+}
+
+// POST /v1/payments/csv?mapping={header:column,...}
+func ImportCSV(db *pg.DB, preparer prepare.Preparer, w http.ResponseWriter, r *http.Request) {
+	mapping, err := paymentcsv.ParseMapping(r.URL.Query().Get("mapping"))
+	if err != nil {
+		writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_mapping", err.Error()).WithParameter("mapping"))
+		return
+	}
+
+	body, apiErr := readBody(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	rows, err := paymentcsv.Read(bytes.NewReader(body), mapping)
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_document", err.Error())
+		return
+	}
+
+	created := []jsonapi.ResourceIdentifier{}
+	rejected := []csvImportError{}
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			for _, fieldError := range row.Errors {
+				rejected = append(rejected, csvImportError{Row: row.Line, FieldError: fieldError})
+			}
+			continue
+		}
+
+		payment := row.Payment
+		if uuid.Equal(payment.ID, uuid.Nil) {
+			payment.ID = uuid.NewV4()
+		}
+		if payment.Type == "" {
+			payment.Type = "Payment"
+		}
+		if err := payment.Validate(); err != nil {
+			rejected = append(rejected, rowError(row.Line, err.Error()))
+			continue
+		}
+		if err := storePayment(db, preparer, &payment); err != nil {
+			if err == errPaymentExists {
+				rejected = append(rejected, rowError(row.Line, "Payment already exists"))
+				continue
+			}
+			if apiErr, ok := err.(*jsonapi.Error); ok {
+				rejected = append(rejected, csvImportError{Row: row.Line, FieldError: paymentcsv.FieldError{
+					Column: errorMember(apiErr), Message: apiErr.Detail}})
+				continue
+			}
+			logError(r, "could not insert payment", err, "payment_id", payment.ID, "organisation_id", payment.OrganisationID, "row", row.Line)
+			rejected = append(rejected, rowError(row.Line, "Could not insert payment"))
+			continue
+		}
+		recordCreated(payment)
+		created = append(created, jsonapi.ResourceIdentifier{Type: jsonapi.PaymentType, ID: payment.ID.String()})
+	}
+
+	// primary data identifies the created payments, rows that were rejected are described in meta
+	status := http.StatusCreated
+	if len(rejected) > 0 {
+		status = http.StatusOK
+	}
+	writeResponse(w, status, jsonapi.Document{
+		Data:    created,
+		Meta:    map[string]interface{}{"rejected": rejected},
+		JSONAPI: &jsonapi.Implementation{Version: jsonapi.Version},
+	})
+}
+
+func rowError(line int, message string) csvImportError {
+	return csvImportError{Row: line, FieldError: paymentcsv.FieldError{Message: message}}
+}
+
+func acceptsCSV(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), paymentcsv.ContentType)
+}
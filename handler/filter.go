@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/go-pg/pg/orm"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// paymentFilters maps the filter[...] query parameters of GET /v1/payments to the column they match
+var paymentFilters = map[string]string{
+	"organisation_id":     "organisation_id",
+	"currency":            "attributes->>'currency'",
+	"payment_scheme":      "attributes->>'payment_scheme'",
+	"payment_type":        "attributes->>'payment_type'",
+	"processing_date":     "attributes->>'processing_date'",
+	"scheme_payment_type": "attributes->>'scheme_payment_type'",
+}
+
+// filterNames lists the filters GET /v1/payments accepts
+func filterNames() []string {
+	names := make([]string, 0, len(paymentFilters))
+	for name := range paymentFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyFilters narrows the query to payments matching every filter[name]=value parameter
+func applyFilters(query *orm.Query, values url.Values) (*orm.Query, *jsonapi.Error) {
+	params := make([]string, 0, len(values))
+	for param := range values {
+		if strings.HasPrefix(param, "filter[") {
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+
+	for _, param := range params {
+		name := strings.TrimSuffix(strings.TrimPrefix(param, "filter["), "]")
+		column, ok := paymentFilters[name]
+		if !ok || !strings.HasSuffix(param, "]") {
+			return nil, jsonapi.NewError(http.StatusBadRequest, "invalid_filter",
+				"Payments can be filtered by "+strings.Join(filterNames(), ", ")).WithParameter(param)
+		}
+		value := values.Get(param)
+		if name == "organisation_id" {
+			if _, err := uuid.FromString(value); err != nil {
+				return nil, jsonapi.NewError(http.StatusBadRequest, "invalid_id", "Invalid organisation ID").WithParameter(param)
+			}
+		}
+		query = query.Where(column+" = ?", value)
+	}
+	return query, nil
+}
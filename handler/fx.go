@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rateFilters maps the filter[...] query parameters of GET /v1/fx/rates to the column they match
+var rateFilters = map[string]string{
+	"base_currency":  "base_currency",
+	"quote_currency": "quote_currency",
+}
+
+// GET /v1/fx/rates?filter[{name}]={value}&at={time}&page[number]={n}&page[size]={n}
+func GetFxRates(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	rates := []model.FxRate{}
+	query := db.Model(&rates).Order("base_currency", "quote_currency", "effective_at DESC")
+
+	values := r.URL.Query()
+	for param := range values {
+		if !strings.HasPrefix(param, "filter[") {
+			continue
+		}
+		column, ok := rateFilters[strings.TrimSuffix(strings.TrimPrefix(param, "filter["), "]")]
+		if !ok || !strings.HasSuffix(param, "]") {
+			writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_filter",
+				"Rates can be filtered by base_currency, quote_currency").WithParameter(param))
+			return
+		}
+		query = query.Where(column+" = ?", values.Get(param))
+	}
+	// at narrows the list to the rate of each pair in effect at the time
+	if raw := values.Get("at"); raw != "" {
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_time", "at must be an RFC 3339 time").WithParameter("at"))
+			return
+		}
+		query = query.DistinctOn("base_currency, quote_currency").Where("effective_at <= ?", at)
+	}
+
+	pagination, apiErr := parsePage(values)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	total, err := query.Limit(pagination.size).Offset(pagination.offset()).SelectAndCount()
+	if err != nil {
+		logError(r, "could not select rates", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get rates")
+		return
+	}
+
+	document := jsonapi.NewFxRatesDocument(rates, r.URL.RequestURI())
+	document.Links = pagination.links(r.URL, total)
+	document.Meta["total"] = total
+	writeResponse(w, http.StatusOK, document)
+}
+
+// POST /v1/fx/rates
+func CreateFxRate(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	rate, apiErr := resource.FxRate()
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if err := fx.ValidateRate(rate); err != nil {
+		writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_rate", err.Error()).WithPointer("/data/attributes"))
+		return
+	}
+
+	rates := []model.FxRate{rate}
+	if err := fx.SaveRates(db, rates); err != nil {
+		logError(r, "could not save rate", err, "base_currency", rate.BaseCurrency, "quote_currency", rate.QuoteCurrency)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not save rate")
+		return
+	}
+	writeResponse(w, http.StatusCreated, jsonapi.Document{
+		Data:    jsonapi.NewFxRateResource(rates[0]),
+		JSONAPI: &jsonapi.Implementation{Version: jsonapi.Version},
+	})
+}
+
+// POST /v1/fx/rates/csv
+func ImportFxRates(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	body, apiErr := readBody(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	rates, err := fx.ReadRates(bytes.NewReader(body))
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_document", err.Error())
+		return
+	}
+	if err := fx.SaveRates(db, rates); err != nil {
+		logError(r, "could not save rates", err, "rates", len(rates))
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not save rates")
+		return
+	}
+	writeResponse(w, http.StatusCreated, jsonapi.NewFxRatesDocument(rates, jsonapi.FxRatesLink))
+}
+
+// POST /v1/fx/quotes
+func CreateFxQuote(db *pg.DB, policy fx.Policy, w http.ResponseWriter, r *http.Request) {
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	request, apiErr := resource.QuoteRequest()
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	quote, err := policy.NewQuote(db, request.Amount, request.Currency, request.OriginalCurrency, time.Now())
+	if attrErr, ok := err.(*attribute.Error); ok {
+		writeError(w, r, attributeError(attrErr))
+		return
+	}
+	if err != nil {
+		logError(r, "could not quote", err, "currency", request.Currency, "original_currency", request.OriginalCurrency)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not quote")
+		return
+	}
+	writeResponse(w, http.StatusCreated, jsonapi.Document{
+		Data:    jsonapi.NewFxQuoteResource(quote),
+		JSONAPI: &jsonapi.Implementation{Version: jsonapi.Version},
+	})
+}
+
+// amendFx checks the Fx block of a payment updated from stored against its quote or the stored
+// rates, reporting an inconsistent block with a pointer to the member at fault
+func amendFx(db orm.DB, policy fx.Policy, r *http.Request, payment *model.Payment, stored model.Attributes) *jsonapi.Error {
+	err := policy.Amend(db, payment, stored, time.Now())
+	if err == nil {
+		return nil
+	}
+	if attrErr, ok := err.(*attribute.Error); ok {
+		return attributeError(attrErr)
+	}
+	logError(r, "could not apply fx rate", err, "payment_id", payment.ID, "organisation_id", payment.OrganisationID)
+	return jsonapi.NewError(http.StatusInternalServerError, "internal_error", "Could not check the exchange rate")
+}
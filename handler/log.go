@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/logging"
+	"net/http"
+)
+
+// logError records the underlying error behind a failed request with the request's logger, the
+// response itself only carries a generic message
+func logError(r *http.Request, message string, err error, keyValues ...interface{}) {
+	logging.FromContext(r.Context()).Error(message, append(keyValues, "error", err)...)
+}
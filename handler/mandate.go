@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/mandate"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+// POST /v1/mandates
+func CreateMandate(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	var m model.Mandate
+	if apiErr := resource.ApplyToMandate(&m); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if uuid.Equal(m.ID, uuid.Nil) {
+		m.ID = uuid.NewV4()
+	}
+	if uuid.Equal(m.OrganisationID, uuid.Nil) {
+		writeError(w, r, jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_mandate",
+			"A mandate must have an organisation relationship").WithPointer("/data/relationships"))
+		return
+	}
+	now := time.Now().UTC()
+	if err := mandate.Validate(&m, now); err != nil {
+		writeError(w, r, attributeError(err.(*attribute.Error)))
+		return
+	}
+	m.Status = mandate.Active
+	m.CreatedAt = now
+	m.UpdatedAt = now
+
+	// the mandate and its setup event are stored together
+	err := db.RunInTransaction(func(tx *pg.Tx) error {
+		exists, err := tx.Model((*model.Mandate)(nil)).
+			Where("id = ?", m.ID).
+			WhereOr("organisation_id = ? AND reference = ?", m.OrganisationID, m.Reference).
+			Exists()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return mandateExists()
+		}
+		if err := tx.Insert(&m); err != nil {
+			return err
+		}
+		return mandate.Record(tx, m, mandate.Setup, now)
+	})
+	if apiErr, ok := err.(*jsonapi.Error); ok {
+		writeError(w, r, apiErr)
+		return
+	}
+	// a concurrent request took the reference after the check, the unique index turned this one away
+	if pgErr, ok := err.(pg.Error); ok && pgErr.Field('C') == uniqueViolation {
+		writeError(w, r, mandateExists())
+		return
+	}
+	if err != nil {
+		logError(r, "could not insert mandate", err, "mandate_id", m.ID, "organisation_id", m.OrganisationID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not insert mandate")
+		return
+	}
+
+	w.Header().Set("Location", jsonapi.MandateLink(m.ID))
+	writeResponse(w, http.StatusCreated, jsonapi.NewMandateDocument(m))
+}
+
+// GET /v1/mandates/{id}
+func GetMandate(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	m, ok := selectMandate(db, w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, http.StatusOK, jsonapi.NewMandateDocument(m))
+}
+
+// PATCH /v1/mandates/{id}
+func UpdateMandate(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
+		return
+	}
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if resource.ID != id.String() {
+		writeError(w, r, jsonapi.NewError(http.StatusConflict, "id_mismatch",
+			"Could not update mandate - request id does not match update mandate").WithPointer("/data/id"))
+		return
+	}
+
+	// the mandate is locked so debits checked against it wait for the change
+	m := model.Mandate{ID: id}
+	err = db.RunInTransaction(func(tx *pg.Tx) error {
+		if err := tx.Model(&m).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+		event, apiErr := amendMandate(&m, resource, time.Now().UTC())
+		if apiErr != nil {
+			return apiErr
+		}
+		if err := tx.Update(&m); err != nil {
+			return err
+		}
+		return mandate.Record(tx, m, event, m.UpdatedAt)
+	})
+	if apiErr, ok := err.(*jsonapi.Error); ok {
+		writeError(w, r, apiErr)
+		return
+	}
+	if err == pg.ErrNoRows {
+		writeErrorResponse(w, r, http.StatusNotFound, "mandate_not_found", "Mandate not found")
+		return
+	}
+	if err != nil {
+		logError(r, "could not update mandate", err, "mandate_id", id)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not update mandate")
+		return
+	}
+	writeResponse(w, http.StatusOK, jsonapi.NewMandateDocument(m))
+}
+
+// GET /v1/mandates/{id}/events
+func GetMandateEvents(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	m, ok := selectMandate(db, w, r)
+	if !ok {
+		return
+	}
+	events := []model.MandateEvent{}
+	if err := db.Model(&events).Where("mandate_id = ?", m.ID).Order("sequence").Select(); err != nil {
+		logError(r, "could not select mandate events", err, "mandate_id", m.ID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get mandate events")
+		return
+	}
+	writeResponse(w, http.StatusOK, jsonapi.NewMandateEventsDocument(events, r.URL.RequestURI()))
+}
+
+// selectMandate finds the mandate in the URL, writing the error response when it cannot
+func selectMandate(db *pg.DB, w http.ResponseWriter, r *http.Request) (model.Mandate, bool) {
+	id, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
+		return model.Mandate{}, false
+	}
+	m := model.Mandate{ID: id}
+	if err := db.Select(&m); err != nil {
+		if err == pg.ErrNoRows {
+			writeErrorResponse(w, r, http.StatusNotFound, "mandate_not_found", "Mandate not found")
+			return m, false
+		}
+		logError(r, "could not select mandate", err, "mandate_id", id)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get mandate")
+		return m, false
+	}
+	return m, true
+}
+
+// amendMandate applies a PATCH to a stored mandate and returns the event it is. Setting the status
+// to cancelled cancels it, any other change amends it. The reference cannot change since debits
+// name the mandate by it.
+func amendMandate(m *model.Mandate, resource *jsonapi.Resource, now time.Time) (string, *jsonapi.Error) {
+	if m.Status == mandate.Cancelled {
+		return "", jsonapi.NewError(http.StatusConflict, "mandate_closed", "Mandate is cancelled and cannot be changed")
+	}
+	stored := *m
+	if apiErr := resource.ApplyToMandate(m); apiErr != nil {
+		return "", apiErr
+	}
+	m.OrganisationID = stored.OrganisationID
+	m.CreatedAt = stored.CreatedAt
+	m.UpdatedAt = now
+	if m.Reference != stored.Reference {
+		return "", jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_mandate",
+			"reference cannot be changed, set up a new mandate instead").WithPointer("/data/attributes/reference")
+	}
+	if err := mandate.Validate(m, now); err != nil {
+		return "", attributeError(err.(*attribute.Error))
+	}
+
+	switch m.Status {
+	case mandate.Active:
+		return mandate.Amend, nil
+	case mandate.Cancelled:
+		return mandate.Cancel, nil
+	}
+	return "", jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_mandate",
+		fmt.Sprintf("status %q must be %s or %s", m.Status, mandate.Active, mandate.Cancelled)).WithPointer("/data/attributes/status")
+}
+
+// uniqueViolation is the SQLSTATE Postgres reports when an insert breaks a unique index
+const uniqueViolation = "23505"
+
+func mandateExists() *jsonapi.Error {
+	return jsonapi.NewError(http.StatusConflict, "mandate_exists",
+		"A mandate with the ID or the organisation's reference already exists").WithPointer("/data")
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/metrics"
+	"github.com/clD11/form3-payments/model"
+	"strconv"
+)
+
+var (
+	paymentsCreated = metrics.NewCounterVec("payments_created_total",
+		"Payments created by payment scheme and currency", "scheme", "currency")
+	amountCreated = metrics.NewCounterVec("payments_created_amount_total",
+		"Sum of the amounts of created payments by currency", "currency")
+)
+
+// recordCreated counts a payment once it has been stored
+func recordCreated(p model.Payment) {
+	paymentsCreated.Inc(p.Attributes.PaymentScheme, p.Attributes.Currency)
+	if amount, err := strconv.ParseFloat(p.Attributes.Amount, 64); err == nil {
+		amountCreated.Add(amount, p.Attributes.Currency)
+	}
+}
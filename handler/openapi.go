@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/openapi"
+	"net/http"
+)
+
+// GET /v1/openapi.json
+func GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(openapi.Spec())
+	if err != nil {
+		logError(r, "could not render OpenAPI document", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not render OpenAPI document")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
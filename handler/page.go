@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/jsonapi"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// page is the JSON:API page[number] and page[size] pair, numbered from 1
+type page struct {
+	number int
+	size   int
+}
+
+func parsePage(query url.Values) (page, *jsonapi.Error) {
+	p := page{number: 1, size: defaultPageSize}
+	for _, param := range []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"page[number]", &p.number, 0},
+		{"page[size]", &p.size, maxPageSize},
+	} {
+		raw := query.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || (param.max > 0 && n > param.max) {
+			detail := param.name + " must be a positive integer"
+			if param.max > 0 {
+				detail += " no greater than " + strconv.Itoa(param.max)
+			}
+			return p, jsonapi.NewError(http.StatusBadRequest, "invalid_page", detail).WithParameter(param.name)
+		}
+		*param.value = n
+	}
+	return p, nil
+}
+
+func (p page) offset() int {
+	return (p.number - 1) * p.size
+}
+
+// links returns the first, prev and next links for the page keeping the other query parameters
+func (p page) links(u *url.URL, total int) *jsonapi.Links {
+	link := func(number int) string {
+		query := u.Query()
+		query.Set("page[number]", strconv.Itoa(number))
+		query.Set("page[size]", strconv.Itoa(p.size))
+		return u.Path + "?" + query.Encode()
+	}
+
+	links := &jsonapi.Links{Self: u.RequestURI(), First: link(1)}
+	if p.number > 1 {
+		links.Prev = link(p.number - 1)
+	}
+	if p.offset()+p.size < total {
+		links.Next = link(p.number + 1)
+	}
+	return links
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"github.com/clD11/form3-payments/iso20022"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/clD11/form3-payments/tracing"
+	"github.com/go-pg/pg"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+)
+
+// POST /v1/payments/pain001?organisation_id={id}
+func ImportPain001(db *pg.DB, preparer prepare.Preparer, w http.ResponseWriter, r *http.Request) {
+	organisationID, err := uuid.FromString(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_id", "Invalid organisation ID").WithParameter("organisation_id"))
+		return
+	}
+
+	tracing.SpanFromContext(r.Context()).SetAttribute("organisation.id", organisationID.String())
+
+	body, apiErr := readBody(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	doc, err := iso20022.ParsePain001(bytes.NewReader(body))
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_document", err.Error())
+		return
+	}
+
+	report, err := ProcessPain001(r.Context(), db, preparer, doc, organisationID).Marshal()
+	if err != nil {
+		logError(r, "could not render pain.002 status report", err, "organisation_id", organisationID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not render status report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(report)
+}
+
+// ProcessPain001 creates a payment for every valid transaction in the document and reports the
+// outcome of each in a pain.002 status report
+func ProcessPain001(ctx context.Context, db *pg.DB, preparer prepare.Preparer, doc *iso20022.Pain001, organisationID uuid.UUID) *iso20022.Pain002 {
+	txs := doc.Transactions(organisationID)
+	reasons := map[int]iso20022.StatusReasonInfo{}
+
+	for i := range txs {
+		if txs[i].Err != nil {
+			reasons[i] = narrative(txs[i].Err.Error())
+			continue
+		}
+		if err := storePayment(db, preparer, &txs[i].Payment); err != nil {
+			if err == errPaymentExists {
+				reasons[i] = iso20022.StatusReasonInfo{
+					Reason:         iso20022.CodeOrProprietary{Code: iso20022.ReasonDuplicate},
+					AdditionalInfo: "Payment already exists",
+				}
+				continue
+			}
+			if apiErr, ok := err.(*jsonapi.Error); ok {
+				reasons[i] = narrative(apiErr.Detail)
+				continue
+			}
+			logging.FromContext(ctx).Error("could not insert payment", "payment_id", txs[i].Payment.ID,
+				"organisation_id", organisationID, "message_id", doc.Initn.GroupHeader.MessageID, "error", err)
+			reasons[i] = narrative("Could not insert payment")
+			continue
+		}
+		recordCreated(txs[i].Payment)
+	}
+
+	return iso20022.NewPain002(doc, txs, reasons)
+}
+
+func narrative(message string) iso20022.StatusReasonInfo {
+	return iso20022.StatusReasonInfo{
+		Reason:         iso20022.CodeOrProprietary{Code: iso20022.ReasonNarrative},
+		AdditionalInfo: message,
+	}
+}
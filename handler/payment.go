@@ -1,57 +1,194 @@
 package handler
 
 import (
-	"encoding/json"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/mandate"
 	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/paymentcsv"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/clD11/form3-payments/scheduler"
+	"github.com/clD11/form3-payments/tracing"
 	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
 	"github.com/gorilla/mux"
 	uuid "github.com/satori/go.uuid"
+	"io/ioutil"
 	"net/http"
+	"time"
 )
 
+// IdempotencyKeyHeader lets clients retry a create without creating the payment twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
 // GET /v1/payments/{id}
 func GetPayment(db *pg.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	uuid, err := uuid.FromString(vars["id"])
 	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "Invalid ID")
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
 		return
 	}
 
 	payment := model.Payment{ID: uuid}
+	tracePayment(r, payment)
 	if err := db.Select(&payment); err != nil {
 		if err == pg.ErrNoRows {
-			writeErrorResponse(w, http.StatusNotFound, "Payment not found")
+			writeErrorResponse(w, r, http.StatusNotFound, "payment_not_found", "Payment not found")
 			return
 		}
-		writeErrorResponse(w, http.StatusInternalServerError, "Server failed to return payment")
+		logError(r, "could not select payment", err, "payment_id", uuid)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Server failed to return payment")
 		return
 	}
 
-	writeResponse(w, http.StatusOK, &payment)
+	tracePayment(r, payment)
+	writeResponse(w, http.StatusOK, jsonapi.NewPaymentDocument(payment))
 }
 
 // POST /v1/payments
-func CreatePayment(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+func CreatePayment(db *pg.DB, preparer prepare.Preparer, w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+		return
+	}
+
+	body, apiErr := readBody(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	if key != "" {
+		record := model.IdempotencyKey{Key: key}
+		err := db.Select(&record)
+		if err == nil {
+			replayPayment(db, w, r, record, fingerprint)
+			return
+		}
+		if err != pg.ErrNoRows {
+			logError(r, "could not select idempotency key", err, "idempotency_key", key)
+			writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not check idempotency key")
+			return
+		}
+	}
+
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
 	var payment model.Payment
-	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "Could not decode request body")
+	if apiErr := resource.ApplyTo(&payment); apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
-	defer r.Body.Close()
+	// JSON:API lets clients supply the ID, otherwise one is generated
+	if uuid.Equal(payment.ID, uuid.Nil) {
+		payment.ID = uuid.NewV4()
+	}
+	tracePayment(r, payment)
 
-	if err := db.Select(&payment); err != pg.ErrNoRows {
-		writeErrorResponse(w, http.StatusBadRequest, "Cannot create payment already exists")
+	var decided prepare.Prepared
+	err := db.RunInTransaction(func(tx *pg.Tx) error {
+		// the key is claimed first, a retry made while this request is still running waits here
+		// until it commits and then replays its payment, or takes over the key if it rolls back
+		if key != "" {
+			claim := &model.IdempotencyKey{Key: key, PaymentID: payment.ID, Fingerprint: fingerprint, CreatedAt: time.Now().UTC()}
+			result, err := tx.Model(claim).OnConflict("DO NOTHING").Insert()
+			if err != nil {
+				return err
+			}
+			if result.RowsAffected() == 0 {
+				return errKeyClaimed
+			}
+		}
+		var err error
+		// booking a quote uses it up, so it is undone if the payment cannot be stored
+		if decided, err = preparer.Prepare(tx, &payment, time.Now()); err != nil {
+			return err
+		}
+		return insertPayment(tx, &payment)
+	})
+	if err == errKeyClaimed {
+		record := model.IdempotencyKey{Key: key}
+		if err := db.Select(&record); err != nil {
+			logError(r, "could not select idempotency key", err, "idempotency_key", key)
+			writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not check idempotency key")
+			return
+		}
+		replayPayment(db, w, r, record, fingerprint)
 		return
 	}
+	if apiErr, ok := err.(*jsonapi.Error); ok {
+		writeError(w, r, apiErr)
+		return
+	}
+	if attrErr, ok := err.(*attribute.Error); ok {
+		writeError(w, r, attributeError(attrErr))
+		return
+	}
+	if err != nil {
+		if err == errPaymentExists {
+			writeError(w, r, jsonapi.NewError(http.StatusConflict, "payment_exists", "Cannot create payment already exists").WithPointer("/data/id"))
+			return
+		}
+		logError(r, "could not insert payment", err, "payment_id", payment.ID, "organisation_id", payment.OrganisationID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not insert payment")
+		return
+	}
+	recordCreated(payment)
+
+	// the response explains the scheme and processing date the service chose
+	document := jsonapi.NewPaymentDocument(payment)
+	document.Meta = map[string]interface{}{}
+	if decided.Routing != nil {
+		document.Meta["routing"] = decided.Routing
+	}
+	if decided.ProcessingDate != nil {
+		document.Meta["processing_date"] = decided.ProcessingDate
+	}
+	w.Header().Set("Location", jsonapi.PaymentLink(payment.ID))
+	writeResponse(w, http.StatusCreated, document)
+}
 
-	if err := db.Insert(&payment); err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Could not insert payment")
+// replayPayment answers a retried create with the payment the key first created
+func replayPayment(db *pg.DB, w http.ResponseWriter, r *http.Request, record model.IdempotencyKey, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		writeErrorResponse(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused",
+			"Idempotency-Key was already used with a different request")
 		return
 	}
 
-	writeResponse(w, http.StatusCreated, payment)
+	payment := model.Payment{ID: record.PaymentID}
+	if err := db.Select(&payment); err != nil {
+		if err == pg.ErrNoRows {
+			writeErrorResponse(w, r, http.StatusNotFound, "payment_not_found", "Payment created with this Idempotency-Key no longer exists")
+			return
+		}
+		logError(r, "could not select payment", err, "payment_id", payment.ID, "idempotency_key", record.Key)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Server failed to return payment")
+		return
+	}
+
+	w.Header().Set("Location", jsonapi.PaymentLink(payment.ID))
+	writeResponse(w, http.StatusCreated, jsonapi.NewPaymentDocument(payment))
 }
 
 // DELETE "/v1/payments/{id}"
@@ -60,89 +197,220 @@ func DeletePayment(db *pg.DB, w http.ResponseWriter, r *http.Request) {
 
 	uuid, err := uuid.FromString(vars["id"])
 	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "Invalid ID")
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
 		return
 	}
 
 	payment := model.Payment{ID: uuid}
+	tracePayment(r, payment)
 	if err := db.Select(&payment); err != nil {
-		writeErrorResponse(w, http.StatusNotFound, "Payment not found cannot delete")
+		if err == pg.ErrNoRows {
+			writeErrorResponse(w, r, http.StatusNotFound, "payment_not_found", "Payment not found cannot delete")
+			return
+		}
+		logError(r, "could not select payment", err, "payment_id", uuid)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Payment could not be deleted")
 		return
 	}
 
+	tracePayment(r, payment)
 	if err := db.Delete(&payment); err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Payment could not be deleted")
+		logError(r, "could not delete payment", err, "payment_id", payment.ID, "organisation_id", payment.OrganisationID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Payment could not be deleted")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // PUT /v1/payments/{id}
-func UpdatePayment(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+// PATCH /v1/payments/{id}
+func UpdatePayment(db *pg.DB, policy fx.Policy, table *routing.Table, calendars *calendar.Calendars, w http.ResponseWriter, r *http.Request) {
 	// get variable
 	vars := mux.Vars(r)
 
 	uuid, err := uuid.FromString(vars["id"])
 	if err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "Invalid ID")
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
 		return
 	}
 
 	// decode body
-	requestPayment := model.Payment{}
-	if err := json.NewDecoder(r.Body).Decode(&requestPayment); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "Could not decode request body")
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
 	defer r.Body.Close()
 
 	// validate request
-	if uuid != requestPayment.ID {
-		writeErrorResponse(w, http.StatusBadRequest, "Could not update payment - request id does not match update payment")
+	if resource.ID != uuid.String() {
+		writeError(w, r, jsonapi.NewError(http.StatusConflict, "id_mismatch",
+			"Could not update payment - request id does not match update payment").WithPointer("/data/id"))
+		return
 	}
 
 	// check payment exists
-	currentPayment := model.Payment{ID: uuid}
-	if err := db.Select(&currentPayment); err != nil {
-		writeErrorResponse(w, http.StatusNotFound, "Could not update payment as not found")
+	payment := model.Payment{ID: uuid}
+	tracePayment(r, payment)
+	if err := db.Select(&payment); err != nil {
+		if err == pg.ErrNoRows {
+			writeErrorResponse(w, r, http.StatusNotFound, "payment_not_found", "Could not update payment as not found")
+			return
+		}
+		logError(r, "could not select payment", err, "payment_id", uuid)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not update payment")
+		return
+	}
+
+	// meta.version is the version the client last read, updating from an older one would undo changes
+	version := payment.Version
+	if resource.Meta != nil && resource.Meta.Version != nil && *resource.Meta.Version != version {
+		writeError(w, r, versionConflict(version))
 		return
 	}
 
-	// update record
-	if err := db.Update(&requestPayment); err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Could not update payment")
+	// members missing from the request keep their stored values
+	stored := payment.Attributes
+	if apiErr := resource.ApplyTo(&payment); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	payment.Version = version + 1
+	if apiErr := checkRouting(table, payment, stored); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	// the rate in effect today only matters if the conversion itself is being changed
+	if apiErr := amendFx(db, policy, r, &payment, stored); apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
+	a := payment.Attributes
+	var adjustment *calendar.Adjustment
+	if a.ProcessingDate != stored.ProcessingDate || a.PaymentScheme != stored.PaymentScheme || a.Currency != stored.Currency {
+		adjustment, apiErr = applyCalendar(calendars, &payment)
+		if apiErr != nil {
+			writeError(w, r, apiErr)
+			return
+		}
+	}
 
-	// return status
-	w.WriteHeader(http.StatusCreated)
+	// update record, the transaction carries the request context so its queries are traced with it
+	tracePayment(r, payment)
+	err = db.WithContext(r.Context()).RunInTransaction(func(tx *pg.Tx) error {
+		if a.PaymentType != stored.PaymentType || a.MandateReference != stored.MandateReference || a.DebtorParty != stored.DebtorParty {
+			if err := mandate.Check(tx, payment); err != nil {
+				return err
+			}
+		}
+		// another update since the select has already taken this version
+		result, err := tx.Model(&payment).WherePK().Where("version = ?", version).Update()
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return errVersionConflict
+		}
+		if payment.Attributes.ProcessingDate == stored.ProcessingDate {
+			return nil
+		}
+		return scheduler.Reschedule(tx, payment, time.Now())
+	})
+	if err == errVersionConflict {
+		writeError(w, r, versionConflict(version))
+		return
+	}
+	if attrErr, ok := err.(*attribute.Error); ok {
+		writeError(w, r, attributeError(attrErr))
+		return
+	}
+	if err != nil {
+		logError(r, "could not update payment", err, "payment_id", payment.ID, "organisation_id", payment.OrganisationID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not update payment")
+		return
+	}
+
+	document := jsonapi.NewPaymentDocument(payment)
+	if adjustment != nil {
+		document.Meta = map[string]interface{}{"processing_date": adjustment}
+	}
+	writeResponse(w, http.StatusOK, document)
 }
 
-// GET /v1/payments
+// GET /v1/payments?filter[{name}]={value}&page[number]={n}&page[size]={n}
 func GetPayments(db *pg.DB, w http.ResponseWriter, r *http.Request) {
 	payments := []model.Payment{}
 
-	if err := db.Model(&payments).Select(); err != nil {
-		writeErrorResponse(w, http.StatusInternalServerError, "Could not get all payments")
+	query, apiErr := applyFilters(db.Model(&payments).Order("id"), r.URL.Query())
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if organisationID := r.URL.Query().Get("filter[organisation_id]"); organisationID != "" {
+		tracing.SpanFromContext(r.Context()).SetAttribute("organisation.id", organisationID)
 	}
 
-	writeResponse(w, http.StatusOK, &payments)
-}
+	// CSV is an export so it always holds every matching payment
+	if acceptsCSV(r) {
+		if err := query.Select(); err != nil {
+			logError(r, "could not select payments", err)
+			writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get all payments")
+			return
+		}
+		w.Header().Set("Content-Type", paymentcsv.ContentType)
+		w.WriteHeader(http.StatusOK)
+		// the status is already sent so a failure can only be logged
+		if err := paymentcsv.Write(w, payments); err != nil {
+			logError(r, "could not write payments csv", err)
+		}
+		return
+	}
 
-// Could be moved to handler utils for use with other handlers
-func writeResponse(w http.ResponseWriter, status int, payload interface{}) {
-	response, err := json.Marshal(payload)
+	pagination, apiErr := parsePage(r.URL.Query())
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	total, err := query.Limit(pagination.size).Offset(pagination.offset()).SelectAndCount()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		logError(r, "could not select payments", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get all payments")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write([]byte(response))
+
+	document := jsonapi.NewPaymentsDocument(payments, r.URL.RequestURI())
+	document.Links = pagination.links(r.URL, total)
+	document.Meta["total"] = total
+	writeResponse(w, http.StatusOK, document)
 }
 
-func writeErrorResponse(w http.ResponseWriter, code int, message string) {
-	writeResponse(w, code, map[string]string{"error": message})
+var (
+	errPaymentExists   = errors.New("payment already exists")
+	errKeyClaimed      = errors.New("idempotency key already claimed")
+	errVersionConflict = errors.New("payment version changed")
+)
+
+func versionConflict(version uint) *jsonapi.Error {
+	return jsonapi.NewError(http.StatusConflict, "version_conflict",
+		fmt.Sprintf("Could not update payment - it is at version %d", version)).WithPointer("/data/meta/version")
+}
+
+// insertPayment stores a new payment unless one with the same ID already exists or it is a Debit
+// without an active mandate, and schedules it for submission
+func insertPayment(db orm.DB, payment *model.Payment) error {
+	// every payment starts at version 0 whatever the client sent
+	payment.Version = 0
+	existing := model.Payment{ID: payment.ID}
+	if err := db.Select(&existing); err != pg.ErrNoRows {
+		return errPaymentExists
+	}
+	if err := mandate.Check(db, *payment); err != nil {
+		return err
+	}
+	if err := db.Insert(payment); err != nil {
+		return err
+	}
+	return scheduler.Add(db, *payment, time.Now())
 }
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/go-pg/pg"
+	"strings"
+	"time"
+)
+
+// storePayment prepares a payment and inserts it with its schedule in one transaction. A payment
+// that cannot be accepted is reported as a *jsonapi.Error, other errors come from the database.
+func storePayment(db *pg.DB, preparer prepare.Preparer, payment *model.Payment) error {
+	err := db.RunInTransaction(func(tx *pg.Tx) error {
+		if _, err := preparer.Prepare(tx, payment, time.Now()); err != nil {
+			return err
+		}
+		return insertPayment(tx, payment)
+	})
+	if attrErr, ok := err.(*attribute.Error); ok {
+		return attributeError(attrErr)
+	}
+	return err
+}
+
+// errorMember turns the pointer of an error about a payment into its dotted column name, such as
+// attributes.fx.contract_reference
+func errorMember(err *jsonapi.Error) string {
+	if err.Source == nil {
+		return ""
+	}
+	return strings.Replace(strings.TrimPrefix(err.Source.Pointer, "/data/"), "/", ".", -1)
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/problem"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// GET /v1/problems
+func GetProblems(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, problem.Catalogue())
+}
+
+// GET /v1/problems/{code}
+func GetProblem(w http.ResponseWriter, r *http.Request) {
+	t, ok := problem.Lookup(mux.Vars(r)["code"])
+	if !ok {
+		writeErrorResponse(w, r, http.StatusNotFound, "problem_not_found", "Problem type not found")
+		return
+	}
+	writeJSON(w, t)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	body, _ := json.Marshal(value)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/ratelimit"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit answers 429 Too Many Requests once a client has spent its tokens for the route. Every
+// limited response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset, and rejected
+// requests Retry-After, all in whole seconds. Requests are let through if the store fails.
+func RateLimit(limiter *ratelimit.Limiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			result, limited, err := limiter.Take(r.Context(), r, route)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("rate limit store failed, request allowed", "error", err)
+			}
+			if err != nil || !limited {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+			if !result.Allowed {
+				w.Header().Set("Retry-After", seconds(result.RetryAfter))
+				writeError(w, r, jsonapi.NewError(http.StatusTooManyRequests, "rate_limited",
+					"Too many requests, retry after "+seconds(result.RetryAfter)+" seconds"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds up so clients that wait as long as they are told are not rejected again
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
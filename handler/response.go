@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/problem"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ContentNegotiation applies the JSON:API media type rules to every request
+func ContentNegotiation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil &&
+			mediaType == jsonapi.MediaType && len(params) > 0 {
+			writeError(w, r, jsonapi.NewError(http.StatusUnsupportedMediaType, "unsupported_media_type",
+				"Media type parameters are not allowed on "+jsonapi.MediaType))
+			return
+		}
+
+		if accept := r.Header.Get("Accept"); accept != "" {
+			requested, unmodified := false, false
+			for _, value := range strings.Split(accept, ",") {
+				mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+				if err != nil || mediaType != jsonapi.MediaType {
+					continue
+				}
+				requested = true
+				if len(params) == 0 {
+					unmodified = true
+				}
+			}
+			if requested && !unmodified {
+				writeError(w, r, jsonapi.NewError(http.StatusNotAcceptable, "not_acceptable",
+					"Accept header must include "+jsonapi.MediaType+" without media type parameters"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeResource checks the request media type and reads the resource object from the body
+func decodeResource(r *http.Request) (*jsonapi.Resource, *jsonapi.Error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != jsonapi.MediaType {
+		return nil, jsonapi.NewError(http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"Content-Type must be "+jsonapi.MediaType)
+	}
+	body, apiErr := readBody(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return jsonapi.DecodeResource(bytes.NewReader(body))
+}
+
+func writeResponse(w http.ResponseWriter, status int, document jsonapi.Document) {
+	response, err := json.Marshal(document)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", jsonapi.MediaType)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// writeError answers with RFC 7807 problem details when the client accepts them, otherwise with a
+// JSON:API error document. Both carry the same stable code from the problem catalogue.
+func writeError(w http.ResponseWriter, r *http.Request, errs ...*jsonapi.Error) {
+	if acceptsProblem(r) {
+		writeProblem(w, r, errs[0])
+		return
+	}
+	document := jsonapi.Document{JSONAPI: &jsonapi.Implementation{Version: jsonapi.Version}}
+	for _, err := range errs {
+		document.Errors = append(document.Errors, *err)
+	}
+	writeResponse(w, errs[0].StatusCode(), document)
+}
+
+// WriteError is writeError for middleware outside the package, so its errors are negotiated the same way
+func WriteError(w http.ResponseWriter, r *http.Request, errs ...*jsonapi.Error) {
+	writeError(w, r, errs...)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	writeError(w, r, jsonapi.NewError(status, code, message))
+}
+
+// attributeError points to the attribute at fault and answers with the status its code has in the
+// problem catalogue
+func attributeError(err *attribute.Error) *jsonapi.Error {
+	status := http.StatusUnprocessableEntity
+	if t, ok := problem.Lookup(err.Code); ok {
+		status = t.Status
+	}
+	apiErr := jsonapi.NewError(status, err.Code, err.Message).WithPointer("/data/attributes/" + err.Member)
+	apiErr.Meta = err.Meta
+	return apiErr
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, err *jsonapi.Error) {
+	details := problem.New(err.StatusCode(), err.Code, err.Detail, r.URL.RequestURI())
+	details.RequestID = w.Header().Get(logging.RequestIDHeader)
+	if err.Source != nil {
+		details.Pointer = err.Source.Pointer
+		details.Parameter = err.Source.Parameter
+	}
+	if offset, ok := err.Offset(); ok {
+		details.Offset = &offset
+	}
+	response, _ := json.Marshal(details)
+	w.Header().Set("Content-Type", problem.MediaType)
+	w.WriteHeader(details.Status)
+	w.Write(response)
+}
+
+// acceptsProblem is true when the Accept header lists application/problem+json
+func acceptsProblem(r *http.Request) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(value)); err == nil && mediaType == problem.MediaType {
+			return true
+		}
+	}
+	return false
+}
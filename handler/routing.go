@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+)
+
+// applyRouting chooses the scheme of a payment created without one and checks the scheme of one
+// that has its own, an unroutable payment lists why each scheme refused it in the error's meta
+func applyRouting(table *routing.Table, payment *model.Payment) (*routing.Decision, *jsonapi.Error) {
+	decision, err := table.Apply(&payment.Attributes)
+	if err != nil {
+		return nil, attributeError(err.(*attribute.Error))
+	}
+	return decision, nil
+}
+
+// checkRouting checks the scheme of an updated payment can still carry it when anything the scheme
+// depends on has changed
+func checkRouting(table *routing.Table, payment model.Payment, stored model.Attributes) *jsonapi.Error {
+	a := payment.Attributes
+	if a.PaymentScheme == stored.PaymentScheme && a.Currency == stored.Currency && a.Amount == stored.Amount &&
+		a.RequestedSpeed == stored.RequestedSpeed && a.DebtorParty.BankIDCode == stored.DebtorParty.BankIDCode &&
+		a.BeneficiaryParty.BankIDCode == stored.BeneficiaryParty.BankIDCode {
+		return nil
+	}
+	if err := table.Check(a); err != nil {
+		return attributeError(err.(*attribute.Error))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/scheduler"
+	"github.com/go-pg/pg"
+	"net/http"
+	"time"
+)
+
+// GET /v1/schedules?filter[status]={status}&from={date}&to={date}&page[number]={n}&page[size]={n}
+func GetSchedules(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	schedules := []model.PaymentSchedule{}
+	query := db.Model(&schedules).Order("processing_date", "payment_id")
+
+	// the upcoming schedule is the payments still waiting for their date
+	values := r.URL.Query()
+	status := values.Get("filter[status]")
+	if status == "" {
+		status = scheduler.Scheduled
+	}
+	switch status {
+	case scheduler.Scheduled, scheduler.Submitted, scheduler.Failed, scheduler.Cancelled:
+		query = query.Where("status = ?", status)
+	default:
+		writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_filter",
+			"filter[status] must be scheduled, submitted, failed or cancelled").WithParameter("filter[status]"))
+		return
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "processing_date >= ?"},
+		{"to", "processing_date <= ?"},
+	} {
+		raw := values.Get(bound.param)
+		if raw == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", raw); err != nil {
+			writeError(w, r, jsonapi.NewError(http.StatusBadRequest, "invalid_date",
+				bound.param+" must be in YYYY-MM-DD format").WithParameter(bound.param))
+			return
+		}
+		query = query.Where(bound.condition, raw)
+	}
+
+	pagination, apiErr := parsePage(values)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	total, err := query.Limit(pagination.size).Offset(pagination.offset()).SelectAndCount()
+	if err != nil {
+		logError(r, "could not select schedules", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get schedules")
+		return
+	}
+
+	document := jsonapi.NewPaymentSchedulesDocument(schedules, r.URL.RequestURI())
+	document.Links = pagination.links(r.URL, total)
+	document.Meta["total"] = total
+	writeResponse(w, http.StatusOK, document)
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/clD11/form3-payments/standingorder"
+	"github.com/go-pg/pg"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+// POST /v1/standing-orders
+func CreateStandingOrder(db *pg.DB, table *routing.Table, calendars *calendar.Calendars, w http.ResponseWriter, r *http.Request) {
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	var order model.StandingOrder
+	if apiErr := resource.ApplyToStandingOrder(&order); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if uuid.Equal(order.ID, uuid.Nil) {
+		order.ID = uuid.NewV4()
+	}
+	if uuid.Equal(order.OrganisationID, uuid.Nil) {
+		writeError(w, r, jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_standing_order",
+			"A standing order must have an organisation relationship").WithPointer("/data/relationships"))
+		return
+	}
+
+	// the server plans and counts occurrences, whatever the request says about them
+	now := time.Now().UTC()
+	order.Status = standingorder.Active
+	order.Occurrences = 0
+	order.NextIndex = 0
+	order.LastProcessingDate = ""
+	order.LastError = ""
+	order.CreatedAt = now
+	order.UpdatedAt = now
+	if apiErr := planStandingOrder(table, calendars, &order, now); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if order.Status == standingorder.Completed {
+		writeError(w, r, jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_standing_order",
+			"The standing order has no occurrences from today").WithPointer("/data/attributes"))
+		return
+	}
+
+	existing := model.StandingOrder{ID: order.ID}
+	if err := db.Select(&existing); err != pg.ErrNoRows {
+		if err != nil {
+			logError(r, "could not select standing order", err, "standing_order_id", order.ID)
+			writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not insert standing order")
+			return
+		}
+		writeError(w, r, jsonapi.NewError(http.StatusConflict, "standing_order_exists", "Standing order already exists").WithPointer("/data/id"))
+		return
+	}
+	if err := db.Insert(&order); err != nil {
+		logError(r, "could not insert standing order", err, "standing_order_id", order.ID, "organisation_id", order.OrganisationID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not insert standing order")
+		return
+	}
+
+	w.Header().Set("Location", jsonapi.StandingOrderLink(order.ID))
+	writeResponse(w, http.StatusCreated, jsonapi.NewStandingOrderDocument(order))
+}
+
+// GET /v1/standing-orders/{id}
+func GetStandingOrder(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	order, ok := selectStandingOrder(db, w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, http.StatusOK, jsonapi.NewStandingOrderDocument(order))
+}
+
+// PATCH /v1/standing-orders/{id}
+func UpdateStandingOrder(db *pg.DB, table *routing.Table, calendars *calendar.Calendars, w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
+		return
+	}
+	resource, apiErr := decodeResource(r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	if resource.ID != id.String() {
+		writeError(w, r, jsonapi.NewError(http.StatusConflict, "id_mismatch",
+			"Could not update standing order - request id does not match update standing order").WithPointer("/data/id"))
+		return
+	}
+
+	// the order is locked so an amendment cannot race the generator making an occurrence
+	order := model.StandingOrder{ID: id}
+	err = db.RunInTransaction(func(tx *pg.Tx) error {
+		if err := tx.Model(&order).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+		if apiErr := amendStandingOrder(table, calendars, &order, resource, time.Now().UTC()); apiErr != nil {
+			return apiErr
+		}
+		return tx.Update(&order)
+	})
+	if apiErr, ok := err.(*jsonapi.Error); ok {
+		writeError(w, r, apiErr)
+		return
+	}
+	if err == pg.ErrNoRows {
+		writeErrorResponse(w, r, http.StatusNotFound, "standing_order_not_found", "Standing order not found")
+		return
+	}
+	if err != nil {
+		logError(r, "could not update standing order", err, "standing_order_id", id)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not update standing order")
+		return
+	}
+	writeResponse(w, http.StatusOK, jsonapi.NewStandingOrderDocument(order))
+}
+
+// GET /v1/standing-orders/{id}/payments?page[number]={n}&page[size]={n}
+func GetStandingOrderPayments(db *pg.DB, w http.ResponseWriter, r *http.Request) {
+	order, ok := selectStandingOrder(db, w, r)
+	if !ok {
+		return
+	}
+	pagination, apiErr := parsePage(r.URL.Query())
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	payments := []model.Payment{}
+	total, err := db.Model(&payments).
+		Where("id IN (SELECT payment_id FROM standing_order_payments WHERE standing_order_id = ?)", order.ID).
+		OrderExpr("attributes->>'processing_date'").
+		Order("id").
+		Limit(pagination.size).
+		Offset(pagination.offset()).
+		SelectAndCount()
+	if err != nil {
+		logError(r, "could not select standing order payments", err, "standing_order_id", order.ID)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get standing order payments")
+		return
+	}
+
+	document := jsonapi.NewStandingOrderPaymentsDocument(order.ID, payments, r.URL.RequestURI())
+	document.Links = pagination.links(r.URL, total)
+	document.Meta["total"] = total
+	writeResponse(w, http.StatusOK, document)
+}
+
+// selectStandingOrder finds the standing order in the URL, writing the error response when it cannot
+func selectStandingOrder(db *pg.DB, w http.ResponseWriter, r *http.Request) (model.StandingOrder, bool) {
+	id, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id", "Invalid ID")
+		return model.StandingOrder{}, false
+	}
+	order := model.StandingOrder{ID: id}
+	if err := db.Select(&order); err != nil {
+		if err == pg.ErrNoRows {
+			writeErrorResponse(w, r, http.StatusNotFound, "standing_order_not_found", "Standing order not found")
+			return order, false
+		}
+		logError(r, "could not select standing order", err, "standing_order_id", id)
+		writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error", "Could not get standing order")
+		return order, false
+	}
+	return order, true
+}
+
+// amendStandingOrder applies a PATCH to a stored order. Changes take effect from the next
+// occurrence, payments already made are left as they are. Pausing stops occurrences until the
+// order is active again, and cancelling stops them for good.
+func amendStandingOrder(table *routing.Table, calendars *calendar.Calendars, order *model.StandingOrder, resource *jsonapi.Resource, now time.Time) *jsonapi.Error {
+	if order.Status == standingorder.Cancelled || order.Status == standingorder.Completed {
+		return jsonapi.NewError(http.StatusConflict, "standing_order_closed",
+			fmt.Sprintf("Standing order is %s and cannot be changed", order.Status))
+	}
+	stored := *order
+	if apiErr := resource.ApplyToStandingOrder(order); apiErr != nil {
+		return apiErr
+	}
+	order.OrganisationID = stored.OrganisationID
+	order.Occurrences = stored.Occurrences
+	order.LastProcessingDate = stored.LastProcessingDate
+	order.LastError = stored.LastError
+	order.CreatedAt = stored.CreatedAt
+	order.UpdatedAt = now
+
+	switch order.Status {
+	case standingorder.Active, standingorder.Paused:
+	case standingorder.Cancelled:
+		order.NextDate = ""
+		order.NextProcessingDate = ""
+		return nil
+	default:
+		return jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_standing_order",
+			fmt.Sprintf("status %q must be %s, %s or %s", order.Status, standingorder.Active, standingorder.Paused, standingorder.Cancelled)).
+			WithPointer("/data/attributes/status")
+	}
+	// planning again from the first occurrence skips the dates that passed or were already paid
+	order.NextIndex = 0
+	return planStandingOrder(table, calendars, order, now)
+}
+
+// planStandingOrder checks the order and finds its next occurrence from today
+func planStandingOrder(table *routing.Table, calendars *calendar.Calendars, order *model.StandingOrder, now time.Time) *jsonapi.Error {
+	if err := standingorder.Validate(order, table); err != nil {
+		return attributeError(err.(*attribute.Error))
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if err := standingorder.Plan(order, calendars, standingorder.Scheme(table, order.Template), today); err != nil {
+		return jsonapi.NewError(http.StatusUnprocessableEntity, "invalid_standing_order", err.Error()).WithPointer("/data/attributes/start_date")
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/tracing"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+)
+
+// tracePayment records the payment and, once known, its organisation on the request's span
+func tracePayment(r *http.Request, payment model.Payment) {
+	span := tracing.SpanFromContext(r.Context())
+	span.SetAttribute("payment.id", payment.ID.String())
+	if !uuid.Equal(payment.OrganisationID, uuid.Nil) {
+		span.SetAttribute("organisation.id", payment.OrganisationID.String())
+	}
+}
@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerShouldReportEachCheck(t *testing.T) {
+	handler := Handler(time.Second,
+		Check{Name: "database", Run: func(ctx context.Context) error { return nil }},
+		Check{Name: "workers", Run: func(ctx context.Context) error { return errors.New("scheduler stopped") }},
+	)
+
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report Report
+	json.NewDecoder(rw.Body).Decode(&report)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusPass, report.Checks["database"].Status)
+	assert.Equal(t, "scheduler stopped", report.Checks["workers"].Error)
+}
+
+func TestRunShouldFailChecksThatTimeOut(t *testing.T) {
+	report := Run(context.Background(), 10*time.Millisecond, []Check{
+		{Name: "slow", Run: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+	})
+
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestHandlerShouldPassWithoutChecks(t *testing.T) {
+	rw := httptest.NewRecorder()
+	Handler(time.Second)(rw, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"status":"pass","checks":{}}`, rw.Body.String())
+}
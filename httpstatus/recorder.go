@@ -0,0 +1,19 @@
+package httpstatus
+
+import "net/http"
+
+// Recorder remembers the status written through it so middleware can report it once the handler
+// returns. Handlers that never call WriteHeader respond 200.
+type Recorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,24 @@
+package httpstatus
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecorderShouldDefaultToStatusOK(t *testing.T) {
+	recorder := NewRecorder(httptest.NewRecorder())
+	recorder.Write([]byte("ok"))
+
+	assert.Equal(t, http.StatusOK, recorder.Status)
+}
+
+func TestRecorderShouldRecordAndForwardStatus(t *testing.T) {
+	rw := httptest.NewRecorder()
+	recorder := NewRecorder(rw)
+	recorder.WriteHeader(http.StatusTeapot)
+
+	assert.Equal(t, http.StatusTeapot, recorder.Status)
+	assert.Equal(t, http.StatusTeapot, rw.Code)
+}
@@ -0,0 +1,24 @@
+package fixture
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// SeedPayments reads the payments in seeddata.json at the root of the repository, failing the test
+// when they cannot be read
+func SeedPayments(t *testing.T) (payments []model.Payment) {
+	_, file, _, _ := runtime.Caller(0)
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "seeddata.json"))
+	if err != nil {
+		t.Fatalf("Could not read seed data - %s", err.Error())
+	}
+	if err := json.Unmarshal(data, &payments); err != nil {
+		t.Fatalf("Could not decode seed data - %s", err.Error())
+	}
+	return
+}
@@ -0,0 +1,352 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"math/big"
+	"strings"
+)
+
+const Pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.09"
+
+// Pain001 is a customer credit transfer initiation (pain.001.001.09)
+type Pain001 struct {
+	XMLName xml.Name               `xml:"Document"`
+	Initn   CustomerCreditTransfer `xml:"CstmrCdtTrfInitn"`
+}
+
+type CustomerCreditTransfer struct {
+	GroupHeader        GroupHeader          `xml:"GrpHdr"`
+	PaymentInformation []PaymentInformation `xml:"PmtInf"`
+}
+
+type GroupHeader struct {
+	MessageID            string `xml:"MsgId"`
+	CreationDateTime     string `xml:"CreDtTm"`
+	NumberOfTransactions int    `xml:"NbOfTxs"`
+	ControlSum           string `xml:"CtrlSum"`
+	InitiatingParty      Party  `xml:"InitgPty"`
+}
+
+type PaymentInformation struct {
+	PaymentInformationID string               `xml:"PmtInfId"`
+	PaymentMethod        string               `xml:"PmtMtd"`
+	PaymentTypeInfo      PaymentTypeInfo      `xml:"PmtTpInf"`
+	RequestedExecution   DateAndDateTime      `xml:"ReqdExctnDt"`
+	Debtor               Party                `xml:"Dbtr"`
+	DebtorAccount        Account              `xml:"DbtrAcct"`
+	DebtorAgent          Agent                `xml:"DbtrAgt"`
+	ChargeBearer         string               `xml:"ChrgBr"`
+	Transactions         []CreditTransferInfo `xml:"CdtTrfTxInf"`
+}
+
+type DateAndDateTime struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type PaymentTypeInfo struct {
+	ServiceLevel    CodeOrProprietary `xml:"SvcLvl"`
+	LocalInstrument CodeOrProprietary `xml:"LclInstrm"`
+	CategoryPurpose CodeOrProprietary `xml:"CtgyPurp"`
+}
+
+type CodeOrProprietary struct {
+	Code        string `xml:"Cd"`
+	Proprietary string `xml:"Prtry"`
+}
+
+// schemes are the ISO service level and local instrument codes that name a scheme of the routing
+// table. Codes that only say how fast a payment settles are in speeds, any other code is left for
+// routing to choose the scheme.
+var (
+	schemes = map[string]string{"SEPA": "SEPACT", "URGP": "CHAPS", "SDVA": "CHAPS"}
+	speeds  = map[string]string{"INST": routing.Instant, "NURG": routing.Standard}
+)
+
+// scheme reads the scheme and speed from the local instrument, then the service level. A
+// proprietary value is the name of the scheme, a code is mapped through schemes and speeds.
+func (t PaymentTypeInfo) scheme() (scheme string, speed string) {
+	for _, c := range []CodeOrProprietary{t.LocalInstrument, t.ServiceLevel} {
+		if scheme == "" && c.Proprietary != "" {
+			scheme = c.Proprietary
+		}
+		if scheme == "" && c.Proprietary == "" {
+			scheme = schemes[c.Code]
+		}
+		if speed == "" {
+			speed = speeds[c.Code]
+		}
+	}
+	return scheme, speed
+}
+
+func (c CodeOrProprietary) String() string {
+	if c.Proprietary != "" {
+		return c.Proprietary
+	}
+	return c.Code
+}
+
+type Party struct {
+	Name          string        `xml:"Nm"`
+	PostalAddress PostalAddress `xml:"PstlAdr"`
+}
+
+type PostalAddress struct {
+	StreetName  string   `xml:"StrtNm"`
+	BuildingNo  string   `xml:"BldgNb"`
+	PostCode    string   `xml:"PstCd"`
+	TownName    string   `xml:"TwnNm"`
+	Country     string   `xml:"Ctry"`
+	AddressLine []string `xml:"AdrLine"`
+}
+
+// String flattens the structured or unstructured address into a single line
+func (a PostalAddress) String() string {
+	if len(a.AddressLine) > 0 {
+		return strings.Join(a.AddressLine, " ")
+	}
+	var parts []string
+	for _, part := range []string{a.BuildingNo, a.StreetName, a.TownName, a.PostCode} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+type Account struct {
+	ID AccountID `xml:"Id"`
+}
+
+type AccountID struct {
+	IBAN  string    `xml:"IBAN"`
+	Other GenericID `xml:"Othr"`
+}
+
+type GenericID struct {
+	ID string `xml:"Id"`
+}
+
+type Agent struct {
+	FinancialInstitution FinancialInstitution `xml:"FinInstnId"`
+}
+
+type FinancialInstitution struct {
+	BIC            string               `xml:"BICFI"`
+	ClearingSystem ClearingSystemMember `xml:"ClrSysMmbId"`
+}
+
+type ClearingSystemMember struct {
+	ClearingSystemID CodeOrProprietary `xml:"ClrSysId"`
+	MemberID         string            `xml:"MmbId"`
+}
+
+type CreditTransferInfo struct {
+	PaymentID       PaymentIdentification `xml:"PmtId"`
+	PaymentTypeInfo PaymentTypeInfo       `xml:"PmtTpInf"`
+	Amount          AmountChoice          `xml:"Amt"`
+	ExchangeRate    ExchangeRateInfo      `xml:"XchgRateInf"`
+	ChargeBearer    string                `xml:"ChrgBr"`
+	CreditorAgent   Agent                 `xml:"CdtrAgt"`
+	Creditor        Party                 `xml:"Cdtr"`
+	CreditorAccount Account               `xml:"CdtrAcct"`
+	Purpose         CodeOrProprietary     `xml:"Purp"`
+	RemittanceInfo  RemittanceInfo        `xml:"RmtInf"`
+}
+
+type PaymentIdentification struct {
+	InstructionID string `xml:"InstrId"`
+	EndToEndID    string `xml:"EndToEndId"`
+}
+
+type AmountChoice struct {
+	Instructed ActiveCurrencyAmount `xml:"InstdAmt"`
+}
+
+type ActiveCurrencyAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ExchangeRateInfo struct {
+	Rate               string `xml:"XchgRate"`
+	ContractIdentifier string `xml:"CtrctId"`
+}
+
+type RemittanceInfo struct {
+	Unstructured []string `xml:"Ustrd"`
+}
+
+// Transaction is a single credit transfer mapped onto a payment
+type Transaction struct {
+	PaymentInformationID string
+	InstructionID        string
+	EndToEndID           string
+	Payment              model.Payment
+	// Err is set when the transaction could not be mapped to a valid payment
+	Err error
+}
+
+// ParsePain001 decodes a pain.001.001.09 document and checks the group header control values
+func ParsePain001(r io.Reader) (*Pain001, error) {
+	var doc Pain001
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("could not decode pain.001 document: %s", err)
+	}
+	if doc.XMLName.Space != Pain001Namespace {
+		return nil, fmt.Errorf("unsupported document namespace %q, expected %q", doc.XMLName.Space, Pain001Namespace)
+	}
+
+	header := doc.Initn.GroupHeader
+	if header.MessageID == "" {
+		return nil, fmt.Errorf("group header has no message id")
+	}
+
+	count := 0
+	sum := new(big.Rat)
+	for _, info := range doc.Initn.PaymentInformation {
+		for _, tx := range info.Transactions {
+			count++
+			if amount, ok := new(big.Rat).SetString(tx.Amount.Instructed.Value); ok {
+				sum.Add(sum, amount)
+			}
+		}
+	}
+
+	if header.NumberOfTransactions != count {
+		return nil, fmt.Errorf("group header declares %d transactions but document contains %d", header.NumberOfTransactions, count)
+	}
+	if header.ControlSum != "" {
+		controlSum, ok := new(big.Rat).SetString(header.ControlSum)
+		if !ok {
+			return nil, fmt.Errorf("control sum %q is not a decimal", header.ControlSum)
+		}
+		if controlSum.Cmp(sum) != 0 {
+			return nil, fmt.Errorf("control sum %s does not match sum of transactions %s", header.ControlSum, sum.FloatString(2))
+		}
+	}
+
+	return &doc, nil
+}
+
+// Transactions maps every credit transfer in the document onto a payment owned by organisationID.
+// Payment IDs are derived from the message, payment information and end to end identifiers so
+// resubmitting the same file produces the same payments.
+func (d *Pain001) Transactions(organisationID uuid.UUID) []Transaction {
+	var txs []Transaction
+	for _, info := range d.Initn.PaymentInformation {
+		for _, cdt := range info.Transactions {
+			tx := Transaction{
+				PaymentInformationID: info.PaymentInformationID,
+				InstructionID:        cdt.PaymentID.InstructionID,
+				EndToEndID:           cdt.PaymentID.EndToEndID,
+			}
+			tx.Payment = d.payment(organisationID, info, cdt)
+			if info.PaymentMethod != "TRF" {
+				tx.Err = fmt.Errorf("payment method %q is not a credit transfer", info.PaymentMethod)
+			} else {
+				tx.Err = tx.Payment.Validate()
+			}
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
+
+func (d *Pain001) payment(organisationID uuid.UUID, info PaymentInformation, cdt CreditTransferInfo) model.Payment {
+	name := strings.Join([]string{d.Initn.GroupHeader.MessageID, info.PaymentInformationID, cdt.PaymentID.EndToEndID}, "/")
+
+	typeInfo := info.PaymentTypeInfo
+	if cdt.PaymentTypeInfo != (PaymentTypeInfo{}) {
+		typeInfo = cdt.PaymentTypeInfo
+	}
+
+	scheme, speed := typeInfo.scheme()
+
+	bearer := cdt.ChargeBearer
+	if bearer == "" {
+		bearer = info.ChargeBearer
+	}
+
+	processingDate := info.RequestedExecution.Date
+	if processingDate == "" && len(info.RequestedExecution.DateTime) >= 10 {
+		processingDate = info.RequestedExecution.DateTime[:10]
+	}
+
+	debtorAccount, debtorAccountCode := accountNumber(info.DebtorAccount)
+	debtorBank, debtorBankCode := bankID(info.DebtorAgent)
+	creditorAccount, creditorAccountCode := accountNumber(cdt.CreditorAccount)
+	creditorBank, creditorBankCode := bankID(cdt.CreditorAgent)
+
+	payment := model.Payment{
+		Type:           "Payment",
+		ID:             uuid.NewV5(organisationID, name),
+		OrganisationID: organisationID,
+		Attributes: model.Attributes{
+			Amount: cdt.Amount.Instructed.Value,
+			BeneficiaryParty: model.BeneficiaryParty{
+				AccountName:       cdt.Creditor.Name,
+				AccountNumber:     creditorAccount,
+				AccountNumberCode: creditorAccountCode,
+				Address:           cdt.Creditor.PostalAddress.String(),
+				BankID:            creditorBank,
+				BankIDCode:        creditorBankCode,
+				Name:              cdt.Creditor.Name,
+			},
+			ChargesInformation: model.ChargesInformation{
+				BearerCode: bearer,
+			},
+			Currency: cdt.Amount.Instructed.Currency,
+			DebtorParty: model.DebtorParty{
+				AccountName:       info.Debtor.Name,
+				AccountNumber:     debtorAccount,
+				AccountNumberCode: debtorAccountCode,
+				Address:           info.Debtor.PostalAddress.String(),
+				BankID:            debtorBank,
+				BankIDCode:        debtorBankCode,
+				Name:              info.Debtor.Name,
+			},
+			EndToEndReference: cdt.PaymentID.EndToEndID,
+			PaymentID:         cdt.PaymentID.InstructionID,
+			PaymentPurpose:    cdt.Purpose.String(),
+			PaymentScheme:     scheme,
+			PaymentType:       "Credit",
+			ProcessingDate:    processingDate,
+			Reference:         strings.Join(cdt.RemittanceInfo.Unstructured, " "),
+			RequestedSpeed:    speed,
+		},
+	}
+
+	if cdt.ExchangeRate.Rate != "" || cdt.ExchangeRate.ContractIdentifier != "" {
+		payment.Attributes.Fx = model.Fx{
+			ContractReference: cdt.ExchangeRate.ContractIdentifier,
+			ExchangeRate:      cdt.ExchangeRate.Rate,
+		}
+	}
+
+	return payment
+}
+
+func accountNumber(account Account) (number string, code string) {
+	if account.ID.IBAN != "" {
+		return account.ID.IBAN, "IBAN"
+	}
+	return account.ID.Other.ID, "BBAN"
+}
+
+func bankID(agent Agent) (id string, code string) {
+	institution := agent.FinancialInstitution
+	if institution.ClearingSystem.MemberID != "" {
+		return institution.ClearingSystem.MemberID, institution.ClearingSystem.ClearingSystemID.String()
+	}
+	if institution.BIC != "" {
+		return institution.BIC, "SWBIC"
+	}
+	return "", ""
+}
@@ -0,0 +1,132 @@
+package iso20022
+
+import (
+	"bytes"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParsePain001ShouldMapCreditTransfersToPayments(t *testing.T) {
+	doc := parseTestdata(t)
+	organisationID := uuid.NewV4()
+
+	txs := doc.Transactions(organisationID)
+
+	assert.Len(t, txs, 2)
+	assert.NoError(t, txs[0].Err)
+
+	payment := txs[0].Payment
+	assert.Equal(t, organisationID, payment.OrganisationID)
+	assert.Equal(t, "100.21", payment.Attributes.Amount)
+	assert.Equal(t, "GBP", payment.Attributes.Currency)
+	assert.Equal(t, "Wil piano Jan", payment.Attributes.EndToEndReference)
+	assert.Equal(t, "FPS", payment.Attributes.PaymentScheme)
+	assert.Equal(t, "2017-01-18", payment.Attributes.ProcessingDate)
+	assert.Equal(t, model.DebtorParty{
+		AccountName:       "Emelia Jane Brown",
+		AccountNumber:     "GB29XABC10161234567801",
+		AccountNumberCode: "IBAN",
+		Address:           "10 Debtor Crescent Sourcetown NE1",
+		BankID:            "203301",
+		BankIDCode:        "GBDSC",
+		Name:              "Emelia Jane Brown",
+	}, payment.Attributes.DebtorParty)
+	assert.Equal(t, "31926819", payment.Attributes.BeneficiaryParty.AccountNumber)
+	assert.Equal(t, "BBAN", payment.Attributes.BeneficiaryParty.AccountNumberCode)
+}
+
+func TestParsePain001ShouldDeriveStablePaymentIDs(t *testing.T) {
+	organisationID := uuid.NewV4()
+
+	first := parseTestdata(t).Transactions(organisationID)
+	second := parseTestdata(t).Transactions(organisationID)
+
+	assert.Equal(t, first[0].Payment.ID, second[0].Payment.ID)
+	assert.NotEqual(t, first[0].Payment.ID, first[1].Payment.ID)
+}
+
+func TestParsePain001ShouldRejectInvalidTransactions(t *testing.T) {
+	txs := parseTestdata(t).Transactions(uuid.NewV4())
+
+	assert.EqualError(t, txs[1].Err, "beneficiary_party.account_number is required")
+}
+
+func TestParsePain001ShouldFailWhenControlSumDoesNotMatch(t *testing.T) {
+	data, _ := ioutil.ReadFile("testdata/pain001.xml")
+	data = bytes.Replace(data, []byte("<CtrlSum>1000.41</CtrlSum>"), []byte("<CtrlSum>10.00</CtrlSum>"), 1)
+
+	_, err := ParsePain001(bytes.NewReader(data))
+
+	assert.EqualError(t, err, "control sum 10.00 does not match sum of transactions 1000.41")
+}
+
+func TestParsePain001ShouldMapPaymentTypeCodesToSchemesAndSpeeds(t *testing.T) {
+	cases := []struct {
+		info   PaymentTypeInfo
+		scheme string
+		speed  string
+	}{
+		{PaymentTypeInfo{LocalInstrument: CodeOrProprietary{Proprietary: "FPS"}}, "FPS", ""},
+		{PaymentTypeInfo{ServiceLevel: CodeOrProprietary{Code: "SEPA"}}, "SEPACT", ""},
+		{PaymentTypeInfo{ServiceLevel: CodeOrProprietary{Code: "URGP"}}, "CHAPS", ""},
+		{PaymentTypeInfo{LocalInstrument: CodeOrProprietary{Code: "INST"}, ServiceLevel: CodeOrProprietary{Code: "SEPA"}}, "SEPACT", "instant"},
+		{PaymentTypeInfo{ServiceLevel: CodeOrProprietary{Code: "NURG"}}, "", "standard"},
+		{PaymentTypeInfo{LocalInstrument: CodeOrProprietary{Code: "CORE"}}, "", ""},
+		{PaymentTypeInfo{CategoryPurpose: CodeOrProprietary{Code: "SALA"}}, "", ""},
+	}
+	for _, c := range cases {
+		doc := parseTestdata(t)
+		doc.Initn.PaymentInformation[0].PaymentTypeInfo = c.info
+
+		payment := doc.Transactions(uuid.NewV4())[0].Payment
+
+		assert.Equal(t, c.scheme, payment.Attributes.PaymentScheme, "%+v", c.info)
+		assert.Equal(t, c.speed, payment.Attributes.RequestedSpeed, "%+v", c.info)
+		assert.Empty(t, payment.Attributes.SchemePaymentType, "%+v", c.info)
+	}
+}
+
+func TestNewPain002ShouldReportStatusPerTransaction(t *testing.T) {
+	doc := parseTestdata(t)
+	txs := doc.Transactions(uuid.NewV4())
+
+	report := NewPain002(doc, txs, map[int]StatusReasonInfo{
+		1: {Reason: CodeOrProprietary{Code: ReasonNarrative}, AdditionalInfo: txs[1].Err.Error()},
+	})
+
+	assert.Equal(t, StatusPartiallyAccepted, report.Report.OriginalGroup.GroupStatus)
+	assert.Equal(t, "MSG-20170118-01", report.Report.OriginalGroup.OriginalMessageID)
+	statuses := report.Report.PaymentInformation[0].Transactions
+	assert.Equal(t, StatusAccepted, statuses[0].Status)
+	assert.Equal(t, StatusRejected, statuses[1].Status)
+
+	body, err := report.Marshal()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(body), Pain002Namespace))
+}
+
+func TestNewPain002ShouldRejectMessageWithoutTransactions(t *testing.T) {
+	report := NewPain002(parseTestdata(t), nil, nil)
+
+	assert.Equal(t, StatusRejected, report.Report.OriginalGroup.GroupStatus)
+	assert.Equal(t, 0, report.Report.OriginalGroup.OriginalNumberOfTransactions)
+}
+
+func parseTestdata(t *testing.T) *Pain001 {
+	file, err := os.Open("testdata/pain001.xml")
+	if err != nil {
+		t.Fatalf("Could not open testdata - %s", err.Error())
+	}
+	defer file.Close()
+
+	doc, err := ParsePain001(file)
+	if err != nil {
+		t.Fatalf("Could not parse testdata - %s", err.Error())
+	}
+	return doc
+}
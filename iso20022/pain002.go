@@ -0,0 +1,131 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const Pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.10"
+
+// Status codes used in pain.002 reports
+const (
+	StatusAccepted          = "ACCP"
+	StatusPartiallyAccepted = "PART"
+	StatusRejected          = "RJCT"
+)
+
+// Reason codes used in pain.002 reports
+const (
+	ReasonDuplicate = "AM05"
+	ReasonNarrative = "NARR"
+)
+
+// Pain002 is a customer payment status report (pain.002.001.10)
+type Pain002 struct {
+	XMLName xml.Name            `xml:"Document"`
+	XMLNS   string              `xml:"xmlns,attr"`
+	Report  PaymentStatusReport `xml:"CstmrPmtStsRpt"`
+}
+
+type PaymentStatusReport struct {
+	GroupHeader        StatusGroupHeader       `xml:"GrpHdr"`
+	OriginalGroup      OriginalGroupStatus     `xml:"OrgnlGrpInfAndSts"`
+	PaymentInformation []OriginalPaymentStatus `xml:"OrgnlPmtInfAndSts,omitempty"`
+}
+
+type StatusGroupHeader struct {
+	MessageID        string `xml:"MsgId"`
+	CreationDateTime string `xml:"CreDtTm"`
+}
+
+type OriginalGroupStatus struct {
+	OriginalMessageID            string             `xml:"OrgnlMsgId"`
+	OriginalMessageNameID        string             `xml:"OrgnlMsgNmId"`
+	OriginalNumberOfTransactions int                `xml:"OrgnlNbOfTxs"`
+	GroupStatus                  string             `xml:"GrpSts"`
+	StatusReason                 []StatusReasonInfo `xml:"StsRsnInf,omitempty"`
+}
+
+type OriginalPaymentStatus struct {
+	OriginalPaymentInformationID string              `xml:"OrgnlPmtInfId"`
+	Transactions                 []TransactionStatus `xml:"TxInfAndSts"`
+}
+
+type TransactionStatus struct {
+	OriginalInstructionID string             `xml:"OrgnlInstrId,omitempty"`
+	OriginalEndToEndID    string             `xml:"OrgnlEndToEndId"`
+	Status                string             `xml:"TxSts"`
+	StatusReason          []StatusReasonInfo `xml:"StsRsnInf,omitempty"`
+}
+
+type StatusReasonInfo struct {
+	Reason         CodeOrProprietary `xml:"Rsn"`
+	AdditionalInfo string            `xml:"AddtlInf,omitempty"`
+}
+
+// NewPain002 builds a status report for the original document with a status per transaction.
+// reasons holds the reason code and message for each rejected transaction, keyed by index into txs.
+func NewPain002(original *Pain001, txs []Transaction, reasons map[int]StatusReasonInfo) *Pain002 {
+	header := original.Initn.GroupHeader
+	report := &Pain002{
+		XMLNS: Pain002Namespace,
+		Report: PaymentStatusReport{
+			GroupHeader: StatusGroupHeader{
+				MessageID:        "STS-" + header.MessageID,
+				CreationDateTime: time.Now().UTC().Format("2006-01-02T15:04:05"),
+			},
+			OriginalGroup: OriginalGroupStatus{
+				OriginalMessageID:            header.MessageID,
+				OriginalMessageNameID:        "pain.001.001.09",
+				OriginalNumberOfTransactions: len(txs),
+			},
+		},
+	}
+
+	accepted := 0
+	byInfo := map[string]int{}
+	for i, tx := range txs {
+		status := TransactionStatus{
+			OriginalInstructionID: tx.InstructionID,
+			OriginalEndToEndID:    tx.EndToEndID,
+			Status:                StatusAccepted,
+		}
+		if reason, rejected := reasons[i]; rejected {
+			status.Status = StatusRejected
+			status.StatusReason = []StatusReasonInfo{reason}
+		} else {
+			accepted++
+		}
+
+		index, ok := byInfo[tx.PaymentInformationID]
+		if !ok {
+			index = len(report.Report.PaymentInformation)
+			byInfo[tx.PaymentInformationID] = index
+			report.Report.PaymentInformation = append(report.Report.PaymentInformation,
+				OriginalPaymentStatus{OriginalPaymentInformationID: tx.PaymentInformationID})
+		}
+		info := &report.Report.PaymentInformation[index]
+		info.Transactions = append(info.Transactions, status)
+	}
+
+	// a message without transactions has nothing to accept
+	switch accepted {
+	case 0:
+		report.Report.OriginalGroup.GroupStatus = StatusRejected
+	case len(txs):
+		report.Report.OriginalGroup.GroupStatus = StatusAccepted
+	default:
+		report.Report.OriginalGroup.GroupStatus = StatusPartiallyAccepted
+	}
+
+	return report
+}
+
+// Marshal renders the report as an XML document
+func (p *Pain002) Marshal() ([]byte, error) {
+	body, err := xml.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,30 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const BusinessDayType = "BusinessDay"
+
+// BusinessDay is a day a scheme processes payments in a currency, and the time they must arrive by
+type BusinessDay struct {
+	PaymentScheme string     `json:"payment_scheme"`
+	Currency      string     `json:"currency,omitempty"`
+	Date          string     `json:"date"`
+	CutOff        *time.Time `json:"cut_off,omitempty"`
+}
+
+// NewBusinessDayDocument represents a business day, identified by its scheme and date
+func NewBusinessDayDocument(day BusinessDay, self string) Document {
+	attributes, _ := json.Marshal(day)
+	return Document{
+		Data: Resource{
+			Type:       BusinessDayType,
+			ID:         day.PaymentScheme + ":" + day.Date,
+			Attributes: attributes,
+		},
+		Links:   &Links{Self: self},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
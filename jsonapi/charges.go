@@ -0,0 +1,13 @@
+package jsonapi
+
+import "github.com/clD11/form3-payments/model"
+
+// NewChargesPreviewDocument is a meta document with the charges a draft payment would be created
+// with and the name of the fee rule that priced it, which is omitted when no rule matched
+func NewChargesPreviewDocument(charges model.ChargesInformation, rule string) Document {
+	meta := map[string]interface{}{"charges_information": charges}
+	if rule != "" {
+		meta["fee_rule"] = rule
+	}
+	return Document{Meta: meta, JSONAPI: &Implementation{Version: Version}}
+}
@@ -0,0 +1,38 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	"net/http"
+)
+
+const FxQuoteType = "FxQuote"
+
+// QuoteRequest asks for the price of converting Amount in Currency into OriginalCurrency
+type QuoteRequest struct {
+	Amount           string `json:"amount"`
+	Currency         string `json:"currency"`
+	OriginalCurrency string `json:"original_currency"`
+}
+
+// NewFxQuoteResource represents a quote, identified by the contract reference payments book it with
+func NewFxQuoteResource(quote model.FxQuote) Resource {
+	attributes, _ := json.Marshal(quote)
+	return Resource{
+		Type:       FxQuoteType,
+		ID:         quote.ContractReference,
+		Attributes: attributes,
+	}
+}
+
+// QuoteRequest decodes a quote request from a request resource
+func (r *Resource) QuoteRequest() (QuoteRequest, *Error) {
+	var request QuoteRequest
+	if r.Type != FxQuoteType {
+		return request, NewError(http.StatusConflict, "invalid_type", "Resource type must be "+FxQuoteType).WithPointer("/data/type")
+	}
+	if err := json.Unmarshal(r.Attributes, &request); err != nil {
+		return request, NewError(http.StatusBadRequest, "invalid_attributes", "Could not decode quote attributes").WithPointer("/data/attributes")
+	}
+	return request, nil
+}
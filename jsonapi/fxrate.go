@@ -0,0 +1,49 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	"net/http"
+	"time"
+)
+
+const FxRateType = "FxRate"
+
+// FxRatesLink is the collection of stored rates
+const FxRatesLink = "/v1/fx/rates"
+
+// NewFxRateResource represents a stored rate, identified by its pair and effective time
+func NewFxRateResource(rate model.FxRate) Resource {
+	attributes, _ := json.Marshal(rate)
+	return Resource{
+		Type:       FxRateType,
+		ID:         rate.BaseCurrency + rate.QuoteCurrency + ":" + rate.EffectiveAt.UTC().Format(time.RFC3339),
+		Attributes: attributes,
+	}
+}
+
+// NewFxRatesDocument wraps a list of rates in a document
+func NewFxRatesDocument(rates []model.FxRate, self string) Document {
+	resources := make([]Resource, len(rates))
+	for i, rate := range rates {
+		resources[i] = NewFxRateResource(rate)
+	}
+	return Document{
+		Data:    resources,
+		Links:   &Links{Self: self},
+		Meta:    map[string]interface{}{"count": len(rates)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
+
+// FxRate decodes a rate from a request resource
+func (r *Resource) FxRate() (model.FxRate, *Error) {
+	var rate model.FxRate
+	if r.Type != FxRateType {
+		return rate, NewError(http.StatusConflict, "invalid_type", "Resource type must be "+FxRateType).WithPointer("/data/type")
+	}
+	if err := json.Unmarshal(r.Attributes, &rate); err != nil {
+		return rate, NewError(http.StatusBadRequest, "invalid_attributes", "Could not decode rate attributes").WithPointer("/data/attributes")
+	}
+	return rate, nil
+}
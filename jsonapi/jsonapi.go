@@ -0,0 +1,246 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/strictjson"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+const (
+	MediaType = "application/vnd.api+json"
+	Version   = "1.0"
+)
+
+// Document is a top level JSON:API document. Exactly one of Data, Errors or Meta is expected.
+type Document struct {
+	Data    interface{}            `json:"data,omitempty"`
+	Errors  []Error                `json:"errors,omitempty"`
+	Links   *Links                 `json:"links,omitempty"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	JSONAPI *Implementation        `json:"jsonapi,omitempty"`
+}
+
+type Implementation struct {
+	Version string `json:"version"`
+}
+
+type Links struct {
+	Self  string `json:"self,omitempty"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Resource is a resource object. Attributes are kept raw so they can be decoded onto an existing value,
+// which gives PATCH requests their partial update semantics.
+type Resource struct {
+	Type          string                  `json:"type"`
+	ID            string                  `json:"id,omitempty"`
+	Attributes    json.RawMessage         `json:"attributes,omitempty"`
+	Relationships map[string]Relationship `json:"relationships,omitempty"`
+	Links         *Links                  `json:"links,omitempty"`
+	Meta          *ResourceMeta           `json:"meta,omitempty"`
+}
+
+type ResourceMeta struct {
+	Version *uint `json:"version,omitempty"`
+}
+
+type Relationship struct {
+	Data *ResourceIdentifier `json:"data"`
+}
+
+type ResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Error is an error object as described in https://jsonapi.org/format/#error-objects
+type Error struct {
+	Status string       `json:"status"`
+	Code   string       `json:"code,omitempty"`
+	Title  string       `json:"title,omitempty"`
+	Detail string       `json:"detail,omitempty"`
+	Source *ErrorSource `json:"source,omitempty"`
+	// Meta holds the byte offset into the request body of decoding errors
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// NewError builds an error object for the status, using the status text as its title
+func NewError(status int, code, detail string) *Error {
+	return &Error{
+		Status: strconv.Itoa(status),
+		Code:   code,
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+// WithPointer records the JSON pointer into the request document that caused the error
+func (e *Error) WithPointer(pointer string) *Error {
+	e.Source = &ErrorSource{Pointer: pointer}
+	return e
+}
+
+// WithParameter records the query parameter that caused the error
+func (e *Error) WithParameter(parameter string) *Error {
+	e.Source = &ErrorSource{Parameter: parameter}
+	return e
+}
+
+// WithOffset records the byte offset into the request body where decoding failed
+func (e *Error) WithOffset(offset int64) *Error {
+	if e.Meta == nil {
+		e.Meta = map[string]interface{}{}
+	}
+	e.Meta["offset"] = offset
+	return e
+}
+
+// Offset returns the byte offset recorded by WithOffset
+func (e *Error) Offset() (int64, bool) {
+	switch offset := e.Meta["offset"].(type) {
+	case int64:
+		return offset, true
+	case float64:
+		return int64(offset), true
+	}
+	return 0, false
+}
+
+// StatusCode returns the HTTP status of the error
+func (e *Error) StatusCode() int {
+	status, _ := strconv.Atoi(e.Status)
+	return status
+}
+
+var (
+	topLevelMembers = map[string]bool{"data": true, "meta": true, "jsonapi": true, "links": true, "included": true}
+	resourceMembers = map[string]bool{"type": true, "id": true, "attributes": true, "relationships": true, "links": true, "meta": true}
+)
+
+// DecodeResource reads a request document containing a single resource object, rejecting documents
+// that do not follow the JSON:API structure. The document must be strictly valid JSON without
+// repeated members, and the members of the resources the API accepts must be known and of the right type.
+func DecodeResource(r io.Reader) (*Resource, *Error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Could not read request body")
+	}
+	top, err := strictjson.Parse(body)
+	if err != nil {
+		return nil, strictError(err)
+	}
+	if top.Kind != strictjson.Object {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Could not decode request body").WithPointer("")
+	}
+	for _, member := range top.Members {
+		if !topLevelMembers[member.Name] {
+			return nil, NewError(http.StatusBadRequest, "invalid_document",
+				fmt.Sprintf("%q is not a top-level member of a JSON:API document", member.Name)).WithPointer("/" + strictjson.Escape(member.Name))
+		}
+	}
+
+	data := top.Member("data")
+	if data == nil {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Request document must contain data").WithPointer("")
+	}
+	if data.Kind != strictjson.Object {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Primary data must be a single resource object").WithPointer("/data")
+	}
+	for _, member := range data.Members {
+		if !resourceMembers[member.Name] {
+			return nil, NewError(http.StatusBadRequest, "invalid_document",
+				fmt.Sprintf("%q is not a member of a resource object", member.Name)).WithPointer("/data/" + strictjson.Escape(member.Name))
+		}
+	}
+	if err := strictjson.Check(data, resourceType, "/data"); err != nil {
+		return nil, strictError(err)
+	}
+
+	var document struct {
+		Data Resource `json:"data"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Could not decode resource object").WithPointer("/data")
+	}
+	resource := document.Data
+	if resource.Type == "" {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Resource object must have a type").WithPointer("/data/type")
+	}
+	attributes := data.Member("attributes")
+	if attributes != nil && attributes.Kind != strictjson.Object {
+		return nil, NewError(http.StatusBadRequest, "invalid_document", "Attributes must be an object").WithPointer("/data/attributes")
+	}
+	if attributesType, ok := attributeTypes[resource.Type]; ok && attributes != nil {
+		if err := strictjson.Check(attributes, attributesType, "/data/attributes"); err != nil {
+			return nil, strictError(err)
+		}
+	}
+	return &resource, nil
+}
+
+var (
+	resourceType = reflect.TypeOf(Resource{})
+	// attributeTypes are the attributes of each resource type the API accepts
+	attributeTypes = map[string]reflect.Type{
+		PaymentType: reflect.TypeOf(model.Attributes{}),
+		FxRateType:  reflect.TypeOf(model.FxRate{}),
+		FxQuoteType: reflect.TypeOf(QuoteRequest{}),
+		// the server keeps the planned dates and counts, members it does not take are ignored
+		StandingOrderType: reflect.TypeOf(model.StandingOrder{}),
+		MandateType:       reflect.TypeOf(model.Mandate{}),
+	}
+)
+
+// strictErrorCodes are the stable codes for each way strict decoding rejects a document
+var strictErrorCodes = map[strictjson.ErrorKind]string{
+	strictjson.SyntaxError:     "invalid_json",
+	strictjson.DuplicateMember: "duplicate_member",
+	strictjson.UnknownMember:   "unknown_member",
+	strictjson.TypeMismatch:    "invalid_member_type",
+}
+
+func strictError(err error) *Error {
+	e := err.(*strictjson.Error)
+	return NewError(http.StatusBadRequest, strictErrorCodes[e.Kind], e.Message).WithPointer(e.Pointer).WithOffset(e.Offset)
+}
+
+// DecodeDocument reads a response document, returning its errors as an error value
+func DecodeDocument(r io.Reader, data interface{}) (*Document, error) {
+	raw := struct {
+		Data   json.RawMessage        `json:"data"`
+		Errors []Error                `json:"errors"`
+		Links  *Links                 `json:"links"`
+		Meta   map[string]interface{} `json:"meta"`
+	}{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	doc := &Document{Errors: raw.Errors, Links: raw.Links, Meta: raw.Meta}
+	if len(raw.Errors) > 0 {
+		return doc, &raw.Errors[0]
+	}
+	if data != nil && len(raw.Data) > 0 {
+		if err := json.Unmarshal(raw.Data, data); err != nil {
+			return doc, err
+		}
+		doc.Data = data
+	}
+	return doc, nil
+}
@@ -0,0 +1,86 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeResourceShouldRejectInvalidDocuments(t *testing.T) {
+	for body, pointer := range map[string]string{
+		`{"payment":{}}`:                              "/payment",
+		`{"meta":{}}`:                                 "",
+		`{"data":[]}`:                                 "/data",
+		`{"data":{"id":"1"}}`:                         "/data/type",
+		`{"data":{"type":"Payment","amount":1}}`:      "/data/amount",
+		`{"data":{"type":"Payment","attributes":[]}}`: "/data/attributes",
+	} {
+		_, err := DecodeResource(strings.NewReader(body))
+
+		assert.Equal(t, "400", err.Status, body)
+		assert.Equal(t, pointer, err.Source.Pointer, body)
+	}
+}
+
+func TestDecodeResourceShouldLocateStrictDecodingErrors(t *testing.T) {
+	for body, expected := range map[string]struct {
+		code    string
+		pointer string
+		offset  int64
+	}{
+		`{"data":{"type":"Payment"}} x`:                                       {"invalid_json", "", 28},
+		`{"data":{"type":"Payment","type":"Account"}}`:                        {"duplicate_member", "/data/type", 26},
+		`{"data":{"type":"Payment","attributes":{"amount":"1","amont":"2"}}}`: {"unknown_member", "/data/attributes/amont", 53},
+		`{"data":{"type":"Payment","attributes":{"amount":1}}}`:               {"invalid_member_type", "/data/attributes/amount", 49},
+		`{"data":{"type":"Payment","meta":{"version":-1}}}`:                   {"invalid_member_type", "/data/meta/version", 44},
+	} {
+		_, err := DecodeResource(strings.NewReader(body))
+
+		assert.Equal(t, expected.code, err.Code, body)
+		assert.Equal(t, expected.pointer, err.Source.Pointer, body)
+		offset, ok := err.Offset()
+		assert.True(t, ok, body)
+		assert.Equal(t, expected.offset, offset, body)
+	}
+}
+
+func TestApplyToShouldRejectOtherResourceTypes(t *testing.T) {
+	resource, _ := DecodeResource(strings.NewReader(`{"data":{"type":"Account"}}`))
+
+	err := resource.ApplyTo(&model.Payment{})
+
+	assert.Equal(t, http.StatusConflict, err.StatusCode())
+	assert.Equal(t, "/data/type", err.Source.Pointer)
+}
+
+func TestApplyToShouldLeaveVersionToServer(t *testing.T) {
+	resource, _ := DecodeResource(strings.NewReader(`{"data":{"type":"Payment","meta":{"version":7}}}`))
+	payment := model.Payment{Version: 2}
+
+	assert.Nil(t, resource.ApplyTo(&payment))
+	assert.Equal(t, uint(2), payment.Version)
+}
+
+func TestPaymentShouldRoundTripThroughDocument(t *testing.T) {
+	version := uint(3)
+	payment := model.Payment{
+		Type:           PaymentType,
+		ID:             uuid.NewV4(),
+		Version:        version,
+		OrganisationID: uuid.NewV4(),
+		Attributes:     model.Attributes{Amount: "10.00", Currency: "GBP"},
+	}
+
+	body, _ := json.Marshal(NewPaymentDocument(payment))
+	actual, err := DecodePayment(bytes.NewReader(body))
+
+	assert.NoError(t, err)
+	assert.Equal(t, payment, actual)
+	assert.Contains(t, string(body), `"relationships":{"organisation":{"data":{"type":"organisations","id":"`+payment.OrganisationID.String()+`"}}}`)
+	assert.Contains(t, string(body), `"meta":{"version":3}`)
+}
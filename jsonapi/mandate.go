@@ -0,0 +1,94 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"strconv"
+)
+
+const (
+	MandateType      = "Mandate"
+	MandateEventType = "MandateEvent"
+)
+
+// MandateLink is the canonical URL of a mandate
+func MandateLink(id uuid.UUID) string {
+	return "/v1/mandates/" + id.String()
+}
+
+// NewMandateResource represents a mandate with the owning organisation as a relationship
+func NewMandateResource(m model.Mandate) Resource {
+	attributes, _ := json.Marshal(m)
+	return Resource{
+		Type:       MandateType,
+		ID:         m.ID.String(),
+		Attributes: attributes,
+		Relationships: map[string]Relationship{
+			"organisation": {Data: &ResourceIdentifier{Type: OrganisationType, ID: m.OrganisationID.String()}},
+		},
+		Links: &Links{Self: MandateLink(m.ID)},
+	}
+}
+
+// NewMandateDocument wraps a single mandate in a document
+func NewMandateDocument(m model.Mandate) Document {
+	return Document{
+		Data:    NewMandateResource(m),
+		Links:   &Links{Self: MandateLink(m.ID)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
+
+// NewMandateEventResource represents an event in a mandate's history, identified by the mandate
+// and its sequence
+func NewMandateEventResource(event model.MandateEvent) Resource {
+	attributes, _ := json.Marshal(event)
+	return Resource{
+		Type:       MandateEventType,
+		ID:         event.MandateID.String() + ":" + strconv.Itoa(event.Sequence),
+		Attributes: attributes,
+		Relationships: map[string]Relationship{
+			"mandate": {Data: &ResourceIdentifier{Type: MandateType, ID: event.MandateID.String()}},
+		},
+	}
+}
+
+// NewMandateEventsDocument wraps the history of a mandate in a document
+func NewMandateEventsDocument(events []model.MandateEvent, self string) Document {
+	resources := make([]Resource, len(events))
+	for i, event := range events {
+		resources[i] = NewMandateEventResource(event)
+	}
+	return Document{
+		Data:    resources,
+		Links:   &Links{Self: self},
+		Meta:    map[string]interface{}{"count": len(events)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
+
+// ApplyToMandate copies the members present in the resource onto the mandate, decoding attributes
+// over its existing ones so members left out keep their current values
+func (r *Resource) ApplyToMandate(m *model.Mandate) *Error {
+	if r.Type != MandateType {
+		return NewError(http.StatusConflict, "invalid_type", "Resource type must be "+MandateType).WithPointer("/data/type")
+	}
+	if r.ID != "" {
+		id, err := uuid.FromString(r.ID)
+		if err != nil {
+			return NewError(http.StatusBadRequest, "invalid_id", "Invalid ID").WithPointer("/data/id")
+		}
+		m.ID = id
+	}
+	if err := r.applyOrganisation(&m.OrganisationID); err != nil {
+		return err
+	}
+	if len(r.Attributes) > 0 {
+		if err := json.Unmarshal(r.Attributes, m); err != nil {
+			return NewError(http.StatusBadRequest, "invalid_attributes", "Could not decode mandate attributes").WithPointer("/data/attributes")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"net/http"
+)
+
+const (
+	PaymentType      = "Payment"
+	OrganisationType = "organisations"
+)
+
+// PaymentLink is the canonical URL of a payment
+func PaymentLink(id uuid.UUID) string {
+	return "/v1/payments/" + id.String()
+}
+
+// NewPaymentResource represents a payment as a resource object, with its version in meta and the
+// owning organisation as a relationship
+func NewPaymentResource(p model.Payment) Resource {
+	attributes, _ := json.Marshal(p.Attributes)
+	version := p.Version
+	resourceType := p.Type
+	if resourceType == "" {
+		resourceType = PaymentType
+	}
+	return Resource{
+		Type:       resourceType,
+		ID:         p.ID.String(),
+		Attributes: attributes,
+		Relationships: map[string]Relationship{
+			"organisation": {Data: &ResourceIdentifier{Type: OrganisationType, ID: p.OrganisationID.String()}},
+		},
+		Links: &Links{Self: PaymentLink(p.ID)},
+		Meta:  &ResourceMeta{Version: &version},
+	}
+}
+
+// NewPaymentDocument wraps a single payment in a document
+func NewPaymentDocument(p model.Payment) Document {
+	return Document{
+		Data:    NewPaymentResource(p),
+		Links:   &Links{Self: PaymentLink(p.ID)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
+
+// NewPaymentsDocument wraps a list of payments in a document
+func NewPaymentsDocument(payments []model.Payment, self string) Document {
+	resources := make([]Resource, len(payments))
+	for i, p := range payments {
+		resources[i] = NewPaymentResource(p)
+	}
+	return Document{
+		Data:    resources,
+		Links:   &Links{Self: self},
+		Meta:    map[string]interface{}{"count": len(payments)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
+
+// ApplyTo copies the members present in the resource onto the payment. Attributes are decoded over
+// the payment's existing attributes so members left out of the request keep their current values.
+// The version is the server's to set and is left alone.
+func (r *Resource) ApplyTo(p *model.Payment) *Error {
+	if r.Type != PaymentType {
+		return NewError(http.StatusConflict, "invalid_type", "Resource type must be "+PaymentType).WithPointer("/data/type")
+	}
+	p.Type = r.Type
+
+	if r.ID != "" {
+		id, err := uuid.FromString(r.ID)
+		if err != nil {
+			return NewError(http.StatusBadRequest, "invalid_id", "Invalid ID").WithPointer("/data/id")
+		}
+		p.ID = id
+	}
+
+	if err := r.applyOrganisation(&p.OrganisationID); err != nil {
+		return err
+	}
+
+	if len(r.Attributes) > 0 {
+		if err := json.Unmarshal(r.Attributes, &p.Attributes); err != nil {
+			return NewError(http.StatusBadRequest, "invalid_attributes", "Could not decode payment attributes").WithPointer("/data/attributes")
+		}
+	}
+	return nil
+}
+
+// applyOrganisation copies the ID of the organisation relationship when the resource has one
+func (r *Resource) applyOrganisation(organisationID *uuid.UUID) *Error {
+	organisation, ok := r.Relationships["organisation"]
+	if !ok {
+		return nil
+	}
+	if organisation.Data == nil || organisation.Data.Type != OrganisationType {
+		return NewError(http.StatusBadRequest, "invalid_relationship", "Organisation relationship must reference an "+OrganisationType+" resource").
+			WithPointer("/data/relationships/organisation/data")
+	}
+	id, err := uuid.FromString(organisation.Data.ID)
+	if err != nil {
+		return NewError(http.StatusBadRequest, "invalid_id", "Invalid organisation ID").WithPointer("/data/relationships/organisation/data/id")
+	}
+	*organisationID = id
+	return nil
+}
+
+// Payment converts a resource from a response document back into a payment
+func (r *Resource) Payment() (model.Payment, error) {
+	var p model.Payment
+	if err := r.ApplyTo(&p); err != nil {
+		return p, err
+	}
+	if r.Meta != nil && r.Meta.Version != nil {
+		p.Version = *r.Meta.Version
+	}
+	return p, nil
+}
+
+// DecodePayment reads a response document holding a single payment
+func DecodePayment(r io.Reader) (model.Payment, error) {
+	var resource Resource
+	if _, err := DecodeDocument(r, &resource); err != nil {
+		return model.Payment{}, err
+	}
+	return resource.Payment()
+}
+
+// DecodePayments reads a response document holding a list of payments
+func DecodePayments(r io.Reader) ([]model.Payment, *Document, error) {
+	var resources []Resource
+	doc, err := DecodeDocument(r, &resources)
+	if err != nil {
+		return nil, doc, err
+	}
+	payments := make([]model.Payment, len(resources))
+	for i := range resources {
+		if payments[i], err = resources[i].Payment(); err != nil {
+			return nil, doc, err
+		}
+	}
+	return payments, doc, nil
+}
+
+// EncodePayment renders a payment as a request document
+func EncodePayment(p model.Payment) ([]byte, error) {
+	resource := NewPaymentResource(p)
+	resource.Links = nil
+	return json.Marshal(Document{Data: resource})
+}
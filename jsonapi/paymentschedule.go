@@ -0,0 +1,36 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+)
+
+const PaymentScheduleType = "PaymentSchedule"
+
+// NewPaymentScheduleResource represents a schedule, identified by and related to its payment
+func NewPaymentScheduleResource(schedule model.PaymentSchedule) Resource {
+	attributes, _ := json.Marshal(schedule)
+	return Resource{
+		Type:       PaymentScheduleType,
+		ID:         schedule.PaymentID.String(),
+		Attributes: attributes,
+		Relationships: map[string]Relationship{
+			"payment": {Data: &ResourceIdentifier{Type: PaymentType, ID: schedule.PaymentID.String()}},
+		},
+		Links: &Links{Self: PaymentLink(schedule.PaymentID)},
+	}
+}
+
+// NewPaymentSchedulesDocument wraps a list of schedules in a document
+func NewPaymentSchedulesDocument(schedules []model.PaymentSchedule, self string) Document {
+	resources := make([]Resource, len(schedules))
+	for i, schedule := range schedules {
+		resources[i] = NewPaymentScheduleResource(schedule)
+	}
+	return Document{
+		Data:    resources,
+		Links:   &Links{Self: self},
+		Meta:    map[string]interface{}{"count": len(schedules)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
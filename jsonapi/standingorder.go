@@ -0,0 +1,72 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+)
+
+const StandingOrderType = "StandingOrder"
+
+// StandingOrderLink is the canonical URL of a standing order
+func StandingOrderLink(id uuid.UUID) string {
+	return "/v1/standing-orders/" + id.String()
+}
+
+// NewStandingOrderResource represents a standing order with the owning organisation as a relationship
+func NewStandingOrderResource(order model.StandingOrder) Resource {
+	attributes, _ := json.Marshal(order)
+	return Resource{
+		Type:       StandingOrderType,
+		ID:         order.ID.String(),
+		Attributes: attributes,
+		Relationships: map[string]Relationship{
+			"organisation": {Data: &ResourceIdentifier{Type: OrganisationType, ID: order.OrganisationID.String()}},
+		},
+		Links: &Links{Self: StandingOrderLink(order.ID)},
+	}
+}
+
+// NewStandingOrderDocument wraps a single standing order in a document
+func NewStandingOrderDocument(order model.StandingOrder) Document {
+	return Document{
+		Data:    NewStandingOrderResource(order),
+		Links:   &Links{Self: StandingOrderLink(order.ID)},
+		JSONAPI: &Implementation{Version: Version},
+	}
+}
+
+// NewStandingOrderPaymentsDocument wraps the payments a standing order made in a document, each
+// related back to the order
+func NewStandingOrderPaymentsDocument(id uuid.UUID, payments []model.Payment, self string) Document {
+	document := NewPaymentsDocument(payments, self)
+	for _, resource := range document.Data.([]Resource) {
+		resource.Relationships["standing_order"] = Relationship{Data: &ResourceIdentifier{Type: StandingOrderType, ID: id.String()}}
+	}
+	return document
+}
+
+// ApplyToStandingOrder copies the members present in the resource onto the standing order, decoding
+// attributes over its existing ones so members left out keep their current values
+func (r *Resource) ApplyToStandingOrder(order *model.StandingOrder) *Error {
+	if r.Type != StandingOrderType {
+		return NewError(http.StatusConflict, "invalid_type", "Resource type must be "+StandingOrderType).WithPointer("/data/type")
+	}
+	if r.ID != "" {
+		id, err := uuid.FromString(r.ID)
+		if err != nil {
+			return NewError(http.StatusBadRequest, "invalid_id", "Invalid ID").WithPointer("/data/id")
+		}
+		order.ID = id
+	}
+	if err := r.applyOrganisation(&order.OrganisationID); err != nil {
+		return err
+	}
+	if len(r.Attributes) > 0 {
+		if err := json.Unmarshal(r.Attributes, order); err != nil {
+			return NewError(http.StatusBadRequest, "invalid_attributes", "Could not decode standing order attributes").WithPointer("/data/attributes")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package logging writes structured JSON log lines with levels and request scoped fields
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level name such as "info", case insensitively
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level %q, use one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Logger writes one JSON object per line holding the time, level, message and its fields
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	now   func() time.Time
+}
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, level: level, now: time.Now}}
+}
+
+// Default is used outside requests and by requests without a logger in their context
+var Default = New(os.Stderr, Info)
+
+// SetLevel changes the minimum level written by the logger and every logger derived from it
+func (l *Logger) SetLevel(level Level) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.level = level
+}
+
+// With returns a logger that adds the key value pairs to every line
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) { l.log(Debug, msg, keyValues) }
+func (l *Logger) Info(msg string, keyValues ...interface{})  { l.log(Info, msg, keyValues) }
+func (l *Logger) Warn(msg string, keyValues ...interface{})  { l.log(Warn, msg, keyValues) }
+func (l *Logger) Error(msg string, keyValues ...interface{}) { l.log(Error, msg, keyValues) }
+
+// Fatal logs at error level and exits
+func (l *Logger) Fatal(msg string, keyValues ...interface{}) {
+	l.log(Error, msg, keyValues)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	if level < l.out.level {
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeValue(&b, l.out.now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeValue(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeValue(&b, msg)
+	writeFields(&b, l.fields)
+	writeFields(&b, keyValues)
+	b.WriteString("}\n")
+	l.out.w.Write(b.Bytes())
+}
+
+func writeFields(b *bytes.Buffer, keyValues []interface{}) {
+	for i := 0; i < len(keyValues); i += 2 {
+		key := fmt.Sprint(keyValues[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(keyValues) {
+			value = keyValues[i+1]
+		}
+		b.WriteString(",")
+		writeValue(b, key)
+		b.WriteString(":")
+		writeValue(b, value)
+	}
+}
+
+func writeValue(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.Seconds()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(data)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger of the context, or Default
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerShouldWriteJSONLineWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Info)
+	logger.out.now = func() time.Time { return time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	logger.With("request_id", "abc").Error("could not insert", "error", errors.New("duplicate key"), "took", 1500*time.Millisecond)
+
+	assert.JSONEq(t, `{"time":"2019-05-01T12:00:00Z","level":"error","msg":"could not insert","request_id":"abc","error":"duplicate key","took":1.5}`, buf.String())
+	assert.True(t, strings.HasSuffix(buf.String(), "}\n"))
+}
+
+func TestLoggerShouldSkipLinesBelowLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Warn)
+
+	logger.Info("ignored")
+	logger.Debug("ignored")
+	assert.Empty(t, buf.String())
+
+	logger.SetLevel(Debug)
+	logger.Debug("written")
+	assert.Contains(t, buf.String(), `"msg":"written"`)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, Warn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.EqualError(t, err, `unknown log level "verbose", use one of debug, info, warn, error`)
+}
+
+func TestMiddlewareShouldKeepValidRequestID(t *testing.T) {
+	buf, restore := useDefault()
+	defer restore()
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/v1/payments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Error("lookup failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/payments/42", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, "req-123", rr.Header().Get(RequestIDHeader))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"msg":"lookup failed","request_id":"req-123","method":"GET","route":"/v1/payments/{id}"`)
+	assert.Contains(t, lines[1], `"msg":"request completed"`)
+	assert.Contains(t, lines[1], `"status":500`)
+}
+
+func TestMiddlewareShouldReplaceInvalidRequestID(t *testing.T) {
+	_, restore := useDefault()
+	defer restore()
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n{}")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	requestID := rr.Header().Get(RequestIDHeader)
+	assert.NotEqual(t, "bad id\n{}", requestID)
+	assert.Len(t, requestID, 36)
+}
+
+// useDefault points the default logger at a buffer until restore is called
+func useDefault() (buf *bytes.Buffer, restore func()) {
+	buf = &bytes.Buffer{}
+	previous := Default
+	Default = New(buf, Info)
+	return buf, func() { Default = previous }
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"github.com/clD11/form3-payments/httpstatus"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits accepted IDs so clients cannot inject arbitrary text into the logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware accepts the caller's X-Request-ID or generates one, echoes it on the response and puts a
+// logger carrying the request ID, method and route in the request context. Every request is logged
+// once it completes.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewV4().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		logger := Default.With("request_id", requestID, "method", r.Method, "route", route)
+		recorder := httpstatus.NewRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(NewContext(r.Context(), logger)))
+
+		logger.Info("request completed", "path", r.URL.Path, "status", recorder.Status, "duration_seconds", time.Since(start))
+	})
+}
@@ -1,11 +1,40 @@
 package main
 
 import (
+	"context"
 	"github.com/clD11/form3-payments/app"
+	"github.com/clD11/form3-payments/bacs"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/charges"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/ratelimit"
+	"github.com/clD11/form3-payments/routing"
 	"github.com/go-pg/pg"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
+	// generate only writes JSON so it runs without a database
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		if err := generateSeed(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if name := os.Getenv("LOG_LEVEL"); name != "" {
+		level, err := logging.ParseLevel(name)
+		if err != nil {
+			log.Fatalf("LOG_LEVEL: %s", err)
+		}
+		logging.Default.SetLevel(level)
+	}
+
 	config := app.Config{
 		DB: &pg.Options{
 			Addr:     "postgres:5432",
@@ -13,8 +42,135 @@ func main() {
 			User:     "postgres",
 			Password: "postgres",
 		},
+		BacsServiceUserNumber: os.Getenv("BACS_SERVICE_USER_NUMBER"),
+		ValidateOpenAPI:       os.Getenv("OPENAPI_VALIDATION") == "true",
+		ReadTimeout:           durationEnv("HTTP_READ_TIMEOUT"),
+		WriteTimeout:          durationEnv("HTTP_WRITE_TIMEOUT"),
+		IdleTimeout:           durationEnv("HTTP_IDLE_TIMEOUT"),
+		ShutdownTimeout:       durationEnv("SHUTDOWN_TIMEOUT"),
+		SchedulerInterval:     durationEnv("SCHEDULER_INTERVAL"),
+		StandingOrderInterval: durationEnv("STANDING_ORDER_INTERVAL"),
+		DBStartupTimeout:      durationEnv("DB_STARTUP_TIMEOUT"),
+		TracesExporter:        os.Getenv("OTEL_TRACES_EXPORTER"),
+		OTLPEndpoint:          os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName:           os.Getenv("OTEL_SERVICE_NAME"),
+		SharedRateLimits:      os.Getenv("RATE_LIMIT_STORE") == "postgres",
+		FxQuoteTTL:            durationEnv("FX_QUOTE_TTL"),
+	}
+	if config.BacsServiceUserNumber != "" {
+		if err := bacs.ValidateServiceUserNumber(config.BacsServiceUserNumber); err != nil {
+			log.Fatalf("BACS_SERVICE_USER_NUMBER: %s", err)
+		}
+	}
+	if value := os.Getenv("RATE_LIMIT"); value != "" {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			log.Fatalf("RATE_LIMIT: %s", err)
+		}
+		config.RateLimit = limit
+	}
+	if value := os.Getenv("RATE_LIMIT_PER_IP"); value != "" {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			log.Fatalf("RATE_LIMIT_PER_IP: %s", err)
+		}
+		config.IPRateLimit = limit
+	}
+	config.RateLimitAPIKeys = listEnv("RATE_LIMIT_API_KEYS")
+	routes, err := ratelimit.ParseRoutes(os.Getenv("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		log.Fatalf("RATE_LIMIT_ROUTES: %s", err)
+	}
+	config.RouteRateLimits = routes
+	config.MaxBodyBytes = bytesEnv("MAX_BODY_BYTES")
+	config.MaxImportBytes = bytesEnv("MAX_IMPORT_BYTES")
+	rounding, err := fx.ParseRounding(os.Getenv("FX_ROUNDING"))
+	if err != nil {
+		log.Fatalf("FX_ROUNDING: %s", err)
+	}
+	config.FxRounding = rounding
+	if value := os.Getenv("FX_RATE_TOLERANCE"); value != "" {
+		tolerance, err := strconv.ParseFloat(value, 64)
+		if err != nil || tolerance <= 0 {
+			log.Fatalf("FX_RATE_TOLERANCE: must be a positive fraction of the stored rate such as 0.005")
+		}
+		config.FxTolerance = tolerance
+	}
+	if path := os.Getenv("FEE_SCHEDULE_FILE"); path != "" {
+		schedule, err := charges.LoadSchedule(path)
+		if err != nil {
+			log.Fatalf("FEE_SCHEDULE_FILE: %s", err)
+		}
+		config.FeeSchedule = schedule
+	}
+	if path := os.Getenv("ROUTING_TABLE_FILE"); path != "" {
+		table, err := routing.LoadTable(path)
+		if err != nil {
+			log.Fatalf("ROUTING_TABLE_FILE: %s", err)
+		}
+		config.RoutingTable = table
+	}
+	rule, err := calendar.ParseDateRule(os.Getenv("PROCESSING_DATE_RULE"))
+	if err != nil {
+		log.Fatalf("PROCESSING_DATE_RULE: %s", err)
+	}
+	config.ProcessingDateRule = rule
+	if dir := os.Getenv("CALENDAR_DIR"); dir != "" {
+		calendars, err := calendar.Load(dir)
+		if err != nil {
+			log.Fatalf("CALENDAR_DIR: %s", err)
+		}
+		calendars.Rule = rule
+		config.Calendars = calendars
 	}
 	a := &app.App{}
 	a.Initialize(&config)
+
+	// with no arguments serve the API, otherwise run the named command against the database
+	if len(os.Args) > 1 {
+		err := runCommand(a, os.Args[1], os.Args[2:])
+		a.Shutdown(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	a.Run(":8080")
 }
+
+// durationEnv reads a duration such as "30s" from the environment, unset means the app default
+func durationEnv(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s: %s", name, err)
+	}
+	return d
+}
+
+// bytesEnv reads a size in bytes from the environment, unset means the app default
+func bytesEnv(name string) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		log.Fatalf("%s: must be a positive number of bytes", name)
+	}
+	return n
+}
+
+// listEnv reads comma separated values from the environment, skipping empty ones
+func listEnv(name string) (values []string) {
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
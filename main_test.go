@@ -5,10 +5,28 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/clD11/form3-payments/app"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/charges"
+	"github.com/clD11/form3-payments/client"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/health"
+	"github.com/clD11/form3-payments/iso20022"
+	"github.com/clD11/form3-payments/jsonapi"
 	. "github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/paymentcsv"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/clD11/form3-payments/ratelimit"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/clD11/form3-payments/scheduler"
+	"github.com/clD11/form3-payments/seed"
+	"github.com/clD11/form3-payments/standingorder"
+	"github.com/clD11/form3-payments/tracing"
 	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
 	_ "github.com/lib/pq"
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
@@ -17,12 +35,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 var sut app.App
-var server *http.Server
 
 func TestMain(m *testing.M) {
 	// Setup database for testing
@@ -68,259 +89,1701 @@ func TestMain(m *testing.M) {
 			User:     "postgres",
 			Password: "postgres",
 		},
+		FeeSchedule: &charges.Schedule{Rules: []charges.Rule{{Name: "fps-gbp", Scheme: "FPS", Currency: "GBP", MaxAmount: "10000",
+			Sender: charges.Fee{Fixed: "0.20", Percent: "0.1"}, Receiver: charges.Fee{Fixed: "0.10"}}}},
 	}
 
 	sut = app.App{}
 	sut.Initialize(&config)
-	// Use server for testing instead of sut.RUN(port) which blocks (could use goroutine in app)
-	server = &http.Server{Addr: ":9807", Handler: sut.Router}
+	code := m.Run()
+	if err := sut.Shutdown(ctx); err != nil {
+		fmt.Println("Could not shut down app -", err)
+	}
+	os.Exit(code)
+}
+
+func TestGetPaymentShouldReturnStatusBadRequestWhenIDInvalid(t *testing.T) {
+	truncateTables(t)
+
+	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", "randomText"), nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Invalid ID", getErrorMsg(rw))
+}
+
+func TestGetPaymentShouldReturnStatusNotFoundWhenPaymentDoesNotExists(t *testing.T) {
+	truncateTables(t)
+
+	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, "Payment not found", getErrorMsg(rw))
+}
+
+func TestGetPaymentShouldReturnProblemDetailsWhenAccepted(t *testing.T) {
+	truncateTables(t)
+
+	id := uuid.NewV1()
+	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", id), nil)
+	request.Header.Set("Accept", "application/problem+json")
+	request.Header.Set("X-Request-ID", "req-42")
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+	assert.JSONEq(t, fmt.Sprintf(`{
+		"type": "/v1/problems/payment_not_found",
+		"title": "Payment not found",
+		"status": 404,
+		"detail": "Payment not found",
+		"instance": "/v1/payments/%s",
+		"code": "payment_not_found",
+		"request_id": "req-42"
+	}`, id), rw.Body.String())
+
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/problems/payment_not_found", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"status":404`)
+}
+
+func TestGetPaymentShouldReturnSinglePaymentWhenPaymentExistsIntegration(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	if err := sut.DB.Insert(&expectedPayment); err != nil {
+		t.Fatalf("Could not insert seed data payments - %s", err.Error())
+	}
+
+	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), nil)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayment, err := jsonapi.DecodePayment(rw.Body)
+	if err != nil {
+		t.Fatalf("Could not decode payment document - %s", err.Error())
+	}
+
+	expectedStatusCode := http.StatusOK
+	actualStatusCode := rw.Code
+
+	assert.Equal(t, expectedStatusCode, actualStatusCode)
+	assert.Equal(t, jsonapi.MediaType, rw.Header().Get("Content-Type"))
+	assert.Equal(t, expectedPayment, actualPayment)
+}
+
+func TestCreatePaymentShouldReturnStatusBadRequestWhenInvalidPayload(t *testing.T) {
+	truncateTables(t)
+	invalidPayload, _ := json.Marshal("{ random: 'random' }")
+
+	request := newDocumentRequest(http.MethodPost, "/v1/payments", invalidPayload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Could not decode request body", getErrorMsg(rw))
+}
+
+func TestCreatePaymentShouldReturnStatusConflictWhenPaymentAlreadyExists(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	if err := sut.DB.Insert(&expectedPayment); err != nil {
+		t.Fatalf("Could not insert seed data payments - %s", err.Error())
+	}
+
+	payload, _ := jsonapi.EncodePayment(expectedPayment)
+
+	request := newDocumentRequest(http.MethodPost, "/v1/payments", payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusConflict, rw.Code, "Expected Status Conflict")
+	assert.Equal(t, "Cannot create payment already exists", getErrorMsg(rw))
+}
+
+func TestCreatePaymentShouldReturnStatusCreated(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	payload, _ := jsonapi.EncodePayment(expectedPayment)
+
+	request := newDocumentRequest(http.MethodPost, "/v1/payments", payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), rw.Header().Get("Location"))
+
+	expectedStatusCode := http.StatusCreated
+	actualStatusCode := rw.Code
+
+	actualPayment := Payment{ID: expectedPayment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+
+	assert.Equal(t, expectedStatusCode, actualStatusCode)
+	assert.Equal(t, expectedPayment, actualPayment)
+}
+
+func TestDeletePaymentShouldReturnStatusBadRequestWhenInvalidID(t *testing.T) {
+	truncateTables(t)
+
+	request := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/payments/%s", "randomText"), nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Invalid ID", getErrorMsg(rw))
+}
+
+func TestDeletePaymentShouldReturnStatusNotFoundWhenPaymentDoesNotExist(t *testing.T) {
+	truncateTables(t)
+
+	request := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Equal(t, getErrorMsg(rw), "Payment not found cannot delete")
+}
+
+func TestDeletePaymentShouldReturnStatusNoContentWhenPaymentDeleted(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	if err := sut.DB.Insert(&expectedPayment); err != nil {
+		t.Log(err)
+	}
+
+	request := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assertPaymentDoseNotExist(t, expectedPayment.ID)
+}
+
+func TestUpdatePaymentShouldReturnStatusBadRequestWhenInvalidID(t *testing.T) {
+	truncateTables(t)
+
+	request := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", "invalidUUID"), nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Invalid ID", getErrorMsg(rw))
+}
+
+func TestUpdatePaymentShouldReturnStatusBadRequestWhenPayloadInvalid(t *testing.T) {
+	truncateTables(t)
+
+	invalidPayload, _ := json.Marshal("{ random: 'random' }")
+
+	request := newDocumentRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), invalidPayload)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "Could not decode request body", getErrorMsg(rw))
+}
+
+func TestUpdatePaymentShouldReturnStatusBadRequestWhenPayloadDoesNotMatchID(t *testing.T) {
+	truncateTables(t)
+
+	payment := createPayment()
+	payload, _ := jsonapi.EncodePayment(payment)
+
+	request := newDocumentRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Equal(t, getErrorMsg(rw), "Could not update payment - request id does not match update payment")
+	assertPaymentDoseNotExist(t, payment.ID)
+}
+
+func TestUpdatePaymentShouldReturnStatusNotFoundWhenPaymentNotInDatabase(t *testing.T) {
+	truncateTables(t)
+
+	payment := createPayment()
+	payload, _ := jsonapi.EncodePayment(payment)
+
+	request := newDocumentRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", payment.ID), payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, getErrorMsg(rw), "Could not update payment as not found")
+	assertPaymentDoseNotExist(t, payment.ID)
+}
+
+func TestUpdatePaymentShouldReturnStatusOK(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	if err := sut.DB.Insert(&expectedPayment); err != nil {
+		t.Fatalf("Could not insert payment")
+	}
+
+	payload, _ := jsonapi.EncodePayment(expectedPayment)
+	request := newDocumentRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), payload)
+	expectedPayment.Version = 1
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayment := Payment{ID: expectedPayment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Could not find payment")
+	}
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, expectedPayment, actualPayment)
+}
+
+func TestUpdatePaymentShouldOnlyChangeMembersInPatchRequest(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	if err := sut.DB.Insert(&expectedPayment); err != nil {
+		t.Fatalf("Could not insert payment")
+	}
+
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"Payment","id":"%s","attributes":{"reference":"Updated reference"}}}`, expectedPayment.ID))
+	request := newDocumentRequest(http.MethodPatch, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayment := Payment{ID: expectedPayment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Could not find payment")
+	}
+
+	expectedPayment.Attributes.Reference = "Updated reference"
+	expectedPayment.Version = 1
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, expectedPayment, actualPayment)
+}
+
+func TestUpdatePaymentShouldReturnStatusConflictWhenVersionIsStale(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayment := createPayment()
+	expectedPayment.Version = 2
+	if err := sut.DB.Insert(&expectedPayment); err != nil {
+		t.Fatalf("Could not insert payment")
+	}
+
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"Payment","id":"%s","meta":{"version":1},"attributes":{"reference":"Updated reference"}}}`,
+		expectedPayment.ID))
+	request := newDocumentRequest(http.MethodPatch, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayment := Payment{ID: expectedPayment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Could not find payment")
+	}
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"version_conflict"`)
+	assert.Contains(t, rw.Body.String(), `"pointer":"/data/meta/version"`)
+	assert.Equal(t, expectedPayment, actualPayment)
+}
+
+func TestCreatePaymentShouldReturnStatusUnsupportedMediaTypeWhenNotJSONAPI(t *testing.T) {
+	truncateTables(t)
+
+	payload, _ := jsonapi.EncodePayment(createPayment())
+	request := httptest.NewRequest(http.MethodPost, "/v1/payments", bytes.NewBuffer(payload))
+	request.Header.Set("Content-Type", jsonapi.MediaType+"; charset=utf-8")
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+}
+
+func TestGetPaymentsShouldReturnStatusNotAcceptableWhenMediaTypeHasParameters(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	request.Header.Set("Accept", jsonapi.MediaType+"; ext=bulk")
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusNotAcceptable, rw.Code)
+}
+
+func TestCreatePaymentShouldPointToInvalidMember(t *testing.T) {
+	truncateTables(t)
+
+	payload := []byte(`{"data":{"type":"Payment","amount":"10.00"}}`)
+	request := newDocumentRequest(http.MethodPost, "/v1/payments", payload)
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	var doc jsonapi.Document
+	json.NewDecoder(rw.Body).Decode(&doc)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "invalid_document", doc.Errors[0].Code)
+	assert.Equal(t, "/data/amount", doc.Errors[0].Source.Pointer)
+}
+
+func TestGetPaymentShouldReturnAllPayments(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayments := createPayments()
+	for _, payment := range expectedPayments {
+		if err := sut.DB.Insert(&payment); err != nil {
+			t.Fatalf("Could not insert seed data payments - %s", err.Error())
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayments, _, err := jsonapi.DecodePayments(rw.Body)
+	if err != nil {
+		t.Fatalf("Could not decode payments document - %s", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, expectedPayments, actualPayments)
+}
+
+func TestImportPain001ShouldCreateValidPaymentsAndReturnStatusReport(t *testing.T) {
+	truncateTables(t)
+
+	document, _ := ioutil.ReadFile("iso20022/testdata/pain001.xml")
+	organisationID := uuid.NewV1()
+
+	request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/payments/pain001?organisation_id=%s", organisationID), bytes.NewBuffer(document))
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	var report iso20022.Pain002
+	xml.NewDecoder(rw.Body).Decode(&report)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, iso20022.StatusPartiallyAccepted, report.Report.OriginalGroup.GroupStatus)
+
+	var payments []Payment
+	if err := sut.DB.Model(&payments).Select(); err != nil {
+		t.Fatalf("Could not select payments")
+	}
+	assert.Len(t, payments, 1)
+	assert.Equal(t, organisationID, payments[0].OrganisationID)
+	assert.Equal(t, "Wil piano Jan", payments[0].Attributes.EndToEndReference)
+}
+
+func TestImportPain001ShouldRouteAndRollPaymentsWithoutScheme(t *testing.T) {
+	truncateTables(t)
+
+	document, _ := ioutil.ReadFile("iso20022/testdata/pain001.xml")
+	document = regexp.MustCompile(`(?s)<PmtTpInf>.*</PmtTpInf>`).ReplaceAll(document, nil)
+	document = bytes.Replace(document, []byte("<Dt>2017-01-18</Dt>"), []byte("<Dt>2027-01-02</Dt>"), 1)
+	document = bytes.Replace(document, []byte(">100.21<"), []byte(">2000000.00<"), 1)
+	organisationID := uuid.NewV1()
+
+	request := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/v1/payments/pain001?organisation_id=%s", organisationID), bytes.NewBuffer(document))
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	var payments []Payment
+	if err := sut.DB.Model(&payments).Select(); err != nil {
+		t.Fatalf("Could not select payments")
+	}
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Len(t, payments, 1)
+	// Faster Payments cannot carry the amount and Bacs does not settle on a Saturday
+	assert.Equal(t, "Bacs", payments[0].Attributes.PaymentScheme)
+	assert.Equal(t, "2027-01-04", payments[0].Attributes.ProcessingDate)
+}
+
+func TestGetPaymentsShouldReturnCSVWhenAccepted(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayments := createPayments()
+	for _, payment := range expectedPayments {
+		if err := sut.DB.Insert(&payment); err != nil {
+			t.Fatalf("Could not insert seed data payments - %s", err.Error())
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	request.Header.Set("Accept", "text/csv")
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	rows, err := paymentcsv.Read(rw.Body, paymentcsv.Mapping{})
+	if err != nil {
+		t.Fatalf("Could not read CSV response - %s", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "text/csv", rw.Header().Get("Content-Type"))
+	assert.Len(t, rows, len(expectedPayments))
+	assert.Equal(t, expectedPayments[0], rows[0].Payment)
+}
+
+func TestImportCSVShouldCreateValidRowsAndReportInvalidRows(t *testing.T) {
+	truncateTables(t)
+
+	valid := createPayment()
+	var buf bytes.Buffer
+	paymentcsv.Write(&buf, []Payment{valid})
+	data := buf.String() + "not-a-uuid" + strings.Repeat(",", len(paymentcsv.Columns())-1) + "\n"
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/payments/csv", strings.NewReader(data))
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	var report struct {
+		Data []jsonapi.ResourceIdentifier
+		Meta struct {
+			Rejected []struct {
+				Row     int
+				Column  string
+				Message string
+			}
+		}
+	}
+	json.NewDecoder(rw.Body).Decode(&report)
+
+	actualPayment := Payment{ID: valid.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, []jsonapi.ResourceIdentifier{{Type: "Payment", ID: valid.ID.String()}}, report.Data)
+	assert.Equal(t, 3, report.Meta.Rejected[0].Row)
+	assert.Equal(t, "id", report.Meta.Rejected[0].Column)
+	assert.Equal(t, valid, actualPayment)
+}
+
+func TestImportCSVShouldRouteRollAndPriceRowsWithoutScheme(t *testing.T) {
+	truncateTables(t)
+
+	priced, rolled := createPayment(), createPayment()
+	rolled.ID = uuid.NewV4()
+	rolled.Attributes.Amount = "2000000.00"
+	for _, payment := range []*Payment{&priced, &rolled} {
+		payment.Attributes.ChargesInformation = ChargesInformation{BearerCode: "DEBT"}
+		payment.Attributes.Fx = Fx{}
+		payment.Attributes.PaymentScheme = ""
+		payment.Attributes.SchemePaymentType = ""
+		payment.Attributes.ProcessingDate = "2027-01-02"
+	}
+	var buf bytes.Buffer
+	paymentcsv.Write(&buf, []Payment{priced, rolled})
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/v1/payments/csv", &buf))
+
+	actualPriced, actualRolled := Payment{ID: priced.ID}, Payment{ID: rolled.ID}
+	if err := sut.DB.Select(&actualPriced); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	if err := sut.DB.Select(&actualRolled); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	// Faster Payments settles every day and its fee rule prices the payment
+	assert.Equal(t, "FPS", actualPriced.Attributes.PaymentScheme)
+	assert.Equal(t, "2027-01-02", actualPriced.Attributes.ProcessingDate)
+	assert.Equal(t, ChargesInformation{BearerCode: "DEBT", SenderCharges: []Charge{{Amount: "0.40", Currency: "GBP"}}},
+		actualPriced.Attributes.ChargesInformation)
+	// Bacs carries the amount Faster Payments cannot, on the next business day
+	assert.Equal(t, "Bacs", actualRolled.Attributes.PaymentScheme)
+	assert.Equal(t, "2027-01-04", actualRolled.Attributes.ProcessingDate)
+}
+
+func TestGetPaymentsShouldReturnRequestedPageWithLinks(t *testing.T) {
+	truncateTables(t)
+
+	expectedPayments := createPayments()
+	for _, payment := range expectedPayments {
+		if err := sut.DB.Insert(&payment); err != nil {
+			t.Fatalf("Could not insert seed data payments - %s", err.Error())
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments?page[number]=2&page[size]=5", nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayments, doc, err := jsonapi.DecodePayments(rw.Body)
+	if err != nil {
+		t.Fatalf("Could not decode payments document - %s", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, expectedPayments[5:10], actualPayments)
+	assert.Equal(t, float64(len(expectedPayments)), doc.Meta["total"])
+	assert.Equal(t, "/v1/payments?page%5Bnumber%5D=1&page%5Bsize%5D=5", doc.Links.Prev)
+	assert.Equal(t, "/v1/payments?page%5Bnumber%5D=3&page%5Bsize%5D=5", doc.Links.Next)
+}
+
+func TestGetPaymentsShouldReturnPaymentsMatchingFilters(t *testing.T) {
+	truncateTables(t)
+
+	euro := createPayment()
+	euro.Attributes.Currency = "EUR"
+	for _, payment := range []Payment{createPayment(), euro} {
+		if err := sut.DB.Insert(&payment); err != nil {
+			t.Fatalf("Could not insert payment - %s", err.Error())
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments?filter[currency]=EUR", nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	actualPayments, _, err := jsonapi.DecodePayments(rw.Body)
+	if err != nil {
+		t.Fatalf("Could not decode payments document - %s", err.Error())
+	}
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, []Payment{euro}, actualPayments)
+}
+
+func TestGetPaymentsShouldReturnStatusBadRequestWhenFilterUnknown(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments?filter[amount]=1", nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestGetPaymentsShouldReturnStatusBadRequestWhenPageInvalid(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/v1/payments?page[size]=0", nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, "page[size] must be a positive integer no greater than 1000", getErrorMsg(rw))
+}
+
+func TestCreatePaymentShouldReturnOriginalPaymentWhenIdempotencyKeyRepeated(t *testing.T) {
+	truncateTables(t)
+
+	payment := createPayment()
+	payment.ID = uuid.Nil
+	payload, _ := jsonapi.EncodePayment(payment)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		request := newDocumentRequest(http.MethodPost, "/v1/payments", payload)
+		request.Header.Set("Idempotency-Key", "create-once")
+		rw := httptest.NewRecorder()
+		sut.Server.Handler.ServeHTTP(rw, request)
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		ids = append(ids, rw.Header().Get("Location"))
+	}
+
+	count, _ := sut.DB.Model((*Payment)(nil)).Count()
+	assert.Equal(t, 1, count)
+	assert.Equal(t, ids[0], ids[1])
+}
+
+func TestCreatePaymentShouldReplayPaymentWhenIdempotencyKeyRetriedConcurrently(t *testing.T) {
+	truncateTables(t)
+
+	payment := createPayment()
+	payment.ID = uuid.Nil
+	payload, _ := jsonapi.EncodePayment(payment)
+
+	type response struct {
+		code     int
+		location string
+	}
+	responses := make(chan response, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(responses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := newDocumentRequest(http.MethodPost, "/v1/payments", payload)
+			request.Header.Set("Idempotency-Key", "retried-early")
+			rw := httptest.NewRecorder()
+			sut.Server.Handler.ServeHTTP(rw, request)
+			responses <- response{rw.Code, rw.Header().Get("Location")}
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	locations := map[string]bool{}
+	for response := range responses {
+		assert.Equal(t, http.StatusCreated, response.code)
+		locations[response.location] = true
+	}
+	count, _ := sut.DB.Model((*Payment)(nil)).Count()
+	assert.Equal(t, 1, count)
+	assert.Len(t, locations, 1)
+}
+
+func TestCreatePaymentShouldReturnStatusUnprocessableEntityWhenIdempotencyKeyReused(t *testing.T) {
+	truncateTables(t)
+
+	for i, status := range []int{http.StatusCreated, http.StatusUnprocessableEntity} {
+		payload, _ := jsonapi.EncodePayment(createPayment())
+		request := newDocumentRequest(http.MethodPost, "/v1/payments", payload)
+		request.Header.Set("Idempotency-Key", "used-once")
+		rw := httptest.NewRecorder()
+		sut.Server.Handler.ServeHTTP(rw, request)
+
+		assert.Equal(t, status, rw.Code, "request %d", i)
+	}
+}
+
+func TestClientShouldManagePaymentsThroughRouter(t *testing.T) {
+	truncateTables(t)
+
+	api := httptest.NewServer(sut.Router)
+	defer api.Close()
+	c := client.New(api.URL)
+	ctx := context.Background()
+
+	created, err := c.Create(ctx, createPayment())
+	if err != nil {
+		t.Fatalf("Could not create payment - %s", err.Error())
+	}
+
+	fetched, err := c.Get(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, created, fetched)
+
+	fetched.Attributes.Reference = "Updated by client"
+	updated, err := c.Update(ctx, fetched)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated by client", updated.Attributes.Reference)
+
+	_, err = c.Create(ctx, updated)
+	assert.True(t, client.IsConflict(err))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Create(ctx, createPayment()); err != nil {
+			t.Fatalf("Could not create payment - %s", err.Error())
+		}
+	}
+	listed := 0
+	it := c.Payments(ctx, client.ListOptions{PageSize: 2})
+	for it.Next() {
+		listed++
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, 3, listed)
+
+	assert.NoError(t, c.Delete(ctx, created.ID))
+	_, err = c.Get(ctx, created.ID)
+	assert.True(t, client.IsNotFound(err))
+}
+
+func TestSeedShouldSkipPaymentsAlreadyLoaded(t *testing.T) {
+	truncateTables(t)
+
+	for _, expected := range []struct{ inserted, skipped int }{{14, 0}, {0, 14}} {
+		file, _ := os.Open("seeddata.json")
+		loader := seed.NewLoader(sut.DB, 5)
+		if err := seed.Decode(file, loader.Add); err != nil {
+			t.Fatalf("Could not load seed data - %s", err.Error())
+		}
+		file.Close()
+		if err := loader.Flush(); err != nil {
+			t.Fatalf("Could not load seed data - %s", err.Error())
+		}
+
+		assert.Equal(t, expected.inserted, loader.Inserted)
+		assert.Equal(t, expected.skipped, loader.Skipped)
+	}
+}
+
+func TestPostgresRateLimitStoreShouldShareBucketBetweenStores(t *testing.T) {
+	truncateTables(t)
+
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+	now := time.Now().Truncate(time.Microsecond)
+	replicas := []*ratelimit.PostgresStore{ratelimit.NewPostgresStore(sut.DB), ratelimit.NewPostgresStore(sut.DB)}
+
+	for i, replica := range replicas {
+		result, err := replica.Take(context.Background(), "client", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 1-i, result.Remaining)
+	}
+
+	result, err := replicas[0].Take(context.Background(), "client", limit, now)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+
+	result, _ = replicas[1].Take(context.Background(), "client", limit, now.Add(30*time.Second))
+	assert.True(t, result.Allowed)
+}
+
+func TestPostgresRateLimitStoreShouldDeleteFullBuckets(t *testing.T) {
+	truncateTables(t)
+
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+	now := time.Now().Truncate(time.Microsecond)
+	store := ratelimit.NewPostgresStore(sut.DB)
+
+	_, err := store.Take(context.Background(), "idle", limit, now)
+	assert.NoError(t, err)
+	_, err = store.Take(context.Background(), "busy", limit, now.Add(2*time.Minute))
+	assert.NoError(t, err)
+
+	var keys []string
+	assert.NoError(t, sut.DB.Model((*RateLimitBucket)(nil)).Column("key").Select(&keys))
+	assert.Equal(t, []string{"busy"}, keys)
+}
+
+func TestMetricsShouldCountCreatedPayments(t *testing.T) {
+	truncateTables(t)
+
+	payload, _ := jsonapi.EncodePayment(createPayment())
+	sut.Server.Handler.ServeHTTP(httptest.NewRecorder(), newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), `payments_created_total{scheme="FPS",currency="GBP"}`)
+	assert.Contains(t, rw.Body.String(), `http_requests_total{method="POST",route="/v1/payments",status="201"}`)
+	assert.Contains(t, rw.Body.String(), `db_query_duration_seconds_count{operation="INSERT"}`)
+}
+
+func TestReadyzShouldPassWhenDatabaseMigrated(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, request)
+
+	var report health.Report
+	json.NewDecoder(rw.Body).Decode(&report)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, health.StatusPass, report.Checks["database"].Status)
+	assert.Equal(t, health.StatusPass, report.Checks["migrations"].Status)
+}
+
+func TestUpdatePaymentShouldTraceRequestAndQueries(t *testing.T) {
+	truncateTables(t)
 
-	code := m.Run()
-	os.Exit(code)
+	payment := createPayment()
+	if err := sut.DB.Insert(&payment); err != nil {
+		t.Fatalf("Could not insert payment")
+	}
+
+	var buf bytes.Buffer
+	previous := tracing.Default
+	tracing.Default = tracing.NewTracer(tracing.NewWriterExporter(&buf))
+	defer func() { tracing.Default = previous }()
+
+	payload, _ := jsonapi.EncodePayment(payment)
+	request := newDocumentRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", payment.ID), payload)
+	request.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sut.Server.Handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	type span struct {
+		TraceID    string                 `json:"trace_id"`
+		SpanID     string                 `json:"span_id"`
+		ParentID   string                 `json:"parent_span_id"`
+		Name       string                 `json:"name"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+	var spans []span
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var s span
+		decoder.Decode(&s)
+		spans = append(spans, s)
+	}
+
+	// queries finish before the request so the server span is written last
+	assert.Len(t, spans, 5)
+	server := spans[len(spans)-1]
+	assert.Equal(t, "PUT /v1/payments/{id}", server.Name)
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentID)
+	assert.Equal(t, payment.ID.String(), server.Attributes["payment.id"])
+	assert.Equal(t, payment.OrganisationID.String(), server.Attributes["organisation.id"])
+	// the update runs in a transaction whose queries are traced with the request's
+	var names []string
+	for _, query := range spans[:len(spans)-1] {
+		names = append(names, query.Name)
+	}
+	assert.Equal(t, []string{"SELECT", "BEGIN", "UPDATE", "COMMIT"}, names)
+	for _, query := range spans[:len(spans)-1] {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", query.TraceID)
+		assert.Equal(t, server.SpanID, query.ParentID)
+	}
 }
 
-func TestGetPaymentShouldReturnStatusBadRequestWhenIDInvalid(t *testing.T) {
+func TestImportFxRatesShouldStoreRatesAndListRateInEffect(t *testing.T) {
 	truncateTables(t)
 
-	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", "randomText"), nil)
+	rates := "base_currency,quote_currency,rate,effective_at\n" +
+		"GBP,USD,1.20000,2019-01-01T00:00:00Z\n" +
+		"GBP,USD,1.30000,2019-06-01T00:00:00Z\n" +
+		"GBP,EUR,1.15000,2019-06-01T00:00:00Z\n"
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/v1/fx/rates/csv", strings.NewReader(rates)))
+	assert.Equal(t, http.StatusCreated, rw.Code)
 
-	assert.Equal(t, http.StatusBadRequest, rw.Code)
-	assert.Equal(t, "Invalid ID", getErrorMsg(rw))
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/fx/rates?filter[quote_currency]=USD&at=2019-05-31T23:59:59Z", nil))
+
+	var stored []FxRate
+	var resources []jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resources)
+	for _, resource := range resources {
+		rate, _ := resource.FxRate()
+		stored = append(stored, rate)
+	}
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Len(t, stored, 1)
+	assert.Equal(t, "1.20000", stored[0].Rate)
 }
 
-func TestGetPaymentShouldReturnStatusNotFoundWhenPaymentDoesNotExists(t *testing.T) {
+func TestCreatePaymentShouldCalculateAbsentCharges(t *testing.T) {
 	truncateTables(t)
 
-	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), nil)
+	payment := createPayment()
+	payment.Attributes.ChargesInformation = ChargesInformation{BearerCode: "DEBT"}
+	payload, _ := jsonapi.EncodePayment(payment)
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
 
-	assert.Equal(t, http.StatusNotFound, rw.Code)
-	assert.Equal(t, "Payment not found", getErrorMsg(rw))
+	actualPayment := Payment{ID: payment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	// the debtor bears 0.20 + 0.1% of 100.21 and the receiver's 0.10
+	assert.Equal(t, ChargesInformation{BearerCode: "DEBT", SenderCharges: []Charge{{Amount: "0.40", Currency: "GBP"}}},
+		actualPayment.Attributes.ChargesInformation)
+
+	// charges the client supplied are kept
+	supplied := createPayment()
+	payload, _ = jsonapi.EncodePayment(supplied)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	actualPayment = Payment{ID: supplied.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	assert.Equal(t, supplied.Attributes.ChargesInformation, actualPayment.Attributes.ChargesInformation)
 }
 
-func TestGetPaymentShouldReturnSinglePaymentWhenPaymentExistsIntegration(t *testing.T) {
+func TestCreatePaymentShouldRoutePaymentWithoutScheme(t *testing.T) {
 	truncateTables(t)
 
-	expectedPayment := createPayment()
-	if err := sut.DB.Insert(&expectedPayment); err != nil {
-		t.Fatalf("Could not insert seed data payments - %s", err.Error())
+	payment := createPayment()
+	payment.Attributes.Amount = "2000000.00"
+	payment.Attributes.Fx = Fx{}
+	payment.Attributes.RequestedSpeed = "same_day"
+	payment.Attributes.PaymentScheme = ""
+	payment.Attributes.SchemePaymentType = ""
+	payload, _ := jsonapi.EncodePayment(payment)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	actualPayment := Payment{ID: payment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, "CHAPS", actualPayment.Attributes.PaymentScheme)
+	assert.Equal(t, "HighValue", actualPayment.Attributes.SchemePaymentType)
+	assert.Equal(t, "InternetBanking", actualPayment.Attributes.SchemePaymentSubType)
+
+	var document struct {
+		Meta struct {
+			Routing json.RawMessage `json:"routing"`
+		} `json:"meta"`
 	}
+	json.Unmarshal(rw.Body.Bytes(), &document)
+	assert.JSONEq(t, `{"payment_scheme":"CHAPS","scheme_payment_type":"HighValue","speed":"same_day","rejected":[
+		{"payment_scheme":"FPS","reason":"amount 2000000.00 is above the limit of 1000000.00"},
+		{"payment_scheme":"Bacs","reason":"settles standard, slower than same_day"}]}`, string(document.Meta.Routing))
+}
 
-	request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), nil)
+func TestCreatePaymentShouldRejectPaymentNoSchemeCanCarry(t *testing.T) {
+	truncateTables(t)
 
+	payment := createPayment()
+	payment.Attributes.Currency = "USD"
+	payment.Attributes.Fx = Fx{}
+	payment.Attributes.RequestedSpeed = "instant"
+	payment.Attributes.PaymentScheme = ""
+	payload, _ := jsonapi.EncodePayment(payment)
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
 
-	var actualPayment Payment
-	json.NewDecoder(rw.Body).Decode(&actualPayment)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"no_route"`)
+	assert.Contains(t, rw.Body.String(), `{"payment_scheme":"SWIFT","reason":"settles standard, slower than instant"}`)
+	assertPaymentDoseNotExist(t, payment.ID)
+}
 
-	expectedStatusCode := http.StatusOK
-	actualStatusCode := rw.Code
+func TestCreatePaymentShouldRejectAmountAboveLimitOfOwnScheme(t *testing.T) {
+	truncateTables(t)
 
-	assert.Equal(t, expectedStatusCode, actualStatusCode)
-	assert.Equal(t, expectedPayment, actualPayment)
+	payment := createPayment()
+	payment.Attributes.Amount = "2000000.00"
+	payment.Attributes.Fx = Fx{}
+	payload, _ := jsonapi.EncodePayment(payment)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"no_route"`)
+	assert.Contains(t, rw.Body.String(), `"detail":"FPS cannot carry the payment, amount 2000000.00 is above the limit of 1000000.00"`)
+	assert.Contains(t, rw.Body.String(), `"pointer":"/data/attributes/payment_scheme"`)
+	assertPaymentDoseNotExist(t, payment.ID)
 }
 
-func TestCreatePaymentShouldReturnStatusBadRequestWhenInvalidPayload(t *testing.T) {
+func TestCreatePaymentShouldRollProcessingDateForwardToBusinessDay(t *testing.T) {
 	truncateTables(t)
-	invalidPayload, _ := json.Marshal("{ random: 'random' }")
 
-	request := httptest.NewRequest(http.MethodPost, "/v1/payments", bytes.NewBuffer(invalidPayload))
+	payment := createPayment()
+	payment.Attributes.PaymentScheme = "Bacs"
+	payment.Attributes.ProcessingDate = "2027-01-02"
+	payload, _ := jsonapi.EncodePayment(payment)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	actualPayment := Payment{ID: payment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, "2027-01-04", actualPayment.Attributes.ProcessingDate)
+	assert.Contains(t, rw.Body.String(),
+		`"processing_date":{"requested":"2027-01-02","processing_date":"2027-01-04","reason":"2027-01-02 is a Saturday"}`)
+
+	// a PATCH that moves the date is checked too
+	payload = []byte(fmt.Sprintf(`{"data":{"type":"Payment","id":"%s","attributes":{"processing_date":"2027-01-10"}}}`, payment.ID))
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPatch, fmt.Sprintf("/v1/payments/%s", payment.ID), payload))
+
+	sut.DB.Select(&actualPayment)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "2027-01-11", actualPayment.Attributes.ProcessingDate)
+}
 
+func TestExportBacsShouldReturnInternalServerErrorWithoutServiceUserNumber(t *testing.T) {
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/exports/bacs", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"internal_error"`)
+}
+
+func TestGetNextBusinessDayShouldSkipWeekends(t *testing.T) {
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/calendars/Bacs/next-business-day?currency=GBP&date=2027-01-01", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"data":{"type":"BusinessDay","id":"Bacs:2027-01-04","attributes":{"payment_scheme":"Bacs","currency":"GBP",
+		"date":"2027-01-04","cut_off":"2027-01-04T22:30:00Z"}},"links":{"self":"/v1/calendars/Bacs/next-business-day?currency=GBP&date=2027-01-01"},
+		"jsonapi":{"version":"1.0"}}`, rw.Body.String())
+
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/calendars/Nowhere/next-business-day", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"calendar_not_found"`)
 
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/calendars/Bacs/next-business-day?date=01/01/2027", nil))
 	assert.Equal(t, http.StatusBadRequest, rw.Code)
-	assert.Equal(t, "Could not decode request body", getErrorMsg(rw))
+	assert.Contains(t, rw.Body.String(), `"code":"invalid_date"`)
 }
 
-func TestCreatePaymentShouldReturnStatusBadRequestWhenPaymentAlreadyExists(t *testing.T) {
+func TestCreatePaymentShouldScheduleProcessingDate(t *testing.T) {
 	truncateTables(t)
 
-	expectedPayment := createPayment()
-	if err := sut.DB.Insert(&expectedPayment); err != nil {
-		t.Fatalf("Could not insert seed data payments - %s", err.Error())
+	future := time.Now().UTC().AddDate(0, 0, 7).Format("2006-01-02")
+	payment := createPayment()
+	payment.Attributes.ProcessingDate = future
+	payload, _ := jsonapi.EncodePayment(payment)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	// a payment already due is scheduled too, the scheduler submits it on its next run
+	due := createPayment()
+	payload, _ = jsonapi.EncodePayment(due)
+	sut.Server.Handler.ServeHTTP(httptest.NewRecorder(), newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/schedules", nil))
+
+	var resources []jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resources)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	if assert.Len(t, resources, 2) {
+		for i, expected := range []struct {
+			payment Payment
+			date    string
+		}{{due, due.Attributes.ProcessingDate}, {payment, future}} {
+			var schedule PaymentSchedule
+			json.Unmarshal(resources[i].Attributes, &schedule)
+			assert.Equal(t, expected.payment.ID.String(), resources[i].ID)
+			assert.Equal(t, expected.date, schedule.ProcessingDate)
+			assert.Equal(t, scheduler.Scheduled, schedule.Status)
+		}
 	}
+}
 
-	payload, _ := json.Marshal(expectedPayment)
+func TestUpdatePaymentShouldRejectProcessingDateOnceSubmitted(t *testing.T) {
+	truncateTables(t)
 
-	request := httptest.NewRequest(http.MethodPost, "/v1/payments", bytes.NewBuffer(payload))
+	payment := createPayment()
+	payload, _ := jsonapi.EncodePayment(payment)
+	sut.Server.Handler.ServeHTTP(httptest.NewRecorder(), newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+	s := &scheduler.Scheduler{
+		DB:     sut.DB,
+		Now:    func() time.Time { return time.Date(2017, 1, 18, 9, 0, 0, 0, time.UTC) },
+		Submit: func(db orm.DB, payment Payment) error { return nil },
+	}
+	if n, err := s.RunOnce(); err != nil || n != 1 {
+		t.Fatalf("Could not submit payment - %d %v", n, err)
+	}
 
+	payload = []byte(fmt.Sprintf(`{"data":{"type":"Payment","id":"%s","attributes":{"processing_date":"2017-01-25"}}}`, payment.ID))
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPatch, fmt.Sprintf("/v1/payments/%s", payment.ID), payload))
 
-	assert.Equal(t, http.StatusBadRequest, rw.Code, "Expected Status Bad Request")
-	assert.Equal(t, "Cannot create payment already exists", getErrorMsg(rw))
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"schedule_closed"`)
+	actualPayment := Payment{ID: payment.ID}
+	sut.DB.Select(&actualPayment)
+	assert.Equal(t, "2017-01-18", actualPayment.Attributes.ProcessingDate)
 }
 
-func TestCreatePaymentShouldReturnStatusCreated(t *testing.T) {
+func TestSchedulerShouldSubmitDuePaymentsOnce(t *testing.T) {
 	truncateTables(t)
 
-	expectedPayment := createPayment()
-	payload, _ := json.Marshal(expectedPayment)
+	due, failing, deleted := createPayment(), createPayment(), createPayment()
+	for _, payment := range []Payment{due, failing, deleted} {
+		if err := sut.DB.Insert(&payment); err != nil {
+			t.Fatalf("Could not insert payment - %s", err)
+		}
+	}
+	created := time.Date(2017, 1, 10, 9, 0, 0, 0, time.UTC)
+	for _, payment := range []Payment{due, failing, deleted} {
+		if err := scheduler.Add(sut.DB, payment, created); err != nil {
+			t.Fatalf("Could not schedule payment - %s", err)
+		}
+	}
+	sut.DB.Delete(&deleted)
+
+	// the fixture's processing date is 2017-01-18
+	s := &scheduler.Scheduler{
+		DB:          sut.DB,
+		MaxAttempts: 1,
+		Now:         func() time.Time { return time.Date(2017, 1, 17, 9, 0, 0, 0, time.UTC) },
+		Submit: func(db orm.DB, payment Payment) error {
+			if payment.ID == failing.ID {
+				return errors.New("scheme unavailable")
+			}
+			return nil
+		},
+	}
+	n, err := s.RunOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	s.Now = func() time.Time { return time.Date(2017, 1, 18, 0, 1, 0, 0, time.UTC) }
+	n, err = s.RunOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	for id, status := range map[uuid.UUID]string{due.ID: scheduler.Submitted, failing.ID: scheduler.Failed, deleted.ID: scheduler.Cancelled} {
+		schedule := PaymentSchedule{PaymentID: id}
+		sut.DB.Select(&schedule)
+		assert.Equal(t, status, schedule.Status)
+	}
+	schedule := PaymentSchedule{PaymentID: failing.ID}
+	sut.DB.Select(&schedule)
+	assert.Equal(t, "scheme unavailable", schedule.LastError)
+	assert.Equal(t, 1, schedule.Attempts)
+
+	n, err = s.RunOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
 
-	request := httptest.NewRequest(http.MethodPost, "/v1/payments", bytes.NewBuffer(payload))
+func TestSchedulerShouldRecordAttemptWhenSubmissionQueryFails(t *testing.T) {
+	truncateTables(t)
 
-	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	payment := createPayment()
+	if err := sut.DB.Insert(&payment); err != nil {
+		t.Fatalf("Could not insert payment - %s", err)
+	}
+	if err := scheduler.Add(sut.DB, payment, time.Date(2017, 1, 10, 9, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Could not schedule payment - %s", err)
+	}
 
-	expectedStatusCode := http.StatusCreated
-	actualStatusCode := rw.Code
+	// the submitter writes before its failing query, neither may outlive the attempt
+	s := &scheduler.Scheduler{
+		DB:  sut.DB,
+		Now: func() time.Time { return time.Date(2017, 1, 18, 0, 1, 0, 0, time.UTC) },
+		Submit: func(db orm.DB, submitted Payment) error {
+			if _, err := db.Model(&submitted).Set("version = version + 1").WherePK().Update(); err != nil {
+				return err
+			}
+			_, err := db.Exec("SELECT 1/0")
+			return err
+		},
+	}
+	n, err := s.RunOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	schedule := PaymentSchedule{PaymentID: payment.ID}
+	sut.DB.Select(&schedule)
+	assert.Equal(t, scheduler.Scheduled, schedule.Status)
+	assert.Equal(t, 1, schedule.Attempts)
+	assert.Contains(t, schedule.LastError, "division by zero")
+
+	actualPayment := Payment{ID: payment.ID}
+	sut.DB.Select(&actualPayment)
+	assert.Equal(t, payment.Version, actualPayment.Version)
+}
 
-	actualPayment := Payment{ID: expectedPayment.ID}
-	if err := sut.DB.Select(&actualPayment); err != nil {
-		t.Fatalf("Payment was not created by request")
+func TestSchedulerShouldSkipSchedulesLockedByAnotherReplica(t *testing.T) {
+	truncateTables(t)
+
+	payment := createPayment()
+	sut.DB.Insert(&payment)
+	scheduler.Add(sut.DB, payment, time.Date(2017, 1, 10, 9, 0, 0, 0, time.UTC))
+
+	tx, err := sut.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	locked := PaymentSchedule{PaymentID: payment.ID}
+	if err := tx.Model(&locked).WherePK().For("UPDATE").Select(); err != nil {
+		t.Fatal(err)
 	}
 
-	assert.Equal(t, expectedStatusCode, actualStatusCode)
-	assert.Equal(t, expectedPayment, actualPayment)
+	s := &scheduler.Scheduler{DB: sut.DB, Now: func() time.Time { return time.Date(2017, 1, 18, 9, 0, 0, 0, time.UTC) }}
+	n, err := s.RunOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
 }
 
-func TestDeletePaymentShouldReturnStatusBadRequestWhenInvalidID(t *testing.T) {
+func TestStandingOrderShouldMakePaymentOnEachOccurrence(t *testing.T) {
 	truncateTables(t)
 
-	request := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/payments/%s", "randomText"), nil)
+	template := createPayment().Attributes
+	template.PaymentScheme = "Bacs"
+	template.ProcessingDate = ""
+	template.Fx = Fx{}
+	attributes, _ := json.Marshal(map[string]interface{}{"template": template, "frequency": "end_of_month", "start_date": "2030-02-01"})
+	organisationID := uuid.NewV1()
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"StandingOrder","attributes":%s,
+		"relationships":{"organisation":{"data":{"type":"organisations","id":"%s"}}}}}`, attributes, organisationID))
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/standing-orders", payload))
 
-	assert.Equal(t, http.StatusBadRequest, rw.Code)
-	assert.Equal(t, "Invalid ID", getErrorMsg(rw))
-}
+	var resource jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resource)
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	id := uuid.FromStringOrNil(resource.ID)
+	order := StandingOrder{ID: id}
+	if err := sut.DB.Select(&order); err != nil {
+		t.Fatalf("Standing order was not created by request")
+	}
+	assert.Equal(t, standingorder.Active, order.Status)
+	assert.Equal(t, organisationID, order.OrganisationID)
+	assert.Equal(t, "2030-02-28", order.NextProcessingDate)
+
+	calendars, _ := calendar.New()
+	generator := &standingorder.Generator{DB: sut.DB, Preparer: prepare.Preparer{Calendars: calendars, Routes: routing.DefaultTable()}}
+	run := func(date string) int {
+		generator.Now = func() time.Time {
+			day, _ := time.Parse(calendar.DateLayout, date)
+			return day.Add(9 * time.Hour)
+		}
+		n, err := generator.RunOnce()
+		assert.NoError(t, err)
+		return n
+	}
+	assert.Equal(t, 1, run("2030-02-28"))
+	assert.Equal(t, 0, run("2030-02-28"))
+	first := Payment{ID: uuid.NewV5(id, "1")}
+	if err := sut.DB.Select(&first); err != nil {
+		t.Fatalf("Standing order did not make its first payment")
+	}
+	assert.Equal(t, "2030-02-28", first.Attributes.ProcessingDate)
+	assert.Equal(t, organisationID, first.OrganisationID)
+
+	// the end of March is a Sunday, so the second payment is made the following Monday
+	sut.DB.Select(&order)
+	assert.Equal(t, "2030-03-31", order.NextDate)
+	assert.Equal(t, "2030-04-01", order.NextProcessingDate)
+	assert.Equal(t, 0, run("2030-03-31"))
+
+	patch := func(attributes string) *httptest.ResponseRecorder {
+		payload := []byte(fmt.Sprintf(`{"data":{"type":"StandingOrder","id":"%s","attributes":%s}}`, id, attributes))
+		rw := httptest.NewRecorder()
+		sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPatch, "/v1/standing-orders/"+id.String(), payload))
+		return rw
+	}
+	assert.Equal(t, http.StatusOK, patch(`{"status":"paused"}`).Code)
+	assert.Equal(t, 0, run("2030-04-01"))
+
+	// resuming with a new amount makes the next occurrence for the new amount
+	assert.Equal(t, http.StatusOK, patch(`{"status":"active","template":{"amount":"300.00"}}`).Code)
+	assert.Equal(t, 1, run("2030-04-01"))
+	second := Payment{ID: uuid.NewV5(id, "2")}
+	sut.DB.Select(&second)
+	assert.Equal(t, "300.00", second.Attributes.Amount)
+	assert.Equal(t, "2030-04-01", second.Attributes.ProcessingDate)
+
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/standing-orders/"+id.String()+"/payments", nil))
+	var resources []jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resources)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	if assert.Len(t, resources, 2) {
+		assert.Equal(t, first.ID.String(), resources[0].ID)
+		assert.Equal(t, id.String(), resources[1].Relationships["standing_order"].Data.ID)
+	}
 
-func TestDeletePaymentShouldReturnStatusNotFoundWhenPaymentDoesNotExist(t *testing.T) {
-	truncateTables(t)
+	rw = patch(`{"status":"cancelled"}`)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotContains(t, rw.Body.String(), "next_date")
+	rw = patch(`{"status":"active"}`)
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"standing_order_closed"`)
+}
 
-	request := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), nil)
+func TestCreateStandingOrderShouldRejectInvalidRule(t *testing.T) {
+	template := createPayment().Attributes
+	template.ProcessingDate = ""
+	template.Fx = Fx{}
+	attributes, _ := json.Marshal(map[string]interface{}{"template": template, "frequency": "daily", "start_date": "2030-02-01"})
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"StandingOrder","attributes":%s,
+		"relationships":{"organisation":{"data":{"type":"organisations","id":"%s"}}}}}`, attributes, uuid.NewV1()))
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/standing-orders", payload))
 
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"invalid_standing_order"`)
+	assert.Contains(t, rw.Body.String(), `"pointer":"/data/attributes/frequency"`)
+
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/standing-orders/"+uuid.NewV4().String(), nil))
 	assert.Equal(t, http.StatusNotFound, rw.Code)
-	assert.Equal(t, getErrorMsg(rw), "Payment not found cannot delete")
 }
 
-func TestDeletePaymentShouldReturnStatusOKWhenPaymentDeleted(t *testing.T) {
+func TestCreateMandateShouldAcceptReferenceOnceWhenRequestsRace(t *testing.T) {
 	truncateTables(t)
 
-	expectedPayment := createPayment()
-	if err := sut.DB.Insert(&expectedPayment); err != nil {
-		t.Log(err)
+	organisationID := uuid.NewV1()
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"Mandate","attributes":{"reference":"GYM-000123",
+		"debtor_party":{"account_number":"GB29XABC10161234567801","bank_id":"203301"},"creditor":{"name":"Localtown Gym"},
+		"signed_date":"2026-10-01"},"relationships":{"organisation":{"data":{"type":"organisations","id":"%s"}}}}}`, organisationID))
+
+	codes := make(chan int, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw := httptest.NewRecorder()
+			sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/mandates", payload))
+			codes <- rw.Code
+		}()
 	}
+	wg.Wait()
+	close(codes)
 
-	request := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), nil)
-	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
-
-	assert.Equal(t, http.StatusOK, rw.Code)
-	assertPaymentDoseNotExist(t, expectedPayment.ID)
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusCreated: 1, http.StatusConflict: cap(codes) - 1}, counts)
 }
 
-func TestUpdatePaymentShouldReturnStatusBadRequestWhenInvalidID(t *testing.T) {
+func TestCreatePaymentShouldRequireActiveMandateForDebits(t *testing.T) {
 	truncateTables(t)
 
-	request := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", "invalidUUID"), nil)
+	organisationID := uuid.NewV1()
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"Mandate","attributes":{"reference":"GYM-000123",
+		"debtor_party":{"account_number":"GB29XABC10161234567801","bank_id":"203301"},"creditor":{"name":"Localtown Gym"},
+		"signed_date":"2026-10-01"},"relationships":{"organisation":{"data":{"type":"organisations","id":"%s"}}}}}`, organisationID))
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/mandates", payload))
 
-	assert.Equal(t, http.StatusBadRequest, rw.Code)
-	assert.Equal(t, "Invalid ID", getErrorMsg(rw))
-}
+	var resource jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resource)
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	id := resource.ID
+
+	createDebit := func(reference, accountNumber string) *httptest.ResponseRecorder {
+		payment := createPayment()
+		payment.OrganisationID = organisationID
+		payment.Attributes.PaymentType = "Debit"
+		payment.Attributes.MandateReference = reference
+		payment.Attributes.DebtorParty.AccountNumber = accountNumber
+		payload, _ := jsonapi.EncodePayment(payment)
+		rw := httptest.NewRecorder()
+		sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+		return rw
+	}
+	rw = createDebit("", "GB29XABC10161234567801")
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"mandate_required"`)
 
-func TestUpdatePaymentShouldReturnStatusBadRequestWhenPayloadInvalid(t *testing.T) {
-	truncateTables(t)
+	assert.Equal(t, http.StatusCreated, createDebit("GYM-000123", "GB29XABC10161234567801").Code)
 
-	invalidPayload, _ := json.Marshal("{ random: 'random' }")
+	rw = createDebit("GYM-000123", "GB29XABC10161234567899")
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"mandate_mismatch"`)
+	assert.Contains(t, rw.Body.String(), `"pointer":"/data/attributes/debtor_party/account_number"`)
 
-	request := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), bytes.NewBuffer(invalidPayload))
-	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	rw = createDebit("GYM-999999", "GB29XABC10161234567801")
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"unknown_mandate"`)
 
-	assert.Equal(t, http.StatusBadRequest, rw.Code)
-	assert.Equal(t, "Could not decode request body", getErrorMsg(rw))
+	// once cancelled the mandate authorises nothing and cannot be changed
+	cancel := []byte(fmt.Sprintf(`{"data":{"type":"Mandate","id":"%s","attributes":{"status":"cancelled"}}}`, id))
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPatch, "/v1/mandates/"+id, cancel))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPatch, "/v1/mandates/"+id, cancel))
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"mandate_closed"`)
+
+	rw = createDebit("GYM-000123", "GB29XABC10161234567801")
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"mandate_inactive"`)
+
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/v1/mandates/"+id+"/events", nil))
+	var events []jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &events)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	if assert.Len(t, events, 2) {
+		var setup, cancelled MandateEvent
+		json.Unmarshal(events[0].Attributes, &setup)
+		json.Unmarshal(events[1].Attributes, &cancelled)
+		assert.Equal(t, "setup", setup.Event)
+		assert.Equal(t, "cancel", cancelled.Event)
+		assert.Equal(t, "cancelled", cancelled.Mandate.Status)
+	}
 }
 
-func TestUpdatePaymentShouldReturnStatusBadRequestWhenPayloadDoesNotMatchID(t *testing.T) {
+func TestSchedulerShouldFailDebitWhoseMandateWasCancelled(t *testing.T) {
 	truncateTables(t)
 
+	organisationID := uuid.NewV1()
+	payload := []byte(fmt.Sprintf(`{"data":{"type":"Mandate","attributes":{"reference":"GYM-000123",
+		"debtor_party":{"account_number":"GB29XABC10161234567801","bank_id":"203301"},"creditor":{"name":"Localtown Gym"},
+		"signed_date":"2026-10-01"},"relationships":{"organisation":{"data":{"type":"organisations","id":"%s"}}}}}`, organisationID))
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/mandates", payload))
+	var resource jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resource)
+
 	payment := createPayment()
-	payload, _ := json.Marshal(payment)
+	payment.OrganisationID = organisationID
+	payment.Attributes.PaymentType = "Debit"
+	payment.Attributes.MandateReference = "GYM-000123"
+	payment.Attributes.DebtorParty.AccountNumber = "GB29XABC10161234567801"
+	payload, _ = jsonapi.EncodePayment(payment)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	// the mandate is cancelled after the debit is created but before it is due
+	cancel := []byte(fmt.Sprintf(`{"data":{"type":"Mandate","id":"%s","attributes":{"status":"cancelled"}}}`, resource.ID))
+	sut.Server.Handler.ServeHTTP(httptest.NewRecorder(), newDocumentRequest(http.MethodPatch, "/v1/mandates/"+resource.ID, cancel))
+
+	submitted := false
+	s := &scheduler.Scheduler{
+		DB:  sut.DB,
+		Now: func() time.Time { return time.Date(2017, 1, 18, 9, 0, 0, 0, time.UTC) },
+		Submit: func(db orm.DB, payment Payment) error {
+			submitted = true
+			return nil
+		},
+	}
+	n, err := s.RunOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// a refused debit is failed at once rather than retried
+	assert.False(t, submitted)
+	schedule := PaymentSchedule{PaymentID: payment.ID}
+	sut.DB.Select(&schedule)
+	assert.Equal(t, scheduler.Failed, schedule.Status)
+	assert.Equal(t, 1, schedule.Attempts)
+	assert.Equal(t, `Mandate "GYM-000123" is cancelled`, schedule.LastError)
+}
 
-	request := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", uuid.NewV1()), bytes.NewBuffer(payload))
+func TestPreviewChargesShouldPriceDraftWithoutCreatingIt(t *testing.T) {
+	truncateTables(t)
 
+	payment := createPayment()
+	payload, _ := jsonapi.EncodePayment(payment)
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments/charges", payload))
 
-	assert.Equal(t, getErrorMsg(rw), "Could not update payment - request id does not match update payment")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"meta":{"fee_rule":"fps-gbp","charges_information":{"bearer_code":"SHAR",
+		"sender_charges":[{"amount":"0.30","currency":"GBP"}],"receiver_charges_amount":"0.10","receiver_charges_currency":"GBP"}},
+		"jsonapi":{"version":"1.0"}}`, rw.Body.String())
 	assertPaymentDoseNotExist(t, payment.ID)
+
+	payment.Attributes.Currency = "EUR"
+	payment.Attributes.PaymentScheme = "SEPACT"
+	payload, _ = jsonapi.EncodePayment(payment)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments/charges", payload))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"meta":{"charges_information":{"bearer_code":"SHAR","sender_charges":null,
+		"receiver_charges_amount":"","receiver_charges_currency":""}},"jsonapi":{"version":"1.0"}}`, rw.Body.String())
+
+	payment.Attributes.ChargesInformation.BearerCode = "OUR"
+	payload, _ = jsonapi.EncodePayment(payment)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments/charges", payload))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"invalid_charges"`)
+	assert.Contains(t, rw.Body.String(), `"pointer":"/data/attributes/charges_information/bearer_code"`)
 }
 
-func TestUpdatePaymentShouldReturnStatusNotFoundWhenPaymentNotInDatabase(t *testing.T) {
+func TestCreatePaymentShouldFillFxFromStoredRateWhenBookedAgainstContract(t *testing.T) {
 	truncateTables(t)
+	storeRate(t, FxRate{BaseCurrency: "GBP", QuoteCurrency: "USD", Rate: "1.25000", EffectiveAt: time.Now().Add(-time.Hour)})
 
 	payment := createPayment()
-	payload, _ := json.Marshal(payment)
+	payment.Attributes.Fx = Fx{ContractReference: "FX123", OriginalCurrency: "USD"}
+	payload, _ := jsonapi.EncodePayment(payment)
+	rw := httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	actualPayment := Payment{ID: payment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
 
-	request := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", payment.ID), bytes.NewBuffer(payload))
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	// 100.21 GBP at 1.25 is 125.2625 USD
+	assert.Equal(t, Fx{ContractReference: "FX123", ExchangeRate: "1.25000", OriginalAmount: "125.26", OriginalCurrency: "USD"},
+		actualPayment.Attributes.Fx)
+}
+
+func TestCreatePaymentShouldBookQuoteOnce(t *testing.T) {
+	truncateTables(t)
+	storeRate(t, FxRate{BaseCurrency: "GBP", QuoteCurrency: "USD", Rate: "1.25000", EffectiveAt: time.Now().Add(-time.Hour)})
 
+	payload := []byte(`{"data":{"type":"FxQuote","attributes":{"amount":"100.21","currency":"GBP","original_currency":"USD"}}}`)
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/fx/quotes", payload))
 
-	assert.Equal(t, getErrorMsg(rw), "Could not update payment as not found")
-	assertPaymentDoseNotExist(t, payment.ID)
+	var resource jsonapi.Resource
+	jsonapi.DecodeDocument(rw.Body, &resource)
+	var quote FxQuote
+	json.Unmarshal(resource.Attributes, &quote)
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	// 100.21 GBP at 1.25 is 125.2625 USD
+	assert.Equal(t, "125.26", quote.OriginalAmount)
+	assert.Equal(t, quote.ContractReference, resource.ID)
+	assert.True(t, quote.ExpiresAt.After(time.Now()))
+
+	payment := createPayment()
+	payment.Attributes.Fx = Fx{ContractReference: quote.ContractReference}
+	payload, _ = jsonapi.EncodePayment(payment)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	actualPayment := Payment{ID: payment.ID}
+	if err := sut.DB.Select(&actualPayment); err != nil {
+		t.Fatalf("Payment was not created by request")
+	}
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Equal(t, Fx{ContractReference: quote.ContractReference, ExchangeRate: "1.25000", OriginalAmount: "125.26", OriginalCurrency: "USD"},
+		actualPayment.Attributes.Fx)
+
+	again := createPayment()
+	again.Attributes.Fx = Fx{ContractReference: quote.ContractReference}
+	payload, _ = jsonapi.EncodePayment(again)
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"fx_quote_used"`)
+	assertPaymentDoseNotExist(t, again.ID)
 }
 
-func TestUpdatePaymentShouldReturnStatusCreated(t *testing.T) {
+func TestCreatePaymentShouldRejectExpiredOrMismatchedQuote(t *testing.T) {
 	truncateTables(t)
 
-	expectedPayment := createPayment()
-	if err := sut.DB.Insert(&expectedPayment); err != nil {
-		t.Fatalf("Could not insert payment")
+	quotes := []FxQuote{
+		{ContractReference: "FXQEXPIRED", Amount: "100.21", Currency: "GBP", ExchangeRate: "1.25000", OriginalAmount: "125.26",
+			OriginalCurrency: "USD", ExpiresAt: time.Now().Add(-time.Second)},
+		{ContractReference: "FXQOTHER", Amount: "50.00", Currency: "GBP", ExchangeRate: "1.25000", OriginalAmount: "62.50",
+			OriginalCurrency: "USD", ExpiresAt: time.Now().Add(time.Minute)},
+	}
+	if err := sut.DB.Insert(&quotes); err != nil {
+		t.Fatalf("Could not insert quotes - %s", err)
 	}
 
-	expectedPayment.Version = 1
+	for reference, code := range map[string]string{
+		"FXQEXPIRED": "fx_quote_expired",
+		"FXQOTHER":   "fx_quote_mismatch",
+		"FXQUNKNOWN": "fx_quote_not_found",
+	} {
+		payment := createPayment()
+		payment.Attributes.Fx = Fx{ContractReference: reference}
+		payload, _ := jsonapi.EncodePayment(payment)
+		rw := httptest.NewRecorder()
+		sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rw.Code, reference)
+		assert.Contains(t, rw.Body.String(), `"code":"`+code+`"`, reference)
+	}
+
+	unused := FxQuote{ContractReference: "FXQOTHER"}
+	sut.DB.Select(&unused)
+	assert.Nil(t, unused.PaymentID)
+}
+
+func TestImportCSVShouldBookQuote(t *testing.T) {
+	truncateTables(t)
 
-	payload, _ := json.Marshal(expectedPayment)
-	request := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/v1/payments/%s", expectedPayment.ID), bytes.NewBuffer(payload))
+	quote := FxQuote{ContractReference: "FXQCSV", Amount: "100.21", Currency: "GBP", ExchangeRate: "1.25000", OriginalAmount: "125.26",
+		OriginalCurrency: "USD", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := sut.DB.Insert(&quote); err != nil {
+		t.Fatalf("Could not insert quote - %s", err)
+	}
 
+	first, second := createPayment(), createPayment()
+	second.ID = uuid.NewV4()
+	for _, payment := range []*Payment{&first, &second} {
+		payment.Attributes.Fx = Fx{ContractReference: quote.ContractReference}
+	}
+	var buf bytes.Buffer
+	paymentcsv.Write(&buf, []Payment{first, second})
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/v1/payments/csv", &buf))
 
-	actualPayment := Payment{ID: expectedPayment.ID}
+	actualPayment := Payment{ID: first.ID}
 	if err := sut.DB.Select(&actualPayment); err != nil {
-		t.Fatalf("Could not find payment")
+		t.Fatalf("Payment was not created by request")
 	}
-
-	assert.Equal(t, http.StatusCreated, rw.Code)
-	assert.Equal(t, expectedPayment, actualPayment)
+	sut.DB.Select(&quote)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "125.26", actualPayment.Attributes.Fx.OriginalAmount)
+	assert.Equal(t, &first.ID, quote.PaymentID)
+	assert.Contains(t, rw.Body.String(), `{"row":3,"column":"attributes.fx.contract_reference","message":"Quote FXQCSV was booked by payment `)
+	assertPaymentDoseNotExist(t, second.ID)
 }
 
-func TestGetPaymentShouldReturnAllPayments(t *testing.T) {
+func TestUpdatePaymentShouldKeepQuotedConversion(t *testing.T) {
 	truncateTables(t)
 
-	expectedPayments := createPayments()
-	for _, payment := range expectedPayments {
-		if err := sut.DB.Insert(&payment); err != nil {
-			t.Fatalf("Could not insert seed data payments - %s", err.Error())
+	booked, other := createPayment(), createPayment()
+	other.ID = uuid.NewV4()
+	booked.Attributes.Fx = Fx{ContractReference: "FXQBOOKED", ExchangeRate: "1.25000", OriginalAmount: "125.26", OriginalCurrency: "USD"}
+	quote := FxQuote{ContractReference: "FXQBOOKED", Amount: "100.21", Currency: "GBP", ExchangeRate: "1.25000", OriginalAmount: "125.26",
+		OriginalCurrency: "USD", ExpiresAt: time.Now().Add(time.Minute), PaymentID: &booked.ID}
+	for _, value := range []interface{}{&booked, &other, &quote} {
+		if err := sut.DB.Insert(value); err != nil {
+			t.Fatalf("Could not insert %T - %s", value, err)
 		}
 	}
 
-	request := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	for _, update := range []struct {
+		id         uuid.UUID
+		attributes string
+		pointer    string
+	}{
+		{booked.ID, `{"amount":"200.00"}`, "/data/attributes/amount"},
+		{other.ID, `{"fx":{"contract_reference":"FXQBOOKED"}}`, "/data/attributes/fx/contract_reference"},
+	} {
+		payload := []byte(fmt.Sprintf(`{"data":{"type":"Payment","id":"%s","attributes":%s}}`, update.id, update.attributes))
+		rw := httptest.NewRecorder()
+		sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPatch, fmt.Sprintf("/v1/payments/%s", update.id), payload))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rw.Code, update.attributes)
+		assert.Contains(t, rw.Body.String(), `"code":"fx_quote_booked"`, update.attributes)
+		assert.Contains(t, rw.Body.String(), `"pointer":"`+update.pointer+`"`, update.attributes)
+	}
+}
+
+func TestCreatePaymentShouldRejectFxThatDisagreesWithAmountOrStoredRate(t *testing.T) {
+	truncateTables(t)
+
+	payment := createPayment()
+	payment.Attributes.Fx.OriginalAmount = "250.00"
+	payload, _ := jsonapi.EncodePayment(payment)
 	rw := httptest.NewRecorder()
-	server.Handler.ServeHTTP(rw, request)
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
 
-	var actualPayments []Payment
-	json.NewDecoder(rw.Body).Decode(&actualPayments)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), `"code":"fx_amount_mismatch"`)
+	assert.Contains(t, rw.Body.String(), `"pointer":"/data/attributes/fx/original_amount"`)
 
-	assert.Equal(t, http.StatusOK, rw.Code)
-	assert.Equal(t, expectedPayments, actualPayments)
+	storeRate(t, FxRate{BaseCurrency: "GBP", QuoteCurrency: "USD", Rate: "1.25000", EffectiveAt: time.Now().Add(-time.Hour)})
+	payload, _ = jsonapi.EncodePayment(createPayment())
+	rw = httptest.NewRecorder()
+	sut.Server.Handler.ServeHTTP(rw, newDocumentRequest(http.MethodPost, "/v1/payments", payload))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Equal(t, "exchange_rate 2.00000 is more than 0.5% from the GBP/USD rate 1.25000", getErrorMsg(rw))
+	assertPaymentDoseNotExist(t, payment.ID)
 }
 
 func getErrorMsg(rw *httptest.ResponseRecorder) string {
-	var msg map[string]string
-	json.NewDecoder(rw.Body).Decode(&msg)
-	return msg["error"]
+	var doc jsonapi.Document
+	json.NewDecoder(rw.Body).Decode(&doc)
+	if len(doc.Errors) == 0 {
+		return ""
+	}
+	return doc.Errors[0].Detail
+}
+
+func newDocumentRequest(method string, target string, payload []byte) *http.Request {
+	request := httptest.NewRequest(method, target, bytes.NewBuffer(payload))
+	request.Header.Set("Content-Type", jsonapi.MediaType)
+	return request
+}
+
+func storeRate(t *testing.T, rate FxRate) {
+	if err := fx.SaveRates(sut.DB, []FxRate{rate}); err != nil {
+		t.Fatalf("Could not store rate - %s", err)
+	}
 }
 
 func truncateTables(t *testing.T) {
@@ -340,7 +1803,16 @@ func getTables() []interface{} {
 		(*SponsorParty)(nil),
 		(*DebtorParty)(nil),
 		(*Charge)(nil),
-		(*Fx)(nil)}
+		(*Fx)(nil),
+		(*IdempotencyKey)(nil),
+		(*RateLimitBucket)(nil),
+		(*FxRate)(nil),
+		(*FxQuote)(nil),
+		(*PaymentSchedule)(nil),
+		(*StandingOrder)(nil),
+		(*StandingOrderPayment)(nil),
+		(*Mandate)(nil),
+		(*MandateEvent)(nil)}
 }
 
 func createPayment() Payment {
@@ -418,8 +1890,12 @@ func assertPaymentDoseNotExist(t *testing.T, uuid uuid.UUID) {
 	}
 }
 
+// createPayments returns the seed data in ID order, which is the order the API lists payments in
 func createPayments() (payments []Payment) {
 	data, _ := ioutil.ReadFile("seeddata.json")
 	json.Unmarshal(data, &payments)
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].ID.String() < payments[j].ID.String()
+	})
 	return
 }
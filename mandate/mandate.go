@@ -0,0 +1,105 @@
+package mandate
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"time"
+)
+
+// Statuses of a mandate. Cancelled mandates authorise nothing and cannot be changed.
+const (
+	Active    = "active"
+	Cancelled = "cancelled"
+)
+
+// Events in the history of a mandate
+const (
+	Setup  = "setup"
+	Amend  = "amend"
+	Cancel = "cancel"
+)
+
+// Debit is the payment type that needs a mandate
+const Debit = "Debit"
+
+// maxReferenceLength is the longest mandate reference schemes carry, SEPA allows 35 characters
+const maxReferenceLength = 35
+
+const dateLayout = "2006-01-02"
+
+// Validate checks the members every mandate needs. A mandate cannot be signed after today.
+func Validate(m *model.Mandate, now time.Time) error {
+	if m.Reference == "" || len(m.Reference) > maxReferenceLength {
+		return &attribute.Error{Code: "invalid_mandate", Member: "reference",
+			Message: fmt.Sprintf("reference must be from 1 to %d characters", maxReferenceLength)}
+	}
+	if m.DebtorParty.AccountNumber == "" {
+		return &attribute.Error{Code: "invalid_mandate", Member: "debtor_party/account_number", Message: "debtor_party.account_number is required"}
+	}
+	if m.Creditor.Name == "" {
+		return &attribute.Error{Code: "invalid_mandate", Member: "creditor/name", Message: "creditor.name is required"}
+	}
+	signed, err := time.Parse(dateLayout, m.SignedDate)
+	if err != nil {
+		return &attribute.Error{Code: "invalid_mandate", Member: "signed_date",
+			Message: fmt.Sprintf("signed_date %q is not in YYYY-MM-DD format", m.SignedDate)}
+	}
+	if signed.After(now.UTC()) {
+		return &attribute.Error{Code: "invalid_mandate", Member: "signed_date", Message: fmt.Sprintf("signed_date %s is in the future", m.SignedDate)}
+	}
+	return nil
+}
+
+// Record adds an event to the history of a mandate. The caller holds the mandate's row lock, so
+// sequences do not collide.
+func Record(db orm.DB, m model.Mandate, event string, now time.Time) error {
+	count, err := db.Model((*model.MandateEvent)(nil)).Where("mandate_id = ?", m.ID).Count()
+	if err != nil {
+		return err
+	}
+	return db.Insert(&model.MandateEvent{MandateID: m.ID, Sequence: count + 1, Event: event, Mandate: m, CreatedAt: now.UTC()})
+}
+
+// Check makes sure a Debit payment references an active mandate of its organisation for the
+// account it debits. The mandate is share locked so it cannot be cancelled before the payment is
+// stored. Errors other than *attribute.Error come from the database.
+func Check(db orm.DB, payment model.Payment) error {
+	a := payment.Attributes
+	if a.PaymentType != Debit {
+		return nil
+	}
+	if a.MandateReference == "" {
+		return &attribute.Error{Code: "mandate_required", Member: "mandate_reference",
+			Message: "Debit payments must reference the mandate that authorises them"}
+	}
+
+	var m model.Mandate
+	err := db.Model(&m).
+		Where("organisation_id = ?", payment.OrganisationID).
+		Where("reference = ?", a.MandateReference).
+		For("SHARE").
+		Select()
+	if err == pg.ErrNoRows {
+		return &attribute.Error{Code: "unknown_mandate", Member: "mandate_reference",
+			Message: fmt.Sprintf("The organisation has no mandate %q", a.MandateReference)}
+	}
+	if err != nil {
+		return err
+	}
+	if m.Status != Active {
+		return &attribute.Error{Code: "mandate_inactive", Member: "mandate_reference",
+			Message: fmt.Sprintf("Mandate %q is %s", a.MandateReference, m.Status)}
+	}
+	if a.DebtorParty.AccountNumber != m.DebtorParty.AccountNumber {
+		return &attribute.Error{Code: "mandate_mismatch", Member: "debtor_party/account_number",
+			Message: fmt.Sprintf("Mandate %q does not authorise debits from account %s", a.MandateReference, a.DebtorParty.AccountNumber)}
+	}
+	if m.DebtorParty.BankID != "" && a.DebtorParty.BankID != m.DebtorParty.BankID {
+		return &attribute.Error{Code: "mandate_mismatch", Member: "debtor_party/bank_id",
+			Message: fmt.Sprintf("Mandate %q is for an account at bank %s", a.MandateReference, m.DebtorParty.BankID)}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package mandate
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+func mandate() *model.Mandate {
+	return &model.Mandate{
+		Reference:   "GYM-000123",
+		DebtorParty: model.DebtorParty{AccountNumber: "41426819", BankID: "203301"},
+		Creditor:    model.BeneficiaryParty{Name: "Localtown Gym"},
+		SignedDate:  "2026-10-01",
+	}
+}
+
+func TestValidateShouldRejectIncompleteMandates(t *testing.T) {
+	assert.NoError(t, Validate(mandate(), now))
+
+	for _, c := range []struct {
+		change func(*model.Mandate)
+		member string
+	}{
+		{func(m *model.Mandate) { m.Reference = "" }, "reference"},
+		{func(m *model.Mandate) { m.Reference = "0123456789012345678901234567890123456789" }, "reference"},
+		{func(m *model.Mandate) { m.DebtorParty.AccountNumber = "" }, "debtor_party/account_number"},
+		{func(m *model.Mandate) { m.Creditor.Name = "" }, "creditor/name"},
+		{func(m *model.Mandate) { m.SignedDate = "01/10/2026" }, "signed_date"},
+		{func(m *model.Mandate) { m.SignedDate = "2026-10-20" }, "signed_date"},
+	} {
+		m := mandate()
+		c.change(m)
+		err := Validate(m, now)
+		if assert.Error(t, err, c.member) {
+			assert.Equal(t, c.member, err.(*attribute.Error).Member)
+			assert.Equal(t, "invalid_mandate", err.(*attribute.Error).Code)
+		}
+	}
+}
+
+func TestCheckShouldOnlyRequireMandateForDebits(t *testing.T) {
+	credit := model.Payment{Attributes: model.Attributes{PaymentType: "Credit"}}
+	assert.NoError(t, Check(nil, credit))
+
+	debit := model.Payment{Attributes: model.Attributes{PaymentType: Debit}}
+	err := Check(nil, debit)
+	if assert.Error(t, err) {
+		assert.Equal(t, "mandate_required", err.(*attribute.Error).Code)
+		assert.Equal(t, "mandate_reference", err.(*attribute.Error).Member)
+	}
+}
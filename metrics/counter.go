@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// CounterVec is a family of counters partitioned by label values
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, values: map[string]*counterSeries{}}
+	r.register(c)
+	return c
+}
+
+// NewCounterVec registers a counter family on the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// Add increases the counter for the label values, which must match the labels in number
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(labelValues)
+	series, ok := c.values[k]
+	if !ok {
+		series = &counterSeries{labels: append([]string(nil), labelValues...)}
+		c.values[k] = series
+	}
+	series.value += value
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(b *bytes.Buffer) {
+	c.header(b, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		series := c.values[k]
+		b.WriteString(c.metricName + c.labelString(series.labels) + " " + formatFloat(series.value) + "\n")
+	}
+}
+
+// funcMetric reads its value when scraped, for values kept elsewhere such as pool statistics
+type funcMetric struct {
+	desc
+	kind  string
+	value func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.register(&funcMetric{desc{name, help, nil}, "gauge", value})
+}
+
+func (r *Registry) NewCounterFunc(name, help string, value func() float64) {
+	r.register(&funcMetric{desc{name, help, nil}, "counter", value})
+}
+
+func (f *funcMetric) write(b *bytes.Buffer) {
+	f.header(b, f.kind)
+	b.WriteString(f.metricName + " " + formatFloat(f.value()) + "\n")
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"github.com/go-pg/pg"
+	"strings"
+	"time"
+)
+
+var (
+	dbQueryDuration = NewHistogramVec("db_query_duration_seconds",
+		"Database query latency by statement type", DefaultBuckets, "operation")
+	dbQueryErrors = NewCounterVec("db_query_errors_total",
+		"Database queries that failed by statement type, no rows is not a failure", "operation")
+)
+
+// QueryHook times every go-pg query
+type QueryHook struct{}
+
+func (QueryHook) BeforeQuery(event *pg.QueryEvent) {}
+
+func (QueryHook) AfterQuery(event *pg.QueryEvent) {
+	operation := Operation(event)
+	dbQueryDuration.Observe(time.Since(event.StartTime).Seconds(), operation)
+	if event.Error != nil && event.Error != pg.ErrNoRows {
+		dbQueryErrors.Inc(operation)
+	}
+}
+
+// Operation is the statement type of the query, such as SELECT or INSERT
+func Operation(event *pg.QueryEvent) string {
+	query, err := event.UnformattedQuery()
+	if err != nil {
+		return "UNKNOWN"
+	}
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "UNKNOWN"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// RegisterPool exposes the connection pool statistics of the database
+func RegisterPool(db *pg.DB) {
+	stat := func(value func(*pg.PoolStats) uint32) func() float64 {
+		return func() float64 {
+			stats := db.PoolStats()
+			if stats == nil {
+				return 0
+			}
+			return float64(value(stats))
+		}
+	}
+	Default.NewCounterFunc("db_pool_hits_total", "Connections reused from the pool",
+		stat(func(s *pg.PoolStats) uint32 { return s.Hits }))
+	Default.NewCounterFunc("db_pool_misses_total", "Connections the pool had to open",
+		stat(func(s *pg.PoolStats) uint32 { return s.Misses }))
+	Default.NewCounterFunc("db_pool_timeouts_total", "Waits for a free connection that timed out",
+		stat(func(s *pg.PoolStats) uint32 { return s.Timeouts }))
+	Default.NewGaugeFunc("db_pool_connections", "Open connections",
+		stat(func(s *pg.PoolStats) uint32 { return s.TotalConns }))
+	Default.NewGaugeFunc("db_pool_idle_connections", "Idle connections",
+		stat(func(s *pg.PoolStats) uint32 { return s.IdleConns }))
+	Default.NewGaugeFunc("db_pool_stale_connections", "Connections closed as stale",
+		stat(func(s *pg.PoolStats) uint32 { return s.StaleConns }))
+}
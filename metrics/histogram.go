@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// HistogramVec is a family of histograms partitioned by label values
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: sorted, values: map[string]*histogram{}}
+	r.register(h)
+	return h
+}
+
+// NewHistogramVec registers a histogram family on the default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Observe records a value for the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := key(labelValues)
+	v, ok := h.values[k]
+	if !ok {
+		v = &histogram{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = v
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			v.counts[i]++
+		}
+	}
+	v.count++
+	v.sum += value
+}
+
+func (h *HistogramVec) write(b *bytes.Buffer) {
+	h.header(b, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := h.values[k]
+		labels := v.labels
+		for i, bound := range h.buckets {
+			b.WriteString(h.metricName + "_bucket" + h.labelString(labels, "le", formatFloat(bound)) + " " +
+				strconv.FormatUint(v.counts[i], 10) + "\n")
+		}
+		b.WriteString(h.metricName + "_bucket" + h.labelString(labels, "le", formatFloat(math.Inf(1))) + " " +
+			strconv.FormatUint(v.count, 10) + "\n")
+		b.WriteString(h.metricName + "_sum" + h.labelString(labels) + " " + formatFloat(v.sum) + "\n")
+		b.WriteString(h.metricName + "_count" + h.labelString(labels) + " " + strconv.FormatUint(v.count, 10) + "\n")
+	}
+}
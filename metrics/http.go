@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/clD11/form3-payments/httpstatus"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = NewCounterVec("http_requests_total",
+		"HTTP requests by method, route template and status code", "method", "route", "status")
+	httpDuration = NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency by method, route template and status code", DefaultBuckets, "method", "route", "status")
+)
+
+// Middleware counts and times requests by the route template they matched so payment IDs do not
+// create a series each
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httpstatus.NewRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		status := strconv.Itoa(recorder.Status)
+		httpRequests.Inc(r.Method, route, status)
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route, status)
+	})
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryShouldWriteTextExpositionFormat(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounterVec("payments_total", "Payments", "currency")
+	histogram := r.NewHistogramVec("latency_seconds", "Latency", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("connections", "Open connections", func() float64 { return 3 })
+
+	counter.Inc("GBP")
+	counter.Add(2.5, `quo"te`)
+	histogram.Observe(0.05, "/v1/payments")
+	histogram.Observe(0.5, "/v1/payments")
+
+	var b bytes.Buffer
+	r.WriteText(&b)
+
+	assert.Equal(t, `# HELP connections Open connections
+# TYPE connections gauge
+connections 3
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/v1/payments",le="0.1"} 1
+latency_seconds_bucket{route="/v1/payments",le="1"} 2
+latency_seconds_bucket{route="/v1/payments",le="+Inf"} 2
+latency_seconds_sum{route="/v1/payments"} 0.55
+latency_seconds_count{route="/v1/payments"} 2
+# HELP payments_total Payments
+# TYPE payments_total counter
+payments_total{currency="GBP"} 1
+payments_total{currency="quo\"te"} 2.5
+`, b.String())
+}
+
+func TestMiddlewareShouldLabelRequestsByRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/v1/payments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/payments/abc", nil))
+
+	rw := httptest.NewRecorder()
+	Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, ContentType, rw.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(rw.Body.String(),
+		`http_requests_total{method="GET",route="/v1/payments/{id}",status="404"} 1`), rw.Body.String())
+}
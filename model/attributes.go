@@ -8,6 +8,7 @@ type Attributes struct {
 	DebtorParty          DebtorParty        `json:"debtor_party"`
 	EndToEndReference    string             `json:"end_to_end_reference"`
 	Fx                   Fx                 `json:"fx"`
+	MandateReference     string             `json:"mandate_reference,omitempty"`
 	NumericReference     string             `json:"numeric_reference"`
 	PaymentID            string             `json:"payment_id"`
 	PaymentPurpose       string             `json:"payment_purpose"`
@@ -15,6 +16,7 @@ type Attributes struct {
 	PaymentType          string             `json:"payment_type"`
 	ProcessingDate       string             `json:"processing_date"`
 	Reference            string             `json:"reference"`
+	RequestedSpeed       string             `json:"requested_speed,omitempty"`
 	SchemePaymentSubType string             `json:"scheme_payment_sub_type"`
 	SchemePaymentType    string             `json:"scheme_payment_type"`
 	SponsorParty         SponsorParty       `json:"sponsor_party"`
@@ -0,0 +1,19 @@
+package model
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// FxQuote locks the rate for converting Amount in Currency into OriginalCurrency until ExpiresAt. The
+// payment booked against its ContractReference uses it up, PaymentID is nil until then.
+type FxQuote struct {
+	ContractReference string     `json:"contract_reference" sql:",pk"`
+	Amount            string     `json:"amount" sql:",notnull"`
+	Currency          string     `json:"currency" sql:",notnull"`
+	ExchangeRate      string     `json:"exchange_rate" sql:",notnull"`
+	OriginalAmount    string     `json:"original_amount" sql:",notnull"`
+	OriginalCurrency  string     `json:"original_currency" sql:",notnull"`
+	ExpiresAt         time.Time  `json:"expires_at" sql:",notnull"`
+	PaymentID         *uuid.UUID `json:"payment_id,omitempty" sql:",type:uuid"`
+}
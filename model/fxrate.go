@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// FxRate is how many units of QuoteCurrency one unit of BaseCurrency buys, from EffectiveAt until the
+// next rate for the pair takes effect
+type FxRate struct {
+	BaseCurrency  string    `json:"base_currency" sql:",pk"`
+	QuoteCurrency string    `json:"quote_currency" sql:",pk"`
+	EffectiveAt   time.Time `json:"effective_at" sql:",pk"`
+	Rate          string    `json:"rate" sql:",notnull"`
+}
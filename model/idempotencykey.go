@@ -0,0 +1,15 @@
+package model
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// IdempotencyKey records the payment created for a client supplied Idempotency-Key so retried
+// requests return the original payment instead of failing
+type IdempotencyKey struct {
+	Key         string    `sql:",pk"`
+	PaymentID   uuid.UUID `sql:",type:uuid"`
+	Fingerprint string
+	CreatedAt   time.Time
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// Mandate is the authority a debtor gave a creditor to collect Debit payments from their account.
+// Payments name it by its reference, which is unique within the organisation.
+type Mandate struct {
+	ID             uuid.UUID        `json:"-" sql:",pk,type:uuid"`
+	OrganisationID uuid.UUID        `json:"-" sql:",type:uuid,notnull"`
+	Reference      string           `json:"reference" sql:",notnull"`
+	Status         string           `json:"status" sql:",notnull"`
+	DebtorParty    DebtorParty      `json:"debtor_party"`
+	Creditor       BeneficiaryParty `json:"creditor"`
+	SignedDate     string           `json:"signed_date" sql:",notnull"`
+	CreatedAt      time.Time        `json:"created_at" sql:",notnull"`
+	UpdatedAt      time.Time        `json:"updated_at" sql:",notnull"`
+}
+
+// MandateEvent records a change to a mandate and the mandate as it was after it
+type MandateEvent struct {
+	MandateID uuid.UUID `json:"mandate_id" sql:",pk,type:uuid"`
+	Sequence  int       `json:"sequence" sql:",pk"`
+	Event     string    `json:"event" sql:",notnull"`
+	Mandate   Mandate   `json:"mandate"`
+	CreatedAt time.Time `json:"created_at" sql:",notnull"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// PaymentSchedule holds a payment back until its processing date. The scheduler acts on it once
+// the date arrives, retrying at NextAttemptAt after a failure.
+type PaymentSchedule struct {
+	PaymentID      uuid.UUID  `json:"payment_id" sql:",pk,type:uuid"`
+	ProcessingDate string     `json:"processing_date" sql:",notnull"`
+	Status         string     `json:"status" sql:",notnull"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" sql:",notnull"`
+	SubmittedAt    *time.Time `json:"submitted_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" sql:",notnull"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// RateLimitBucket is a client's rate limit bucket shared by every replica, stored as the time the
+// bucket will next be full
+type RateLimitBucket struct {
+	Key string    `sql:",pk"`
+	TAT time.Time `sql:"tat,notnull"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// StandingOrder makes a payment from its template on each occurrence of its recurrence rule. The
+// next occurrence is planned ahead, NextIndex counts the rule's dates up to it so dates skipped
+// while paused or already passed are not made.
+type StandingOrder struct {
+	ID                    uuid.UUID  `json:"-" sql:",pk,type:uuid"`
+	OrganisationID        uuid.UUID  `json:"-" sql:",type:uuid,notnull"`
+	Status                string     `json:"status" sql:",notnull"`
+	Template              Attributes `json:"template"`
+	Frequency             string     `json:"frequency" sql:",notnull"`
+	DayOfMonth            int        `json:"day_of_month,omitempty"`
+	StartDate             string     `json:"start_date" sql:",notnull"`
+	EndDate               string     `json:"end_date,omitempty"`
+	Count                 int        `json:"count,omitempty"`
+	BusinessDayAdjustment string     `json:"business_day_adjustment,omitempty"`
+	Occurrences           int        `json:"occurrences"`
+	NextIndex             int        `json:"-"`
+	NextDate              string     `json:"next_date,omitempty"`
+	NextProcessingDate    string     `json:"next_processing_date,omitempty"`
+	LastProcessingDate    string     `json:"last_processing_date,omitempty"`
+	LastError             string     `json:"last_error,omitempty"`
+	CreatedAt             time.Time  `json:"created_at" sql:",notnull"`
+	UpdatedAt             time.Time  `json:"updated_at" sql:",notnull"`
+}
+
+// StandingOrderPayment links a payment to the standing order occurrence that made it
+type StandingOrderPayment struct {
+	StandingOrderID uuid.UUID `json:"standing_order_id" sql:",pk,type:uuid"`
+	Sequence        int       `json:"sequence" sql:",pk"`
+	PaymentID       uuid.UUID `json:"payment_id" sql:",type:uuid,notnull"`
+	Date            string    `json:"date" sql:",notnull"`
+	CreatedAt       time.Time `json:"created_at" sql:",notnull"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"regexp"
+)
+
+var (
+	amountPattern   = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,5})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	datePattern     = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`)
+)
+
+// Validate checks the fields every payment needs before it can be stored
+func (p *Payment) Validate() error {
+	if uuid.Equal(p.ID, uuid.Nil) {
+		return errors.New("id is required")
+	}
+	if uuid.Equal(p.OrganisationID, uuid.Nil) {
+		return errors.New("organisation_id is required")
+	}
+
+	a := p.Attributes
+	if !amountPattern.MatchString(a.Amount) {
+		return fmt.Errorf("amount %q is not a valid decimal amount", a.Amount)
+	}
+	if !currencyPattern.MatchString(a.Currency) {
+		return fmt.Errorf("currency %q is not an ISO 4217 code", a.Currency)
+	}
+	if a.DebtorParty.AccountNumber == "" {
+		return errors.New("debtor_party.account_number is required")
+	}
+	if a.BeneficiaryParty.AccountNumber == "" {
+		return errors.New("beneficiary_party.account_number is required")
+	}
+	if a.ProcessingDate != "" && !datePattern.MatchString(a.ProcessingDate) {
+		return fmt.Errorf("processing_date %q is not in YYYY-MM-DD format", a.ProcessingDate)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/clD11/form3-payments/httpstatus"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// ErrorWriter answers a request with errors in the format the client negotiated
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, errs ...*jsonapi.Error)
+
+// Middleware rejects request documents that do not match the spec with writeError and logs responses
+// that do not. Requests for routes or media types the spec does not describe as JSON are passed through.
+func Middleware(d *Document, writeError ErrorWriter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			operation := d.operation(r)
+			if operation == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if schema := bodySchema(operation.RequestBody, r.Header.Get("Content-Type")); schema != nil {
+				body, err := ioutil.ReadAll(r.Body)
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+				if err != nil {
+					// the handler reports the failed read, such as a body over the limit, as it would unvalidated
+					r.Body = ioutil.NopCloser(io.MultiReader(r.Body, failedReader{err}))
+				}
+
+				var value interface{}
+				if err == nil && json.Unmarshal(body, &value) == nil {
+					if violations := d.Validate(schema, value); len(violations) > 0 {
+						writeError(w, r, violationErrors(violations)...)
+						return
+					}
+				}
+			}
+
+			recorder := &responseRecorder{Recorder: httpstatus.NewRecorder(w)}
+			next.ServeHTTP(recorder, r)
+
+			response, ok := operation.Responses[strconv.Itoa(recorder.Status)]
+			if !ok {
+				logging.FromContext(r.Context()).Warn("openapi: response status not in spec", "status", recorder.Status)
+				return
+			}
+			var content map[string]*MediaType
+			if response != nil {
+				content = response.Content
+			}
+			if schema := mediaSchema(content, recorder.Header().Get("Content-Type")); schema != nil {
+				var value interface{}
+				if err := json.Unmarshal(recorder.body.Bytes(), &value); err != nil {
+					logging.FromContext(r.Context()).Warn("openapi: response is not valid JSON", "error", err)
+					return
+				}
+				for _, violation := range d.Validate(schema, value) {
+					logging.FromContext(r.Context()).Warn("openapi: response does not match spec", "violation", violation)
+				}
+			}
+		})
+	}
+}
+
+func (d *Document) operation(r *http.Request) *Operation {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	path, ok := d.Paths[template]
+	if !ok {
+		return nil
+	}
+	return path.Operations()[r.Method]
+}
+
+func bodySchema(body *RequestBody, contentType string) *Schema {
+	if body == nil {
+		return nil
+	}
+	return mediaSchema(body.Content, contentType)
+}
+
+// mediaSchema returns the schema for JSON media types, other media types are not validated
+func mediaSchema(content map[string]*MediaType, contentType string) *Schema {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != jsonapi.MediaType && mediaType != jsonType) {
+		return nil
+	}
+	media, ok := content[mediaType]
+	if !ok {
+		return nil
+	}
+	return media.Schema
+}
+
+func violationErrors(violations []Violation) []*jsonapi.Error {
+	errs := make([]*jsonapi.Error, len(violations))
+	for i, violation := range violations {
+		errs[i] = jsonapi.NewError(http.StatusBadRequest, "invalid_document", violation.Message).WithPointer(violation.Pointer)
+	}
+	return errs
+}
+
+// failedReader fails every read with err
+type failedReader struct {
+	err error
+}
+
+func (r failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// responseRecorder passes the response through while keeping a copy of the status and body
+type responseRecorder struct {
+	*httpstatus.Recorder
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
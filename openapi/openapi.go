@@ -0,0 +1,258 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Document is the subset of an OpenAPI 3 document this service describes itself with
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+// Operations returns the operations of the path keyed by upper case HTTP method
+func (p *PathItem) Operations() map[string]*Operation {
+	operations := map[string]*Operation{}
+	for method, operation := range map[string]*Operation{
+		"GET": p.Get, "POST": p.Post, "PUT": p.Put, "PATCH": p.Patch, "DELETE": p.Delete,
+	} {
+		if operation != nil {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON schema used to describe the payment resources
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+
+	// pattern is Pattern compiled when the document is built
+	pattern *regexp.Regexp
+}
+
+// Violation describes where a value does not match its schema
+type Violation struct {
+	Pointer string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Pointer, v.Message)
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Validate checks a decoded JSON value against the schema, resolving references from the document
+func (d *Document) Validate(schema *Schema, value interface{}) []Violation {
+	return d.validate(schema, value, "")
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, pointer string) []Violation {
+	if schema.Ref != "" {
+		resolved, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return []Violation{{pointer, "unknown schema " + schema.Ref}}
+		}
+		return d.validate(resolved, value, pointer)
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return []Violation{{pointer, "must not be null"}}
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []Violation{{pointer, "must be an object"}}
+		}
+		return d.validateObject(schema, object, pointer)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []Violation{{pointer, "must be an array"}}
+		}
+		var violations []Violation
+		if schema.Items != nil {
+			for i, item := range array {
+				violations = append(violations, d.validate(schema.Items, item, fmt.Sprintf("%s/%d", pointer, i))...)
+			}
+		}
+		return violations
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []Violation{{pointer, "must be a string"}}
+		}
+		return validateString(schema, s, pointer)
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return []Violation{{pointer, "must be an integer"}}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return []Violation{{pointer, "must be a number"}}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []Violation{{pointer, "must be a boolean"}}
+		}
+	}
+	return nil
+}
+
+func (d *Document) validateObject(schema *Schema, object map[string]interface{}, pointer string) []Violation {
+	var violations []Violation
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			violations = append(violations, Violation{pointer + "/" + name, "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok {
+			if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				violations = append(violations, Violation{pointer + "/" + name, "is not allowed"})
+			}
+			continue
+		}
+		violations = append(violations, d.validate(property, object[name], pointer+"/"+name)...)
+	}
+	return violations
+}
+
+func validateString(schema *Schema, s string, pointer string) []Violation {
+	if len(schema.Enum) > 0 {
+		allowed := false
+		for _, value := range schema.Enum {
+			if value == s {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return []Violation{{pointer, fmt.Sprintf("must be one of %s", strings.Join(schema.Enum, ", "))}}
+		}
+	}
+	if schema.Format == "uuid" && !uuidPattern.MatchString(s) {
+		return []Violation{{pointer, "must be a UUID"}}
+	}
+	if schema.pattern != nil && !schema.pattern.MatchString(s) {
+		return []Violation{{pointer, "must match " + schema.Pattern}}
+	}
+	return nil
+}
+
+// compilePatterns compiles the pattern of every schema in the document once, so a pattern that is
+// not a regular expression fails when the spec is built rather than in the request it would check
+func (d *Document) compilePatterns() {
+	for _, schema := range d.Components.Schemas {
+		schema.compilePatterns()
+	}
+	for _, item := range d.Paths {
+		for _, operation := range item.Operations() {
+			for _, parameter := range operation.Parameters {
+				parameter.Schema.compilePatterns()
+			}
+			if operation.RequestBody != nil {
+				for _, media := range operation.RequestBody.Content {
+					media.Schema.compilePatterns()
+				}
+			}
+			for _, response := range operation.Responses {
+				if response == nil {
+					continue
+				}
+				for _, media := range response.Content {
+					media.Schema.compilePatterns()
+				}
+			}
+		}
+	}
+}
+
+func (s *Schema) compilePatterns() {
+	if s == nil {
+		return
+	}
+	if s.Pattern != "" && s.pattern == nil {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+	for _, property := range s.Properties {
+		property.compilePatterns()
+	}
+	s.Items.compilePatterns()
+}
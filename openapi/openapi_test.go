@@ -0,0 +1,60 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSpecShouldDescribeSeedPaymentDocuments(t *testing.T) {
+	var payments []model.Payment
+	data, _ := ioutil.ReadFile("../seeddata.json")
+	json.Unmarshal(data, &payments)
+
+	body, _ := json.Marshal(jsonapi.NewPaymentsDocument(payments, "/v1/payments"))
+	var value interface{}
+	json.Unmarshal(body, &value)
+
+	assert.Empty(t, Spec().Validate(ref("PaymentsDocument"), value))
+}
+
+func TestSpecShouldDescribeEveryAttribute(t *testing.T) {
+	schemas := Spec().Components.Schemas
+	properties := schemas["Attributes"].Properties
+	senderCharges := schemas["ChargesInformation"].Properties["sender_charges"]
+
+	assert.Len(t, properties, 19)
+	assert.Equal(t, ref("DebtorParty"), properties["debtor_party"])
+	assert.Equal(t, "array", senderCharges.Type)
+	assert.Equal(t, ref("Charge"), senderCharges.Items)
+}
+
+func TestValidateShouldReportPointers(t *testing.T) {
+	var value interface{}
+	json.Unmarshal([]byte(`{"data":{"type":"Account","id":"1","attributes":{"amount":10},"extra":true}}`), &value)
+
+	violations := Spec().Validate(ref("PaymentRequestDocument"), value)
+
+	assert.Equal(t, []Violation{
+		{"/data/attributes/amount", "must be a string"},
+		{"/data/extra", "is not allowed"},
+		{"/data/id", "must be a UUID"},
+		{"/data/type", "must be one of Payment"},
+	}, violations)
+}
+
+func TestValidateShouldMatchPatternsCompiledWithDocument(t *testing.T) {
+	d := &Document{Components: Components{Schemas: map[string]*Schema{
+		"Currency": {Type: "string", Pattern: "^[A-Z]{3}$"},
+	}}}
+	d.compilePatterns()
+
+	assert.Empty(t, d.Validate(ref("Currency"), "GBP"))
+	assert.Equal(t, []Violation{{"", "must match ^[A-Z]{3}$"}}, d.Validate(ref("Currency"), "gbp"))
+
+	d.Components.Schemas["Currency"] = &Schema{Type: "string", Pattern: "^[A-Z"}
+	assert.Panics(t, d.compilePatterns)
+}
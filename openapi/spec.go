@@ -0,0 +1,793 @@
+package openapi
+
+import (
+	"github.com/clD11/form3-payments/jsonapi"
+	"github.com/clD11/form3-payments/mandate"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/problem"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/clD11/form3-payments/scheduler"
+	"github.com/clD11/form3-payments/standingorder"
+	uuid "github.com/satori/go.uuid"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	schemaRef = "#/components/schemas/"
+	xmlType   = "application/xml"
+	csvType   = "text/csv"
+	jsonType  = "application/json"
+)
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+var spec = build()
+
+// Spec returns the description of every route the application registers
+func Spec() *Document {
+	return spec
+}
+
+func build() *Document {
+	d := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: "Payment API", Version: "1.0.0"},
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+	}
+
+	d.addModelSchema(reflect.TypeOf(model.Attributes{}))
+	d.addModelSchema(reflect.TypeOf(model.FxRate{}))
+	d.addModelSchema(reflect.TypeOf(model.FxQuote{}))
+	d.addModelSchema(reflect.TypeOf(jsonapi.QuoteRequest{}))
+	d.addModelSchema(reflect.TypeOf(jsonapi.BusinessDay{}))
+	d.addModelSchema(reflect.TypeOf(model.PaymentSchedule{}))
+	d.addModelSchema(reflect.TypeOf(model.StandingOrder{}))
+	d.addModelSchema(reflect.TypeOf(model.MandateEvent{}))
+	d.addResourceSchemas()
+	d.Components.Schemas["Attributes"].Properties["requested_speed"].Enum = []string{routing.Instant, routing.SameDay, routing.Standard}
+	standingOrder := d.Components.Schemas["StandingOrder"].Properties
+	standingOrder["status"].Enum = []string{standingorder.Active, standingorder.Paused, standingorder.Cancelled, standingorder.Completed}
+	standingOrder["frequency"].Enum = []string{standingorder.Weekly, standingorder.Monthly, standingorder.EndOfMonth}
+	standingOrder["business_day_adjustment"].Enum = []string{standingorder.Following, standingorder.Preceding, standingorder.NoAdjustment}
+	d.Components.Schemas["Mandate"].Properties["status"].Enum = []string{mandate.Active, mandate.Cancelled}
+	d.Components.Schemas["MandateEvent"].Properties["event"].Enum = []string{mandate.Setup, mandate.Amend, mandate.Cancel}
+
+	idParameter := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}}
+	paymentRequest := documentBody("PaymentRequestDocument")
+
+	d.Paths["/v1/payments"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listPayments",
+			Summary:     "List payments a page at a time, CSV exports hold every payment",
+			Parameters: []Parameter{
+				filterParameter("organisation_id", "uuid"),
+				filterParameter("currency", ""),
+				filterParameter("payment_scheme", ""),
+				filterParameter("payment_type", ""),
+				filterParameter("processing_date", "date"),
+				filterParameter("scheme_payment_type", ""),
+				{Name: "page[number]", In: "query", Description: "Page to return numbered from 1", Schema: &Schema{Type: "integer"}},
+				{Name: "page[size]", In: "query", Description: "Payments per page, at most 1000", Schema: &Schema{Type: "integer"}},
+			},
+			Responses: map[string]*Response{
+				"200": {
+					Description: "Payments",
+					Content: map[string]*MediaType{
+						jsonapi.MediaType: {Schema: ref("PaymentsDocument")},
+						csvType:           {Schema: &Schema{Type: "string"}},
+					},
+				},
+				"400": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+		Post: &Operation{
+			OperationID: "createPayment",
+			Summary:     "Create a payment",
+			Parameters: []Parameter{
+				{Name: "Idempotency-Key", In: "header", Description: "Repeating a request with the same key returns the payment it created", Schema: &Schema{Type: "string"}},
+			},
+			RequestBody: paymentRequest,
+			Responses: map[string]*Response{
+				"201": documentResponse("Created payment", "PaymentDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/payments/{id}"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getPayment",
+			Summary:     "Fetch a payment",
+			Parameters:  []Parameter{idParameter},
+			Responses: map[string]*Response{
+				"200": documentResponse("Payment", "PaymentDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+		Put:   updateOperation("replacePayment", "Update the members of a payment present in the request like PATCH, members left out keep their values", idParameter, paymentRequest),
+		Patch: updateOperation("updatePayment", "Update the members of a payment present in the request", idParameter, paymentRequest),
+		Delete: &Operation{
+			OperationID: "deletePayment",
+			Summary:     "Delete a payment",
+			Parameters:  []Parameter{idParameter},
+			Responses: map[string]*Response{
+				"204": {Description: "Payment deleted"},
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/payments/pain001"] = &PathItem{
+		Post: &Operation{
+			OperationID: "importPain001",
+			Summary:     "Create payments from a pain.001.001.09 customer credit transfer initiation",
+			Parameters: []Parameter{
+				{Name: "organisation_id", In: "query", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}},
+			},
+			RequestBody: &RequestBody{Required: true, Content: map[string]*MediaType{xmlType: {Schema: &Schema{Type: "string"}}}},
+			Responses: map[string]*Response{
+				"200": {Description: "pain.002 status report", Content: map[string]*MediaType{xmlType: {Schema: &Schema{Type: "string"}}}},
+				"400": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/payments/csv"] = &PathItem{
+		Post: &Operation{
+			OperationID: "importCSV",
+			Summary:     "Create payments from CSV rows",
+			Parameters: []Parameter{
+				{Name: "mapping", In: "query", Description: "header:column pairs separated by commas", Schema: &Schema{Type: "string"}},
+			},
+			RequestBody: &RequestBody{Required: true, Content: map[string]*MediaType{csvType: {Schema: &Schema{Type: "string"}}}},
+			Responses: map[string]*Response{
+				"200": documentResponse("Some rows were rejected", "ImportReportDocument"),
+				"201": documentResponse("Every row was created", "ImportReportDocument"),
+				"400": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/payments/charges"] = &PathItem{
+		Post: &Operation{
+			OperationID: "previewCharges",
+			Summary:     "Price a draft payment with the fee schedule without creating it",
+			RequestBody: paymentRequest,
+			Responses: map[string]*Response{
+				"200": documentResponse("Charges the payment would be created with", "ChargesPreviewDocument"),
+				"400": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/exports/bacs"] = &PathItem{
+		Get: &Operation{
+			OperationID: "exportBacs",
+			Summary:     "Export Bacs payments as a Standard 18 file",
+			Parameters: []Parameter{
+				{Name: "processing_date", In: "query", Schema: &Schema{Type: "string", Format: "date"}},
+				{Name: "serial", In: "query", Schema: &Schema{Type: "string"}},
+			},
+			Responses: map[string]*Response{
+				"200": {Description: "Standard 18 file", Content: map[string]*MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/fx/rates"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listFxRates",
+			Summary:     "List stored FX rates, newest first for each currency pair",
+			Parameters: []Parameter{
+				{Name: "filter[base_currency]", In: "query", Description: "Only rates converting from the currency", Schema: &Schema{Type: "string"}},
+				{Name: "filter[quote_currency]", In: "query", Description: "Only rates converting into the currency", Schema: &Schema{Type: "string"}},
+				{Name: "at", In: "query", Description: "Only the rate of each pair in effect at the time", Schema: &Schema{Type: "string", Format: "date-time"}},
+				{Name: "page[number]", In: "query", Description: "Page to return numbered from 1", Schema: &Schema{Type: "integer"}},
+				{Name: "page[size]", In: "query", Description: "Rates per page, at most 1000", Schema: &Schema{Type: "integer"}},
+			},
+			Responses: map[string]*Response{
+				"200": documentResponse("Rates", "FxRatesDocument"),
+				"400": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+		Post: &Operation{
+			OperationID: "createFxRate",
+			Summary:     "Store a rate, replacing one for the same pair and effective time",
+			RequestBody: documentBody("FxRateDocument"),
+			Responses: map[string]*Response{
+				"201": documentResponse("Stored rate", "FxRateDocument"),
+				"400": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/fx/rates/csv"] = &PathItem{
+		Post: &Operation{
+			OperationID: "importFxRates",
+			Summary:     "Store every rate in a base_currency,quote_currency,rate,effective_at file, or none if a row is invalid",
+			RequestBody: &RequestBody{Required: true, Content: map[string]*MediaType{csvType: {Schema: &Schema{Type: "string"}}}},
+			Responses: map[string]*Response{
+				"201": documentResponse("Stored rates", "FxRatesDocument"),
+				"400": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/fx/quotes"] = &PathItem{
+		Post: &Operation{
+			OperationID: "createFxQuote",
+			Summary:     "Quote a conversion at the rate in effect, a payment can be booked against its contract reference until it expires",
+			RequestBody: documentBody("FxQuoteRequestDocument"),
+			Responses: map[string]*Response{
+				"201": documentResponse("Quote", "FxQuoteDocument"),
+				"400": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/schedules"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listSchedules",
+			Summary:     "List payments held for a future processing date, soonest first",
+			Parameters: []Parameter{
+				{Name: "filter[status]", In: "query", Description: "scheduled, the default, submitted, failed or cancelled",
+					Schema: &Schema{Type: "string", Enum: []string{scheduler.Scheduled, scheduler.Submitted, scheduler.Failed, scheduler.Cancelled}}},
+				{Name: "from", In: "query", Description: "Only processing dates on or after the date", Schema: &Schema{Type: "string", Format: "date"}},
+				{Name: "to", In: "query", Description: "Only processing dates on or before the date", Schema: &Schema{Type: "string", Format: "date"}},
+				{Name: "page[number]", In: "query", Description: "Page to return numbered from 1", Schema: &Schema{Type: "integer"}},
+				{Name: "page[size]", In: "query", Description: "Schedules per page, at most 1000", Schema: &Schema{Type: "integer"}},
+			},
+			Responses: map[string]*Response{
+				"200": documentResponse("Schedules", "PaymentSchedulesDocument"),
+				"400": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/standing-orders"] = &PathItem{
+		Post: &Operation{
+			OperationID: "createStandingOrder",
+			Summary:     "Create a standing order that makes a payment from its template on each occurrence of its rule",
+			RequestBody: documentBody("StandingOrderRequestDocument"),
+			Responses: map[string]*Response{
+				"201": documentResponse("Created standing order", "StandingOrderDocument"),
+				"400": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/standing-orders/{id}"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getStandingOrder",
+			Summary:     "Fetch a standing order and its next occurrence",
+			Parameters:  []Parameter{idParameter},
+			Responses: map[string]*Response{
+				"200": documentResponse("Standing order", "StandingOrderDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+		Patch: &Operation{
+			OperationID: "updateStandingOrder",
+			Summary:     "Amend, pause, resume or cancel the future occurrences of a standing order",
+			Parameters:  []Parameter{idParameter},
+			RequestBody: documentBody("StandingOrderRequestDocument"),
+			Responses: map[string]*Response{
+				"200": documentResponse("Updated standing order", "StandingOrderDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/standing-orders/{id}/payments"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listStandingOrderPayments",
+			Summary:     "List the payments a standing order made, by processing date",
+			Parameters: []Parameter{
+				idParameter,
+				{Name: "page[number]", In: "query", Description: "Page to return numbered from 1", Schema: &Schema{Type: "integer"}},
+				{Name: "page[size]", In: "query", Description: "Payments per page, at most 1000", Schema: &Schema{Type: "integer"}},
+			},
+			Responses: map[string]*Response{
+				"200": documentResponse("Payments", "PaymentsDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/mandates"] = &PathItem{
+		Post: &Operation{
+			OperationID: "createMandate",
+			Summary:     "Set up the mandate a debtor gave to collect Debit payments from their account",
+			RequestBody: documentBody("MandateRequestDocument"),
+			Responses: map[string]*Response{
+				"201": documentResponse("Created mandate", "MandateDocument"),
+				"400": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/mandates/{id}"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getMandate",
+			Summary:     "Fetch a mandate",
+			Parameters:  []Parameter{idParameter},
+			Responses: map[string]*Response{
+				"200": documentResponse("Mandate", "MandateDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+		Patch: &Operation{
+			OperationID: "updateMandate",
+			Summary:     "Amend a mandate, or cancel it by setting its status to cancelled",
+			Parameters:  []Parameter{idParameter},
+			RequestBody: documentBody("MandateRequestDocument"),
+			Responses: map[string]*Response{
+				"200": documentResponse("Updated mandate", "MandateDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"409": errorResponse(),
+				"415": errorResponse(),
+				"422": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/mandates/{id}/events"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listMandateEvents",
+			Summary:     "The setup, amendments and cancellation of a mandate, oldest first",
+			Parameters:  []Parameter{idParameter},
+			Responses: map[string]*Response{
+				"200": documentResponse("Mandate events", "MandateEventsDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/calendars/{scheme}/next-business-day"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getNextBusinessDay",
+			Summary:     "The first day after a date that a scheme processes payments in a currency, and its cut-off",
+			Parameters: []Parameter{
+				{Name: "scheme", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+				{Name: "currency", In: "query", Description: "Also skip the currency's holidays", Schema: &Schema{Type: "string"}},
+				{Name: "date", In: "query", Description: "Defaults to today where the scheme is", Schema: &Schema{Type: "string", Format: "date"}},
+			},
+			Responses: map[string]*Response{
+				"200": documentResponse("Business day", "BusinessDayDocument"),
+				"400": errorResponse(),
+				"404": errorResponse(),
+				"500": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/v1/openapi.json"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getOpenAPI",
+			Summary:     "This document",
+			Responses: map[string]*Response{
+				"200": {Description: "OpenAPI document", Content: map[string]*MediaType{jsonType: {Schema: &Schema{Type: "object"}}}},
+			},
+		},
+	}
+
+	d.Paths["/v1/problems"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listProblemTypes",
+			Summary:     "Every error code the API returns",
+			Responses: map[string]*Response{
+				"200": {Description: "Problem types", Content: map[string]*MediaType{jsonType: {Schema: &Schema{Type: "array", Items: ref("ProblemType")}}}},
+			},
+		},
+	}
+
+	d.Paths["/v1/problems/{code}"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getProblemType",
+			Summary:     "Describe an error code, the type URI of problem details documents",
+			Parameters:  []Parameter{{Name: "code", In: "path", Required: true, Schema: &Schema{Type: "string"}}},
+			Responses: map[string]*Response{
+				"200": {Description: "Problem type", Content: map[string]*MediaType{jsonType: {Schema: ref("ProblemType")}}},
+				"404": errorResponse(),
+			},
+		},
+	}
+
+	d.Paths["/metrics"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getMetrics",
+			Summary:     "Prometheus metrics for requests, database queries and created payments",
+			Responses: map[string]*Response{
+				"200": {Description: "Prometheus text exposition format", Content: map[string]*MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+			},
+		},
+	}
+
+	d.Paths["/healthz"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getHealth",
+			Summary:     "Liveness, the process is serving requests",
+			Responses: map[string]*Response{
+				"200": healthResponse("Alive"),
+			},
+		},
+	}
+
+	d.Paths["/readyz"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getReadiness",
+			Summary:     "Readiness, the database is reachable and migrated and background workers are running",
+			Responses: map[string]*Response{
+				"200": healthResponse("Every check passed"),
+				"503": healthResponse("A check failed"),
+			},
+		},
+	}
+
+	// operations with a body reject ones over the size limit
+	for _, operation := range []*Operation{
+		d.Paths["/v1/payments"].Post, d.Paths["/v1/payments/{id}"].Put, d.Paths["/v1/payments/{id}"].Patch,
+		d.Paths["/v1/payments/pain001"].Post, d.Paths["/v1/payments/csv"].Post, d.Paths["/v1/payments/charges"].Post,
+		d.Paths["/v1/fx/rates"].Post, d.Paths["/v1/fx/rates/csv"].Post, d.Paths["/v1/fx/quotes"].Post,
+		d.Paths["/v1/standing-orders"].Post, d.Paths["/v1/standing-orders/{id}"].Patch,
+		d.Paths["/v1/mandates"].Post, d.Paths["/v1/mandates/{id}"].Patch,
+	} {
+		operation.Responses["413"] = errorResponse()
+	}
+
+	// any API route may be rate limited
+	for path, item := range d.Paths {
+		if strings.HasPrefix(path, "/v1/") {
+			for _, operation := range item.Operations() {
+				operation.Responses["429"] = errorResponse()
+			}
+		}
+	}
+
+	d.compilePatterns()
+	return d
+}
+
+func healthResponse(description string) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{jsonType: {Schema: ref("HealthReport")}}}
+}
+
+func updateOperation(id, summary string, idParameter Parameter, body *RequestBody) *Operation {
+	return &Operation{
+		OperationID: id,
+		Summary:     summary,
+		Parameters:  []Parameter{idParameter},
+		RequestBody: body,
+		Responses: map[string]*Response{
+			"200": documentResponse("Updated payment", "PaymentDocument"),
+			"400": errorResponse(),
+			"404": errorResponse(),
+			"409": errorResponse(),
+			"415": errorResponse(),
+			"422": errorResponse(),
+			"500": errorResponse(),
+		},
+	}
+}
+
+func filterParameter(name, format string) Parameter {
+	return Parameter{Name: "filter[" + name + "]", In: "query", Description: "Only payments whose " + name + " matches",
+		Schema: &Schema{Type: "string", Format: format}}
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: schemaRef + name}
+}
+
+func documentBody(name string) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]*MediaType{jsonapi.MediaType: {Schema: ref(name)}}}
+}
+
+func documentResponse(description, name string) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{jsonapi.MediaType: {Schema: ref(name)}}}
+}
+
+// errorResponse is a JSON:API error document, or problem details for clients that accept them
+func errorResponse() *Response {
+	response := documentResponse("Error", "ErrorDocument")
+	response.Content[problem.MediaType] = &MediaType{Schema: ref("ProblemDetails")}
+	return response
+}
+
+func object(required []string, properties map[string]*Schema) *Schema {
+	closed := false
+	return &Schema{Type: "object", Required: required, Properties: properties, AdditionalProperties: &closed}
+}
+
+// addModelSchema describes a model struct from its json tags so the schema follows the code
+func (d *Document) addModelSchema(t reflect.Type) *Schema {
+	name := t.Name()
+	if _, ok := d.Components.Schemas[name]; !ok {
+		properties := map[string]*Schema{}
+		schema := object(nil, properties)
+		d.Components.Schemas[name] = schema
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := strings.Split(field.Tag.Get("json"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			properties[tag] = d.fieldSchema(field.Type)
+		}
+	}
+	return ref(name)
+}
+
+func (d *Document) fieldSchema(t reflect.Type) *Schema {
+	switch {
+	case t == uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return d.fieldSchema(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return d.addModelSchema(t)
+	case t.Kind() == reflect.Slice:
+		return &Schema{Type: "array", Items: d.fieldSchema(t.Elem()), Nullable: true}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+func (d *Document) addResourceSchemas() {
+	schemas := d.Components.Schemas
+	uuidString := &Schema{Type: "string", Format: "uuid"}
+	links := &Schema{Type: "object", Properties: map[string]*Schema{
+		"self": {Type: "string"}, "first": {Type: "string"}, "prev": {Type: "string"}, "next": {Type: "string"},
+	}}
+	implementation := &Schema{Type: "object", Properties: map[string]*Schema{"version": {Type: "string"}}}
+
+	organisation := object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "id"}, map[string]*Schema{
+			"type": {Type: "string", Enum: []string{jsonapi.OrganisationType}},
+			"id":   uuidString,
+		}),
+	})
+	// payments a standing order made are related back to it
+	standingOrder := object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "id"}, map[string]*Schema{
+			"type": {Type: "string", Enum: []string{jsonapi.StandingOrderType}},
+			"id":   uuidString,
+		}),
+	})
+	resourceMembers := func() map[string]*Schema {
+		return map[string]*Schema{
+			"type":          {Type: "string", Enum: []string{jsonapi.PaymentType}},
+			"id":            uuidString,
+			"attributes":    ref("Attributes"),
+			"relationships": object(nil, map[string]*Schema{"organisation": organisation, "standing_order": standingOrder}),
+			"meta":          object(nil, map[string]*Schema{"version": {Type: "integer"}}),
+			"links":         links,
+		}
+	}
+
+	schemas["PaymentResource"] = object([]string{"type", "id", "attributes"}, resourceMembers())
+	schemas["PaymentRequestResource"] = object([]string{"type"}, resourceMembers())
+
+	schemas["PaymentDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": ref("PaymentResource"), "links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+	schemas["PaymentsDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": {Type: "array", Items: ref("PaymentResource")}, "links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+	schemas["PaymentRequestDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": ref("PaymentRequestResource"), "links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+
+	rateResource := object([]string{"type", "attributes"}, map[string]*Schema{
+		"type":       {Type: "string", Enum: []string{jsonapi.FxRateType}},
+		"id":         {Type: "string"},
+		"attributes": ref("FxRate"),
+	})
+	schemas["FxRateDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": rateResource, "links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+	schemas["FxRatesDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": {Type: "array", Items: rateResource}, "links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+
+	schemas["FxQuoteDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "id", "attributes"}, map[string]*Schema{
+			"type":       {Type: "string", Enum: []string{jsonapi.FxQuoteType}},
+			"id":         {Type: "string"},
+			"attributes": ref("FxQuote"),
+		}),
+		"links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+	schemas["FxQuoteRequestDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "attributes"}, map[string]*Schema{
+			"type":       {Type: "string", Enum: []string{jsonapi.FxQuoteType}},
+			"attributes": ref("QuoteRequest"),
+		}),
+		"meta": {Type: "object"}, "jsonapi": implementation,
+	})
+
+	schemas["PaymentSchedulesDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": {Type: "array", Items: object([]string{"type", "id", "attributes"}, map[string]*Schema{
+			"type":          {Type: "string", Enum: []string{jsonapi.PaymentScheduleType}},
+			"id":            uuidString,
+			"attributes":    ref("PaymentSchedule"),
+			"relationships": {Type: "object"},
+			"links":         links,
+		})},
+		"links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+
+	standingOrderMembers := func() map[string]*Schema {
+		return map[string]*Schema{
+			"type":          {Type: "string", Enum: []string{jsonapi.StandingOrderType}},
+			"id":            uuidString,
+			"attributes":    ref("StandingOrder"),
+			"relationships": object(nil, map[string]*Schema{"organisation": organisation}),
+			"links":         links,
+		}
+	}
+	schemas["StandingOrderDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "id", "attributes"}, standingOrderMembers()), "links": links, "jsonapi": implementation,
+	})
+	schemas["StandingOrderRequestDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type"}, standingOrderMembers()), "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+
+	mandateMembers := func() map[string]*Schema {
+		return map[string]*Schema{
+			"type":          {Type: "string", Enum: []string{jsonapi.MandateType}},
+			"id":            uuidString,
+			"attributes":    ref("Mandate"),
+			"relationships": object(nil, map[string]*Schema{"organisation": organisation}),
+			"links":         links,
+		}
+	}
+	schemas["MandateDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "id", "attributes"}, mandateMembers()), "links": links, "jsonapi": implementation,
+	})
+	schemas["MandateRequestDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type"}, mandateMembers()), "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+	schemas["MandateEventsDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": {Type: "array", Items: object([]string{"type", "id", "attributes"}, map[string]*Schema{
+			"type":          {Type: "string", Enum: []string{jsonapi.MandateEventType}},
+			"id":            {Type: "string"},
+			"attributes":    ref("MandateEvent"),
+			"relationships": {Type: "object"},
+		})},
+		"links": links, "meta": {Type: "object"}, "jsonapi": implementation,
+	})
+
+	schemas["BusinessDayDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data": object([]string{"type", "id", "attributes"}, map[string]*Schema{
+			"type":       {Type: "string", Enum: []string{jsonapi.BusinessDayType}},
+			"id":         {Type: "string"},
+			"attributes": ref("BusinessDay"),
+		}),
+		"links": links, "jsonapi": implementation,
+	})
+
+	schemas["ChargesPreviewDocument"] = object([]string{"meta"}, map[string]*Schema{
+		"meta": object([]string{"charges_information"}, map[string]*Schema{
+			"charges_information": ref("ChargesInformation"),
+			"fee_rule":            {Type: "string"},
+			"routing":             {Type: "object"},
+		}),
+		"jsonapi": implementation,
+	})
+
+	schemas["ResourceIdentifier"] = object([]string{"type", "id"}, map[string]*Schema{
+		"type": {Type: "string"}, "id": {Type: "string"},
+	})
+	schemas["ImportReportDocument"] = object([]string{"data"}, map[string]*Schema{
+		"data":    {Type: "array", Items: ref("ResourceIdentifier")},
+		"meta":    {Type: "object"},
+		"jsonapi": implementation,
+	})
+
+	schemas["Error"] = object([]string{"status"}, map[string]*Schema{
+		"status": {Type: "string"},
+		"code":   {Type: "string"},
+		"title":  {Type: "string"},
+		"detail": {Type: "string"},
+		"source": object(nil, map[string]*Schema{"pointer": {Type: "string"}, "parameter": {Type: "string"}}),
+		"meta":   object(nil, map[string]*Schema{"offset": {Type: "integer"}}),
+	})
+	status := &Schema{Type: "string", Enum: []string{"pass", "fail"}}
+	schemas["HealthReport"] = object([]string{"status", "checks"}, map[string]*Schema{
+		"status": status,
+		"checks": {Type: "object", Description: "Results keyed by check name"},
+	})
+
+	var codes []string
+	for _, t := range problem.Catalogue() {
+		codes = append(codes, t.Code)
+	}
+	code := &Schema{Type: "string", Enum: codes}
+	schemas["ProblemType"] = object([]string{"code", "status", "title", "description"}, map[string]*Schema{
+		"code":        code,
+		"status":      {Type: "integer"},
+		"title":       {Type: "string"},
+		"description": {Type: "string"},
+	})
+	schemas["ProblemDetails"] = object([]string{"type", "title", "status", "code"}, map[string]*Schema{
+		"type":       {Type: "string"},
+		"title":      {Type: "string"},
+		"status":     {Type: "integer"},
+		"detail":     {Type: "string"},
+		"instance":   {Type: "string"},
+		"code":       code,
+		"request_id": {Type: "string"},
+		"pointer":    {Type: "string"},
+		"parameter":  {Type: "string"},
+		"offset":     {Type: "integer"},
+	})
+
+	schemas["ErrorDocument"] = object([]string{"errors"}, map[string]*Schema{
+		"errors": {Type: "array", Items: ref("Error")}, "jsonapi": implementation,
+	})
+}
@@ -0,0 +1,239 @@
+package paymentcsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const ContentType = "text/csv"
+
+var (
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	chargesType = reflect.TypeOf([]model.Charge{})
+	columns     = flatten(reflect.TypeOf(model.Payment{}), "", nil)
+)
+
+type column struct {
+	path  string
+	index []int
+}
+
+// Columns returns the dotted column names used for payments, in the order they are written
+func Columns() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.path
+	}
+	return names
+}
+
+// flatten walks the json tags of the struct so nested parties become dotted columns
+func flatten(t reflect.Type, prefix string, index []int) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+		if field.Type.Kind() == reflect.Struct && field.Type != uuidType {
+			cols = append(cols, flatten(field.Type, prefix+name+".", fieldIndex)...)
+			continue
+		}
+		cols = append(cols, column{path: prefix + name, index: fieldIndex})
+	}
+	return cols
+}
+
+// Write renders the payments as CSV with a header row of dotted column names
+func Write(w io.Writer, payments []model.Payment) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns()); err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		v := reflect.ValueOf(payment)
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = format(v.FieldByIndex(c.index))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Mapping maps CSV header names onto dotted column names. Headers that are not mapped are
+// expected to be column names themselves.
+type Mapping map[string]string
+
+// ParseMapping reads a mapping in the form "Header:column,Other Header:other.column"
+func ParseMapping(value string) (Mapping, error) {
+	mapping := Mapping{}
+	if value == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("mapping %q must be in the form header:column", pair)
+		}
+		mapping[parts[0]] = parts[1]
+	}
+	return mapping, nil
+}
+
+// Row is a payment read from a CSV line along with any problems decoding it
+type Row struct {
+	Line    int
+	Payment model.Payment
+	Errors  []FieldError
+}
+
+type FieldError struct {
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Read decodes payments from CSV. Errors in individual cells are reported on the row rather
+// than failing the whole file, only an unreadable file or unknown header returns an error.
+// A malformed record is reported on its row, any other read error fails the file.
+func Read(r io.Reader, mapping Mapping) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+
+	byPath := map[string]column{}
+	for _, c := range columns {
+		byPath[c.path] = c
+	}
+
+	fields := make([]column, len(header))
+	for i, name := range header {
+		path := strings.TrimSpace(name)
+		if mapped, ok := mapping[path]; ok {
+			path = mapped
+		}
+		c, ok := byPath[path]
+		if !ok {
+			return nil, fmt.Errorf("column %q does not map onto a payment field", name)
+		}
+		fields[i] = c
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row := Row{Line: line}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, fmt.Errorf("could not read line %d: %s", line, err)
+			}
+			row.Errors = append(row.Errors, FieldError{Message: err.Error()})
+			rows = append(rows, row)
+			continue
+		}
+		if len(record) != len(header) {
+			row.Errors = append(row.Errors, FieldError{Message: fmt.Sprintf("expected %d fields but found %d", len(header), len(record))})
+			rows = append(rows, row)
+			continue
+		}
+
+		v := reflect.ValueOf(&row.Payment).Elem()
+		for i, value := range record {
+			if err := parse(v.FieldByIndex(fields[i].index), value); err != nil {
+				row.Errors = append(row.Errors, FieldError{Column: fields[i].path, Message: err.Error()})
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func format(v reflect.Value) string {
+	switch {
+	case v.Type() == uuidType:
+		if uuid.Equal(v.Interface().(uuid.UUID), uuid.Nil) {
+			return ""
+		}
+		return v.Interface().(uuid.UUID).String()
+	case v.Type() == chargesType:
+		charges := v.Interface().([]model.Charge)
+		parts := make([]string, len(charges))
+		for i, charge := range charges {
+			parts[i] = charge.Currency + " " + charge.Amount
+		}
+		return strings.Join(parts, ";")
+	case v.Kind() == reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case v.Kind() == reflect.Uint:
+		return strconv.FormatUint(v.Uint(), 10)
+	default:
+		return v.String()
+	}
+}
+
+func parse(v reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch {
+	case v.Type() == uuidType:
+		if value == "" {
+			return nil
+		}
+		id, err := uuid.FromString(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid UUID", value)
+		}
+		v.Set(reflect.ValueOf(id))
+	case v.Type() == chargesType:
+		var charges []model.Charge
+		for _, part := range strings.Split(value, ";") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			fields := strings.Fields(part)
+			if len(fields) != 2 {
+				return fmt.Errorf("charge %q must be in the form \"CCY amount\"", part)
+			}
+			charges = append(charges, model.Charge{Currency: fields[0], Amount: fields[1]})
+		}
+		v.Set(reflect.ValueOf(charges))
+	case v.Kind() == reflect.Int:
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Uint:
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a positive whole number", value)
+		}
+		v.SetUint(n)
+	default:
+		v.SetString(value)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package paymentcsv
+
+import (
+	"bytes"
+	"errors"
+	"github.com/clD11/form3-payments/internal/fixture"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteAndReadShouldRoundTripSeedData(t *testing.T) {
+	payments := fixture.SeedPayments(t)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, payments))
+
+	rows, err := Read(&buf, Mapping{})
+	assert.NoError(t, err)
+	assert.Len(t, rows, len(payments))
+	for i, row := range rows {
+		assert.Empty(t, row.Errors)
+		assert.Equal(t, payments[i], row.Payment)
+	}
+}
+
+func TestWriteShouldFlattenNestedFieldsIntoDottedColumns(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, fixture.SeedPayments(t)[:1]))
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Contains(t, lines[0], "attributes.beneficiary_party.account_name")
+	assert.Contains(t, lines[0], "attributes.charges_information.sender_charges")
+	assert.Contains(t, lines[1], "GBP 5.00;USD 10.00")
+}
+
+func TestReadShouldApplyColumnMapping(t *testing.T) {
+	mapping, err := ParseMapping("Amount:attributes.amount,Ccy:attributes.currency")
+	assert.NoError(t, err)
+
+	rows, err := Read(strings.NewReader("Amount,Ccy\n10.50,EUR\n"), mapping)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "10.50", rows[0].Payment.Attributes.Amount)
+	assert.Equal(t, "EUR", rows[0].Payment.Attributes.Currency)
+}
+
+func TestReadShouldReportErrorsPerRow(t *testing.T) {
+	data := "id,version,attributes.charges_information.sender_charges\n" +
+		"not-a-uuid,1,GBP 5.00\n" +
+		",x,GBP\n"
+
+	rows, err := Read(strings.NewReader(data), Mapping{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldError{{Column: "id", Message: `"not-a-uuid" is not a valid UUID`}}, rows[0].Errors)
+	assert.Equal(t, 3, rows[1].Line)
+	assert.Equal(t, []FieldError{
+		{Column: "version", Message: `"x" is not a positive whole number`},
+		{Column: "attributes.charges_information.sender_charges", Message: `charge "GBP" must be in the form "CCY amount"`},
+	}, rows[1].Errors)
+}
+
+func TestReadShouldFailForUnknownColumn(t *testing.T) {
+	_, err := Read(strings.NewReader("amount\n10.00\n"), Mapping{})
+
+	assert.EqualError(t, err, `column "amount" does not map onto a payment field`)
+}
+
+func TestReadShouldFailWhenReaderFails(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("amount\n10.00\n"), failingReader{})
+
+	_, err := Read(r, Mapping{"amount": "attributes.amount"})
+
+	assert.EqualError(t, err, "could not read line 3: connection reset")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
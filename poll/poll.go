@@ -0,0 +1,58 @@
+package poll
+
+import (
+	"context"
+	"github.com/clD11/form3-payments/logging"
+	"time"
+)
+
+// Batch does one batch of a worker's due work and returns how many items it took
+type Batch func() (int, error)
+
+// Run calls batch every interval until the context is cancelled. A full batch suggests more is due
+// so the next one runs straight away. A batch that fails is logged and tried again on the next
+// tick, so the database being briefly unavailable is not fatal.
+func Run(ctx context.Context, name string, interval time.Duration, batchSize int, batch Batch) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := batch()
+			if err != nil {
+				logging.Default.Error("could not run batch", "worker", name, "error", err)
+			}
+			if err != nil || n < batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Interval is the configured interval, or the worker's default when none was set
+func Interval(configured, fallback time.Duration) time.Duration {
+	if configured <= 0 {
+		return fallback
+	}
+	return configured
+}
+
+// BatchSize is the configured batch size, or the worker's default when none was set
+func BatchSize(configured, fallback int) int {
+	if configured <= 0 {
+		return fallback
+	}
+	return configured
+}
+
+// Now reads the worker's clock in UTC, time.Now when it has none
+func Now(clock func() time.Time) time.Time {
+	if clock == nil {
+		return time.Now().UTC()
+	}
+	return clock().UTC()
+}
@@ -0,0 +1,54 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRunShouldRepeatFullBatchesAndStopWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sizes := []int{10, 10, 3}
+	var calls int
+	batch := func() (int, error) {
+		calls++
+		if calls == len(sizes) {
+			cancel()
+		}
+		return sizes[calls-1], nil
+	}
+
+	// the interval is too long for a tick, so every batch ran on the first
+	assert.NoError(t, Run(ctx, "test", time.Hour, 10, batch))
+	assert.Equal(t, len(sizes), calls)
+}
+
+func TestRunShouldWaitForNextTickAfterFailedBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	batch := func() (int, error) {
+		calls++
+		if calls == 1 {
+			return 10, errors.New("database unavailable")
+		}
+		cancel()
+		return 0, nil
+	}
+
+	start := time.Now()
+	assert.NoError(t, Run(ctx, "test", 20*time.Millisecond, 10, batch))
+	assert.Equal(t, 2, calls)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+}
+
+func TestDefaultsShouldApplyWhenNotConfigured(t *testing.T) {
+	assert.Equal(t, time.Minute, Interval(0, time.Minute))
+	assert.Equal(t, time.Second, Interval(time.Second, time.Minute))
+	assert.Equal(t, 100, BatchSize(-1, 100))
+	assert.Equal(t, 5, BatchSize(5, 100))
+
+	clock := func() time.Time { return time.Date(2017, 1, 18, 9, 0, 0, 0, time.FixedZone("CET", 3600)) }
+	assert.Equal(t, time.Date(2017, 1, 18, 8, 0, 0, 0, time.UTC), Now(clock))
+}
@@ -0,0 +1,57 @@
+package prepare
+
+import (
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/charges"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/go-pg/pg/orm"
+	"time"
+)
+
+// Preparer completes and checks new payments the same way whichever path creates them: the scheme
+// is routed or checked, the processing date checked against the scheme's calendar, absent charges
+// priced from the fee schedule and the Fx block booked. Without Routes a payment keeps its own
+// scheme, and without Calendars its processing date is taken as it is.
+type Preparer struct {
+	Policy    fx.Policy
+	Schedule  *charges.Schedule
+	Routes    *routing.Table
+	Calendars *calendar.Calendars
+}
+
+// Prepared is what preparing a payment decided, create responses explain it in meta
+type Prepared struct {
+	Routing        *routing.Decision
+	ProcessingDate *calendar.Adjustment
+}
+
+// Prepare runs in the transaction that inserts the payment since booking a quote uses it up. A
+// payment that cannot be accepted is reported as an *attribute.Error, other errors come from the
+// database.
+func (p Preparer) Prepare(tx orm.DB, payment *model.Payment, now time.Time) (Prepared, error) {
+	var result Prepared
+	var err error
+	// the scheme is chosen first since calendars and fee rules are per scheme
+	if p.Routes != nil {
+		if result.Routing, err = p.Routes.Apply(&payment.Attributes); err != nil {
+			return result, err
+		}
+	}
+	if p.Calendars != nil {
+		if result.ProcessingDate, err = p.Calendars.Apply(&payment.Attributes, now); err != nil {
+			return result, err
+		}
+	}
+	if charges.Absent(payment.Attributes.ChargesInformation) {
+		calculated, rule, err := p.Schedule.Calculate(payment.Attributes)
+		if err != nil {
+			return result, err
+		}
+		if rule != nil {
+			payment.Attributes.ChargesInformation = calculated
+		}
+	}
+	return result, p.Policy.Book(tx, payment, now)
+}
@@ -0,0 +1,55 @@
+package prepare
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPrepareShouldRouteAndDatePayment(t *testing.T) {
+	calendars, err := calendar.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	preparer := Preparer{Routes: routing.DefaultTable(), Calendars: calendars}
+	now := time.Date(2027, 1, 1, 9, 0, 0, 0, time.UTC)
+	payment := model.Payment{Attributes: model.Attributes{Currency: "GBP", Amount: "2000000.00", ProcessingDate: "2027-01-02",
+		DebtorParty: model.DebtorParty{BankIDCode: "GBDSC"}, BeneficiaryParty: model.BeneficiaryParty{BankIDCode: "GBDSC"}}}
+
+	// without an Fx block nothing is booked, so no database is needed
+	prepared, err := preparer.Prepare(nil, &payment, now)
+
+	assert.NoError(t, err)
+	// above the FPS limit the payment goes by Bacs, which is closed at weekends
+	assert.Equal(t, "Bacs", payment.Attributes.PaymentScheme)
+	assert.Equal(t, "2027-01-04", payment.Attributes.ProcessingDate)
+	if assert.NotNil(t, prepared.Routing) && assert.NotNil(t, prepared.ProcessingDate) {
+		assert.Equal(t, "Bacs", prepared.Routing.Scheme)
+		assert.Equal(t, "2027-01-02", prepared.ProcessingDate.Requested)
+	}
+}
+
+func TestPrepareShouldKeepProcessingDateWithoutCalendars(t *testing.T) {
+	payment := model.Payment{Attributes: model.Attributes{PaymentScheme: "FPS", Amount: "100.00", ProcessingDate: "2027-01-02"}}
+
+	prepared, err := Preparer{}.Prepare(nil, &payment, time.Now())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2027-01-02", payment.Attributes.ProcessingDate)
+	assert.Nil(t, prepared.ProcessingDate)
+}
+
+func TestPrepareShouldRefuseUnroutablePayment(t *testing.T) {
+	preparer := Preparer{Routes: &routing.Table{Schemes: []routing.Scheme{{Name: "FPS", Currencies: []string{"GBP"}, Speed: routing.Instant}}}}
+	payment := model.Payment{Attributes: model.Attributes{Currency: "EUR", Amount: "100.00"}}
+
+	_, err := preparer.Prepare(nil, &payment, time.Now())
+
+	if attrErr, ok := err.(*attribute.Error); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, "no_route", attrErr.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package problem
+
+import (
+	"net/http"
+	"sort"
+)
+
+// MediaType of RFC 7807 problem details documents
+const MediaType = "application/problem+json"
+
+// TypeBase prefixes a code to form its problem type URI, which serves the catalogue entry
+const TypeBase = "/v1/problems/"
+
+// Type is one kind of error in the catalogue. Codes are stable once published, clients match on them
+// rather than on the detail message.
+type Type struct {
+	Code        string `json:"code"`
+	Status      int    `json:"status"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// URI identifies the problem type in problem details documents
+func (t Type) URI() string {
+	return TypeBase + t.Code
+}
+
+var catalogue = map[string]Type{}
+
+func register(code string, status int, title, description string) {
+	catalogue[code] = Type{Code: code, Status: status, Title: title, Description: description}
+}
+
+func init() {
+	register("body_too_large", http.StatusRequestEntityTooLarge, "Body too large",
+		"The request body is larger than the endpoint allows.")
+	register("calendar_not_found", http.StatusNotFound, "Calendar not found",
+		"There are no business days for the scheme, it is not one payments are routed to or loaded hours for.")
+	register("duplicate_member", http.StatusBadRequest, "Duplicate member",
+		"An object in the request document has the same member more than once, pointer and offset locate the repeat.")
+	register("fx_amount_mismatch", http.StatusUnprocessableEntity, "FX amount mismatch",
+		"The fx original_amount is not the amount converted at the fx exchange_rate, to within one minor unit.")
+	register("fx_quote_booked", http.StatusUnprocessableEntity, "FX quote booked",
+		"The payment was booked against a quote so its amount, currency and fx cannot change, and a quote can only be booked by creating a payment.")
+	register("fx_quote_expired", http.StatusUnprocessableEntity, "FX quote expired",
+		"The quote named by fx contract_reference has expired, request a new one.")
+	register("fx_quote_mismatch", http.StatusUnprocessableEntity, "FX quote mismatch",
+		"The payment amount, currency or fx members are not the ones quoted for the contract reference.")
+	register("fx_quote_not_found", http.StatusUnprocessableEntity, "FX quote not found",
+		"No quote has the fx contract_reference, contract references come from POST /v1/fx/quotes.")
+	register("fx_quote_used", http.StatusConflict, "FX quote used",
+		"Another payment was already booked against the quote.")
+	register("fx_rate_mismatch", http.StatusUnprocessableEntity, "FX rate mismatch",
+		"The fx exchange_rate is further from the stored rate for the currency pair than the tolerance allows.")
+	register("fx_rate_not_found", http.StatusUnprocessableEntity, "FX rate not found",
+		"No rate for the currency pair is in effect to quote or complete the fx block with.")
+	register("id_mismatch", http.StatusConflict, "ID does not match",
+		"The ID in the request document is not the ID in the URL.")
+	register("idempotency_key_reused", http.StatusUnprocessableEntity, "Idempotency key reused",
+		"The Idempotency-Key was already used for a request with a different body.")
+	register("internal_error", http.StatusInternalServerError, "Internal error",
+		"The server failed to complete the request, it is logged with the request ID.")
+	register("invalid_attributes", http.StatusBadRequest, "Invalid attributes",
+		"The resource attributes could not be decoded.")
+	register("invalid_charges", http.StatusUnprocessableEntity, "Invalid charges",
+		"The fee schedule cannot price the payment because its bearer_code or amount is not valid.")
+	register("invalid_date", http.StatusBadRequest, "Invalid date",
+		"A date parameter is not in YYYY-MM-DD format.")
+	register("invalid_document", http.StatusBadRequest, "Invalid document",
+		"The request body could not be read or does not have the required structure.")
+	register("invalid_filter", http.StatusBadRequest, "Invalid filter",
+		"A filter parameter names a member the collection cannot be filtered by.")
+	register("invalid_fx", http.StatusUnprocessableEntity, "Invalid FX",
+		"The fx block is missing a member it needs or has a member that is not a decimal.")
+	register("invalid_id", http.StatusBadRequest, "Invalid ID",
+		"A payment or organisation ID is not a UUID.")
+	register("invalid_idempotency_key", http.StatusBadRequest, "Invalid idempotency key",
+		"The Idempotency-Key header is longer than 255 characters.")
+	register("invalid_json", http.StatusBadRequest, "Invalid JSON",
+		"The request body is not a single JSON value, offset is where parsing failed.")
+	register("invalid_mandate", http.StatusUnprocessableEntity, "Invalid mandate",
+		"A mandate is missing its reference, debtor account, creditor name or signed date, or a change to it is not allowed.")
+	register("invalid_mapping", http.StatusBadRequest, "Invalid CSV mapping",
+		"The mapping parameter is not a list of header:column pairs.")
+	register("invalid_member_type", http.StatusBadRequest, "Invalid member type",
+		"A member of the request document has the wrong JSON type, such as a number where a string is expected.")
+	register("invalid_page", http.StatusBadRequest, "Invalid page",
+		"A page parameter is not a positive integer or the page size is too large.")
+	register("invalid_processing_date", http.StatusUnprocessableEntity, "Invalid processing date",
+		"The processing_date is not a date, or the rule is to reject dates the scheme is closed on or today's after its cut-off.")
+	register("invalid_rate", http.StatusBadRequest, "Invalid rate",
+		"An FX rate does not have ISO 4217 currencies, a positive rate and an effective time.")
+	register("invalid_relationship", http.StatusBadRequest, "Invalid relationship",
+		"A relationship does not reference a resource of the expected type.")
+	register("invalid_routing", http.StatusUnprocessableEntity, "Invalid routing",
+		"A payment without a payment_scheme cannot be routed because its requested_speed or amount is not valid.")
+	register("invalid_standing_order", http.StatusUnprocessableEntity, "Invalid standing order",
+		"The recurrence rule or template of a standing order is not valid, or it has no occurrences left.")
+	register("invalid_submission", http.StatusUnprocessableEntity, "Invalid submission",
+		"The payments cannot be written to a scheme submission file.")
+	register("invalid_time", http.StatusBadRequest, "Invalid time",
+		"A time parameter is not an RFC 3339 time.")
+	register("invalid_type", http.StatusConflict, "Invalid resource type",
+		"The resource type in the request document is not the type of the endpoint.")
+	register("mandate_closed", http.StatusConflict, "Mandate closed",
+		"The mandate is cancelled and cannot be changed.")
+	register("mandate_exists", http.StatusConflict, "Mandate exists",
+		"A mandate with the ID, or with the reference in the organisation, already exists.")
+	register("mandate_inactive", http.StatusUnprocessableEntity, "Mandate inactive",
+		"The mandate a Debit payment references is cancelled.")
+	register("mandate_mismatch", http.StatusUnprocessableEntity, "Mandate mismatch",
+		"The mandate a Debit payment references does not authorise debits from its debtor account.")
+	register("mandate_not_found", http.StatusNotFound, "Mandate not found",
+		"No mandate has the ID.")
+	register("mandate_required", http.StatusUnprocessableEntity, "Mandate required",
+		"A Debit payment must have the mandate_reference of the mandate that authorises it.")
+	register("no_route", http.StatusUnprocessableEntity, "No route",
+		"No scheme can carry a payment created without a payment_scheme, meta.rejected says why each scheme refused it.")
+	register("not_acceptable", http.StatusNotAcceptable, "Not acceptable",
+		"The Accept header does not allow any media type the endpoint produces.")
+	register("payment_exists", http.StatusConflict, "Payment exists",
+		"A payment with the ID already exists.")
+	register("payment_not_found", http.StatusNotFound, "Payment not found",
+		"No payment has the ID.")
+	register("problem_not_found", http.StatusNotFound, "Problem type not found",
+		"The catalogue has no problem type with the code.")
+	register("rate_limited", http.StatusTooManyRequests, "Rate limited",
+		"The client has made too many requests, retry after the number of seconds in Retry-After.")
+	register("schedule_closed", http.StatusConflict, "Schedule closed",
+		"The payment's schedule is submitted, failed or cancelled, so its processing_date cannot change.")
+	register("standing_order_closed", http.StatusConflict, "Standing order closed",
+		"The standing order is cancelled or completed and cannot be changed.")
+	register("standing_order_exists", http.StatusConflict, "Standing order exists",
+		"A standing order with the ID already exists.")
+	register("standing_order_not_found", http.StatusNotFound, "Standing order not found",
+		"No standing order has the ID.")
+	register("unknown_mandate", http.StatusUnprocessableEntity, "Unknown mandate",
+		"The organisation has no mandate with the mandate_reference of the Debit payment.")
+	register("unknown_member", http.StatusBadRequest, "Unknown member",
+		"The request document has a member the resource does not define.")
+	register("unsupported_media_type", http.StatusUnsupportedMediaType, "Unsupported media type",
+		"The Content-Type of the request is not one the endpoint accepts.")
+	register("version_conflict", http.StatusConflict, "Version conflict",
+		"The meta version in the request is not the payment's current version, fetch it again and reapply the change.")
+}
+
+// Lookup returns the catalogue entry for the code
+func Lookup(code string) (Type, bool) {
+	t, ok := catalogue[code]
+	return t, ok
+}
+
+// Catalogue returns every problem type ordered by code
+func Catalogue() []Type {
+	types := make([]Type, 0, len(catalogue))
+	for _, t := range catalogue {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Code < types[j].Code })
+	return types
+}
+
+// Details is a problem details object as described in https://tools.ietf.org/html/rfc7807, extended
+// with the stable code, the request ID and the member or parameter at fault
+type Details struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Offset    *int64 `json:"offset,omitempty"`
+}
+
+// New describes an occurrence of the problem with the code at the instance, the request URI. Codes
+// missing from the catalogue are reported as about:blank with the status text as title.
+func New(status int, code, detail, instance string) Details {
+	details := Details{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+	}
+	if t, ok := Lookup(code); ok {
+		details.Type = t.URI()
+		details.Title = t.Title
+	}
+	return details
+}
@@ -0,0 +1,39 @@
+package problem
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func TestNewShouldDescribeCatalogueCode(t *testing.T) {
+	details := New(http.StatusNotFound, "payment_not_found", "Payment not found", "/v1/payments/42")
+
+	assert.Equal(t, Details{
+		Type:     "/v1/problems/payment_not_found",
+		Title:    "Payment not found",
+		Status:   http.StatusNotFound,
+		Detail:   "Payment not found",
+		Instance: "/v1/payments/42",
+		Code:     "payment_not_found",
+	}, details)
+}
+
+func TestNewShouldUseAboutBlankForUnknownCode(t *testing.T) {
+	details := New(http.StatusBadRequest, "unknown", "", "/v1/payments")
+
+	assert.Equal(t, "about:blank", details.Type)
+	assert.Equal(t, "Bad Request", details.Title)
+}
+
+func TestCatalogueShouldBeOrderedAndComplete(t *testing.T) {
+	types := Catalogue()
+
+	assert.True(t, sort.SliceIsSorted(types, func(i, j int) bool { return types[i].Code < types[j].Code }))
+	for _, pt := range types {
+		assert.NotEmpty(t, http.StatusText(pt.Status), pt.Code)
+		assert.NotEmpty(t, pt.Title, pt.Code)
+		assert.NotEmpty(t, pt.Description, pt.Code)
+	}
+}
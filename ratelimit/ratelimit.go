@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period, all of which may be made at once
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) IsZero() bool { return l.Requests <= 0 || l.Period <= 0 }
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// interval is the time for one token to drip back into the bucket
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+var periodUnits = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// ParseLimit reads a limit such as 100/m, 10/s, 5000/h or 20/30s
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("rate limit %q must be requests/period such as 100/m", s)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q must allow a positive number of requests", s)
+	}
+	period, ok := periodUnits[parts[1]]
+	if !ok {
+		if period, err = time.ParseDuration(parts[1]); err != nil || period <= 0 {
+			return Limit{}, fmt.Errorf("rate limit %q has an invalid period, use s, m, h or a duration", s)
+		}
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// ParseRoutes reads route limits such as "GET /v1/payments=60/m,POST /v1/payments/csv=5/m" keyed by
+// method and route template
+func ParseRoutes(s string) (map[string]Limit, error) {
+	routes := map[string]Limit{}
+	for _, rule := range strings.Split(s, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		i := strings.LastIndex(rule, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("route rate limit %q must be \"METHOD /route=limit\"", rule)
+		}
+		fields := strings.Fields(rule[:i])
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("route rate limit %q must be \"METHOD /route=limit\"", rule)
+		}
+		limit, err := ParseLimit(rule[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		routes[strings.ToUpper(fields[0])+" "+fields[1]] = limit
+	}
+	return routes, nil
+}
+
+// Result is the state of a bucket after taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long a denied client has to wait for the next token
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets. Each bucket is kept as the time it will next be full, the generic cell
+// rate algorithm, which behaves like a token bucket but needs a single value per client.
+type Store interface {
+	// Take removes a token from the bucket for key if one is available
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// take applies a request arriving at now to a bucket full at tat, returning the bucket's new full time
+func take(tat, now time.Time, limit Limit) (time.Time, Result) {
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if next.Sub(now) > limit.Period {
+		denied := result(tat, now, limit)
+		denied.RetryAfter = next.Sub(now) - limit.Period
+		return tat, denied
+	}
+	allowed := result(next, now, limit)
+	allowed.Allowed = true
+	return next, allowed
+}
+
+func result(tat, now time.Time, limit Limit) Result {
+	reset := tat.Sub(now)
+	if reset < 0 {
+		reset = 0
+	}
+	return Result{
+		Limit:     limit.Requests,
+		Remaining: int((limit.Period - reset) / limit.interval()),
+		Reset:     reset,
+	}
+}
+
+// Limiter applies a limit per client to each route with its own limit, and a shared default limit
+// to every other API route. A limit per address can apply to every API request on top of them.
+type Limiter struct {
+	store  Store
+	limit  Limit
+	routes map[string]Limit
+	perIP  Limit
+	keys   map[string]bool
+	now    func() time.Time
+}
+
+type Option func(*Limiter)
+
+// WithAPIKeys trusts the API keys to identify clients, requests with any other key are limited by
+// their address
+func WithAPIKeys(keys []string) Option {
+	return func(l *Limiter) {
+		for _, key := range keys {
+			l.keys[hashKey(key)] = true
+		}
+	}
+}
+
+// WithIPLimit limits every API request from an address to limit, whichever client makes it
+func WithIPLimit(limit Limit) Option {
+	return func(l *Limiter) {
+		l.perIP = limit
+	}
+}
+
+// New limits API routes to limit per client, routes keyed by method and template override it. A zero
+// default leaves routes without their own limit unlimited.
+func New(store Store, limit Limit, routes map[string]Limit, options ...Option) *Limiter {
+	l := &Limiter{store: store, limit: limit, routes: routes, keys: map[string]bool{}, now: time.Now}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+// Take spends a token of the address's bucket and of the client's bucket for the route. The result
+// is the bucket closer to empty, ok is false when the route is unlimited.
+func (l *Limiter) Take(ctx context.Context, r *http.Request, route string) (result Result, ok bool, err error) {
+	now := l.now()
+	if !l.perIP.IsZero() && strings.HasPrefix(route, "/v1/") {
+		result, err = l.store.Take(ctx, "ip:"+remoteHost(r), l.perIP, now)
+		if err != nil || !result.Allowed {
+			return result, true, err
+		}
+		ok = true
+	}
+
+	rule := r.Method + " " + route
+	limit, found := l.routes[rule]
+	if !found {
+		if l.limit.IsZero() || !strings.HasPrefix(route, "/v1/") {
+			return result, ok, nil
+		}
+		rule, limit = "default", l.limit
+	}
+	client, err := l.store.Take(ctx, l.ClientKey(r)+" "+rule, limit, now)
+	if err != nil || !ok || !client.Allowed || client.Remaining <= result.Remaining {
+		return client, true, err
+	}
+	return result, true, nil
+}
+
+// APIKeyHeader identifies a client more precisely than its address
+const APIKeyHeader = "X-API-Key"
+
+// ClientKey identifies who is making the request: its API key when the limiter trusts it, otherwise
+// its remote address. Keys are sent unauthenticated, so an untrusted one would let a client start a
+// full bucket on every request. API keys are hashed so they are not kept in the store.
+func (l *Limiter) ClientKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" && l.keys[hashKey(key)] {
+		return "key:" + hashKey(key)
+	}
+	return "ip:" + remoteHost(r)
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	for value, expected := range map[string]Limit{
+		"100/m":  {Requests: 100, Period: time.Minute},
+		"10/s":   {Requests: 10, Period: time.Second},
+		"5000/h": {Requests: 5000, Period: time.Hour},
+		"20/30s": {Requests: 20, Period: 30 * time.Second},
+	} {
+		limit, err := ParseLimit(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, limit, value)
+	}
+
+	for _, value := range []string{"", "100", "0/m", "-1/m", "ten/m", "10/d", "10/-1s"} {
+		_, err := ParseLimit(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("get /v1/payments=60/m, POST /v1/payments/csv=5/m")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Limit{
+		"GET /v1/payments":      {Requests: 60, Period: time.Minute},
+		"POST /v1/payments/csv": {Requests: 5, Period: time.Minute},
+	}, routes)
+
+	_, err = ParseRoutes("/v1/payments=60/m")
+	assert.EqualError(t, err, `route rate limit "/v1/payments=60/m" must be "METHOD /route=limit"`)
+}
+
+func TestMemoryStoreShouldRefillOneTokenPerInterval(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := store.Take(context.Background(), "client", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result, _ := store.Take(context.Background(), "client", limit, now)
+	assert.Equal(t, Result{Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}, result)
+
+	result, _ = store.Take(context.Background(), "client", limit, now.Add(time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// a full bucket does not bank more than its limit
+	result, _ = store.Take(context.Background(), "client", limit, now.Add(time.Hour))
+	assert.Equal(t, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}, result)
+}
+
+func TestLimiterShouldPreferRouteLimitAndSkipUnlimitedRoutes(t *testing.T) {
+	limiter := New(NewMemoryStore(), Limit{Requests: 10, Period: time.Minute},
+		map[string]Limit{"GET /v1/payments": {Requests: 1, Period: time.Minute}})
+	request := httptest.NewRequest("GET", "/v1/payments", nil)
+
+	result, ok, err := limiter.Take(context.Background(), request, "/v1/payments")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, result.Limit)
+
+	result, ok, _ = limiter.Take(context.Background(), request, "/v1/payments/{id}")
+	assert.True(t, ok)
+	assert.Equal(t, 10, result.Limit)
+
+	_, ok, _ = limiter.Take(context.Background(), request, "/metrics")
+	assert.False(t, ok)
+}
+
+func TestLimiterShouldLimitAddressWhateverKeyIsSent(t *testing.T) {
+	limiter := New(NewMemoryStore(), Limit{Requests: 10, Period: time.Minute}, nil,
+		WithIPLimit(Limit{Requests: 2, Period: time.Minute}))
+
+	take := func(key string) Result {
+		request := httptest.NewRequest("GET", "/v1/payments", nil)
+		request.Header.Set(APIKeyHeader, key)
+		result, _, _ := limiter.Take(context.Background(), request, "/v1/payments")
+		return result
+	}
+
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second}, take("first"))
+	assert.True(t, take("second").Allowed)
+	assert.False(t, take("third").Allowed)
+}
+
+func TestClientKeyShouldOnlyTrustConfiguredAPIKeys(t *testing.T) {
+	limiter := New(NewMemoryStore(), Limit{}, nil, WithAPIKeys([]string{"secret"}))
+
+	request := httptest.NewRequest("GET", "/v1/payments?filter[organisation_id]=743d5b63", nil)
+	request.RemoteAddr = "10.0.0.1:52000"
+	assert.Equal(t, "ip:10.0.0.1", limiter.ClientKey(request))
+
+	request.Header.Set(APIKeyHeader, "secret")
+	assert.Equal(t, "key:2bb80d537b1da3e38bd30361aa855686", limiter.ClientKey(request))
+
+	request.Header.Set(APIKeyHeader, "guessed")
+	assert.Equal(t, "ip:10.0.0.1", limiter.ClientKey(request))
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the stores forget buckets that have filled up again
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in the process, limits apply to each replica separately
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]time.Time{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) > sweepInterval {
+		for k, tat := range s.buckets {
+			if !tat.After(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	tat, result := take(s.buckets[key], now, limit)
+	s.buckets[key] = tat
+	return result, nil
+}
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so limits hold across replicas. Each
+// request is a single statement that only advances the bucket while it has a token to spend. Full
+// buckets are deleted every sweepInterval, a full bucket and a missing one behave the same.
+type PostgresStore struct {
+	db    *pg.DB
+	mu    sync.Mutex
+	swept time.Time
+}
+
+func NewPostgresStore(db *pg.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+const takeQuery = `
+INSERT INTO rate_limit_buckets AS b (key, tat) VALUES (?0, ?1::timestamptz + ?2 * interval '1 microsecond')
+ON CONFLICT (key) DO UPDATE SET tat = GREATEST(b.tat, ?1) + ?2 * interval '1 microsecond'
+WHERE GREATEST(b.tat, ?1) + ?2 * interval '1 microsecond' <= ?1::timestamptz + ?3 * interval '1 microsecond'
+RETURNING tat`
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	db := s.db.WithContext(ctx)
+	s.sweep(ctx, db, now)
+	interval := int64(limit.interval() / time.Microsecond)
+	period := int64(limit.Period / time.Microsecond)
+
+	bucket := model.RateLimitBucket{Key: key}
+	_, err := db.QueryOne(&bucket, takeQuery, key, now, interval, period)
+	if err == nil {
+		allowed := result(bucket.TAT, now, limit)
+		allowed.Allowed = true
+		return allowed, nil
+	}
+	if err != pg.ErrNoRows {
+		return Result{}, err
+	}
+
+	// the bucket was empty so nothing changed, read it to tell the client how long to wait
+	if err := db.Select(&bucket); err != nil {
+		return Result{}, err
+	}
+	_, denied := take(bucket.TAT, now, limit)
+	return denied, nil
+}
+
+// sweep deletes the buckets that are full again, failing to only leaves them for the next sweep
+func (s *PostgresStore) sweep(ctx context.Context, db *pg.DB, now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.swept) > sweepInterval
+	if due {
+		s.swept = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	if _, err := db.Model((*model.RateLimitBucket)(nil)).Where("tat <= ?", now).Delete(); err != nil {
+		logging.FromContext(ctx).Warn("could not sweep rate limit buckets", "error", err)
+	}
+}
@@ -0,0 +1,234 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/fx"
+	"github.com/clD11/form3-payments/model"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Speeds a payment can ask for, from fastest to slowest. A scheme can carry payments that ask for
+// its speed or a slower one.
+const (
+	Instant  = "instant"
+	SameDay  = "same_day"
+	Standard = "standard"
+)
+
+var speeds = map[string]int{Instant: 0, SameDay: 1, Standard: 2}
+
+// Scheme says which payments a scheme can carry. Empty Currencies or BankIDCodes accept any, and
+// both the debtor and beneficiary bank must be identified with one of BankIDCodes. MaxAmount is in
+// the payment currency and empty means unlimited.
+type Scheme struct {
+	Name                 string   `json:"payment_scheme"`
+	Currencies           []string `json:"currencies"`
+	MaxAmount            string   `json:"max_amount"`
+	Speed                string   `json:"speed"`
+	BankIDCodes          []string `json:"bank_id_codes"`
+	SchemePaymentType    string   `json:"scheme_payment_type"`
+	SchemePaymentSubType string   `json:"scheme_payment_sub_type"`
+}
+
+// Table lists schemes in order of preference, a payment is routed to the first that can carry it
+type Table struct {
+	Schemes []Scheme
+}
+
+// DefaultTable prefers the cheapest scheme: Faster Payments up to its limit, Bacs for sterling
+// that can wait, CHAPS for high value sterling on the day, SEPA credit transfers for euros and
+// SWIFT for everything else
+func DefaultTable() *Table {
+	uk := []string{"GBDSC"}
+	return &Table{Schemes: []Scheme{
+		{Name: "FPS", Currencies: []string{"GBP"}, MaxAmount: "1000000.00", Speed: Instant, BankIDCodes: uk,
+			SchemePaymentType: "ImmediatePayment"},
+		{Name: "Bacs", Currencies: []string{"GBP"}, MaxAmount: "20000000.00", Speed: Standard, BankIDCodes: uk},
+		{Name: "CHAPS", Currencies: []string{"GBP"}, Speed: SameDay, BankIDCodes: uk, SchemePaymentType: "HighValue"},
+		{Name: "SEPACT", Currencies: []string{"EUR"}, MaxAmount: "999999999.99", Speed: Standard,
+			SchemePaymentType: "CreditTransfer"},
+		{Name: "SWIFT", Speed: Standard},
+	}}
+}
+
+// LoadTable reads a table file
+func LoadTable(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseTable(file)
+}
+
+// ParseTable reads a JSON array of schemes in order of preference
+func ParseTable(r io.Reader) (*Table, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var schemes []Scheme
+	if err := decoder.Decode(&schemes); err != nil {
+		return nil, fmt.Errorf("routing table: %s", err)
+	}
+	if len(schemes) == 0 {
+		return nil, fmt.Errorf("routing table: no schemes")
+	}
+	for i, scheme := range schemes {
+		if err := scheme.validate(); err != nil {
+			return nil, fmt.Errorf("routing table scheme %d: %s", i+1, err)
+		}
+	}
+	return &Table{Schemes: schemes}, nil
+}
+
+func (s Scheme) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("payment_scheme is required")
+	}
+	if _, ok := speeds[s.Speed]; !ok {
+		return fmt.Errorf("speed %q must be %s, %s or %s", s.Speed, Instant, SameDay, Standard)
+	}
+	if s.MaxAmount != "" && fx.Decimal(s.MaxAmount) == nil {
+		return fmt.Errorf("max_amount %q is not a decimal", s.MaxAmount)
+	}
+	return nil
+}
+
+// Rejection is why a scheme before the chosen one could not carry the payment
+type Rejection struct {
+	Scheme string `json:"payment_scheme"`
+	Reason string `json:"reason"`
+}
+
+// Decision is the scheme a payment was routed to and why the schemes preferred to it were passed over
+type Decision struct {
+	Scheme               string      `json:"payment_scheme"`
+	SchemePaymentType    string      `json:"scheme_payment_type,omitempty"`
+	SchemePaymentSubType string      `json:"scheme_payment_sub_type,omitempty"`
+	Speed                string      `json:"speed"`
+	Rejected             []Rejection `json:"rejected,omitempty"`
+}
+
+// Route chooses the first scheme that can carry the payment at the speed it asks for, which is
+// Standard when it does not ask
+func (t *Table) Route(a model.Attributes) (Decision, error) {
+	speed, amount, err := parse(a)
+	decision := Decision{Speed: speed}
+	if err != nil {
+		return decision, err
+	}
+
+	for _, scheme := range t.Schemes {
+		if reason := scheme.refuse(a, amount, decision.Speed); reason != "" {
+			decision.Rejected = append(decision.Rejected, Rejection{Scheme: scheme.Name, Reason: reason})
+			continue
+		}
+		decision.Scheme = scheme.Name
+		decision.SchemePaymentType = scheme.SchemePaymentType
+		decision.SchemePaymentSubType = scheme.SchemePaymentSubType
+		return decision, nil
+	}
+	reasons := make([]string, len(decision.Rejected))
+	for i, rejection := range decision.Rejected {
+		reasons[i] = rejection.Scheme + ": " + rejection.Reason
+	}
+	return decision, refused(decision.Rejected, "No scheme can carry the payment, "+strings.Join(reasons, "; "))
+}
+
+// Check returns an error saying why the payment's own scheme cannot carry it. Schemes the table has
+// no entry for are not checked.
+func (t *Table) Check(a model.Attributes) error {
+	for _, scheme := range t.Schemes {
+		if scheme.Name != a.PaymentScheme {
+			continue
+		}
+		speed, amount, err := parse(a)
+		if err != nil {
+			return err
+		}
+		if reason := scheme.refuse(a, amount, speed); reason != "" {
+			return refused([]Rejection{{Scheme: scheme.Name, Reason: reason}},
+				fmt.Sprintf("%s cannot carry the payment, %s", scheme.Name, reason))
+		}
+		return nil
+	}
+	return nil
+}
+
+// refused is a payment the schemes that could carry it refused, the error's meta says why each did
+func refused(rejected []Rejection, message string) error {
+	return &attribute.Error{Code: "no_route", Member: "payment_scheme", Message: message,
+		Meta: map[string]interface{}{"rejected": rejected}}
+}
+
+// parse returns the speed the payment asks for, Standard when it does not ask, and its amount
+func parse(a model.Attributes) (string, *big.Rat, error) {
+	speed := a.RequestedSpeed
+	if speed == "" {
+		speed = Standard
+	}
+	if _, ok := speeds[speed]; !ok {
+		return speed, nil, &attribute.Error{Code: "invalid_routing", Member: "requested_speed",
+			Message: fmt.Sprintf("requested_speed %q must be %s, %s or %s", speed, Instant, SameDay, Standard)}
+	}
+	amount := fx.Decimal(a.Amount)
+	if amount == nil {
+		return speed, nil, &attribute.Error{Code: "invalid_routing", Member: "amount", Message: fmt.Sprintf("amount %q is not a decimal", a.Amount)}
+	}
+	return speed, amount, nil
+}
+
+// refuse returns why the scheme cannot carry the payment, or "" when it can
+func (s Scheme) refuse(a model.Attributes, amount *big.Rat, speed string) string {
+	if len(s.Currencies) > 0 && !contains(s.Currencies, a.Currency) {
+		return fmt.Sprintf("currency %s is not one of %s", a.Currency, strings.Join(s.Currencies, ", "))
+	}
+	if s.MaxAmount != "" && amount.Cmp(fx.Decimal(s.MaxAmount)) > 0 {
+		return fmt.Sprintf("amount %s is above the limit of %s", a.Amount, s.MaxAmount)
+	}
+	if speeds[s.Speed] > speeds[speed] {
+		return fmt.Sprintf("settles %s, slower than %s", s.Speed, speed)
+	}
+	if len(s.BankIDCodes) > 0 {
+		if !contains(s.BankIDCodes, a.DebtorParty.BankIDCode) {
+			return fmt.Sprintf("debtor bank_id_code %q is not one of %s", a.DebtorParty.BankIDCode, strings.Join(s.BankIDCodes, ", "))
+		}
+		if !contains(s.BankIDCodes, a.BeneficiaryParty.BankIDCode) {
+			return fmt.Sprintf("beneficiary bank_id_code %q is not one of %s", a.BeneficiaryParty.BankIDCode, strings.Join(s.BankIDCodes, ", "))
+		}
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply routes a payment without a scheme and fills in the scheme payment type and sub type it left
+// empty. The decision is nil when the payment named its own scheme, which is checked instead.
+func (t *Table) Apply(a *model.Attributes) (*Decision, error) {
+	if a.PaymentScheme != "" {
+		return nil, t.Check(*a)
+	}
+	decision, err := t.Route(*a)
+	if err != nil {
+		return nil, err
+	}
+	a.PaymentScheme = decision.Scheme
+	if a.SchemePaymentType == "" {
+		a.SchemePaymentType = decision.SchemePaymentType
+	}
+	if a.SchemePaymentSubType == "" {
+		a.SchemePaymentSubType = decision.SchemePaymentSubType
+	}
+	return &decision, nil
+}
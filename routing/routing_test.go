@@ -0,0 +1,140 @@
+package routing
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func payment(currency, amount, speed, debtorCode, beneficiaryCode string) model.Attributes {
+	return model.Attributes{
+		Currency:         currency,
+		Amount:           amount,
+		RequestedSpeed:   speed,
+		DebtorParty:      model.DebtorParty{BankIDCode: debtorCode},
+		BeneficiaryParty: model.BeneficiaryParty{BankIDCode: beneficiaryCode},
+	}
+}
+
+func TestRouteShouldChooseFirstSchemeThatCanCarryPayment(t *testing.T) {
+	table := DefaultTable()
+
+	for _, c := range []struct {
+		attributes model.Attributes
+		scheme     string
+		rejected   []string
+	}{
+		{payment("GBP", "100.21", "", "GBDSC", "GBDSC"), "FPS", nil},
+		{payment("GBP", "1000000.00", Instant, "GBDSC", "GBDSC"), "FPS", nil},
+		{payment("GBP", "1000000.01", "", "GBDSC", "GBDSC"), "Bacs", []string{"FPS"}},
+		{payment("GBP", "1000000.01", SameDay, "GBDSC", "GBDSC"), "CHAPS", []string{"FPS", "Bacs"}},
+		{payment("GBP", "30000000.00", "", "GBDSC", "GBDSC"), "CHAPS", []string{"FPS", "Bacs"}},
+		{payment("EUR", "500.00", "", "SWBIC", "SWBIC"), "SEPACT", []string{"FPS", "Bacs", "CHAPS"}},
+		{payment("GBP", "100.00", "", "GBDSC", "SWBIC"), "SWIFT", []string{"FPS", "Bacs", "CHAPS", "SEPACT"}},
+		{payment("USD", "100.00", "", "SWBIC", "SWBIC"), "SWIFT", []string{"FPS", "Bacs", "CHAPS", "SEPACT"}},
+	} {
+		decision, err := table.Route(c.attributes)
+
+		assert.NoError(t, err)
+		assert.Equal(t, c.scheme, decision.Scheme, "%+v", c.attributes)
+		var rejected []string
+		for _, rejection := range decision.Rejected {
+			rejected = append(rejected, rejection.Scheme)
+		}
+		assert.Equal(t, c.rejected, rejected, "%+v", c.attributes)
+	}
+}
+
+func TestRouteShouldExplainRejections(t *testing.T) {
+	decision, err := DefaultTable().Route(payment("GBP", "2000000.00", SameDay, "GBDSC", "GBDSC"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Decision{Scheme: "CHAPS", SchemePaymentType: "HighValue", Speed: SameDay, Rejected: []Rejection{
+		{Scheme: "FPS", Reason: "amount 2000000.00 is above the limit of 1000000.00"},
+		{Scheme: "Bacs", Reason: "settles standard, slower than same_day"},
+	}}, decision)
+
+	decision, _ = DefaultTable().Route(payment("GBP", "10.00", "", "GBDSC", "SWBIC"))
+	assert.Equal(t, Rejection{Scheme: "FPS", Reason: `beneficiary bank_id_code "SWBIC" is not one of GBDSC`}, decision.Rejected[0])
+	assert.Equal(t, Rejection{Scheme: "SEPACT", Reason: "currency GBP is not one of EUR"}, decision.Rejected[3])
+}
+
+func TestRouteShouldFailWhenNoSchemeCanCarryPayment(t *testing.T) {
+	_, err := DefaultTable().Route(payment("USD", "10.00", Instant, "SWBIC", "SWBIC"))
+
+	assert.Len(t, err.(*attribute.Error).Meta["rejected"], 5)
+	assert.Equal(t, "no_route", err.(*attribute.Error).Code)
+	assert.Equal(t, "payment_scheme", err.(*attribute.Error).Member)
+	assert.Contains(t, err.Error(), "No scheme can carry the payment, FPS: currency USD is not one of GBP;")
+	assert.Contains(t, err.Error(), "SWIFT: settles standard, slower than instant")
+
+	_, err = DefaultTable().Route(payment("GBP", "10.00", "tomorrow", "GBDSC", "GBDSC"))
+	assert.EqualError(t, err, `requested_speed "tomorrow" must be instant, same_day or standard`)
+	assert.Equal(t, "invalid_routing", err.(*attribute.Error).Code)
+	assert.Nil(t, err.(*attribute.Error).Meta)
+}
+
+func TestApplyShouldOnlyRoutePaymentsWithoutScheme(t *testing.T) {
+	table := DefaultTable()
+
+	a := payment("GBP", "10.00", "", "GBDSC", "GBDSC")
+	a.SchemePaymentSubType = "InternetBanking"
+	decision, err := table.Apply(&a)
+	assert.NoError(t, err)
+	assert.Equal(t, "FPS", decision.Scheme)
+	assert.Equal(t, "FPS", a.PaymentScheme)
+	assert.Equal(t, "ImmediatePayment", a.SchemePaymentType)
+	assert.Equal(t, "InternetBanking", a.SchemePaymentSubType)
+
+	a = payment("USD", "10.00", "", "SWBIC", "SWBIC")
+	a.PaymentScheme = "SWIFT"
+	decision, err = table.Apply(&a)
+	assert.NoError(t, err)
+	assert.Nil(t, decision)
+	assert.Equal(t, "", a.SchemePaymentType)
+}
+
+func TestApplyShouldCheckPaymentsOwnScheme(t *testing.T) {
+	table := DefaultTable()
+
+	a := payment("GBP", "2000000.00", "", "GBDSC", "GBDSC")
+	a.PaymentScheme = "FPS"
+	_, err := table.Apply(&a)
+	assert.Equal(t, &attribute.Error{Code: "no_route", Member: "payment_scheme",
+		Message: "FPS cannot carry the payment, amount 2000000.00 is above the limit of 1000000.00",
+		Meta:    map[string]interface{}{"rejected": []Rejection{{Scheme: "FPS", Reason: "amount 2000000.00 is above the limit of 1000000.00"}}}}, err)
+
+	a.PaymentScheme = "SWIFT"
+	a.RequestedSpeed = Instant
+	_, err = table.Apply(&a)
+	assert.EqualError(t, err, "SWIFT cannot carry the payment, settles standard, slower than instant")
+
+	// the table only describes the schemes it routes to
+	a.PaymentScheme = "BOOK"
+	_, err = table.Apply(&a)
+	assert.NoError(t, err)
+}
+
+func TestParseTable(t *testing.T) {
+	table, err := ParseTable(strings.NewReader(`[
+		{"payment_scheme": "FPS", "currencies": ["GBP"], "max_amount": "250000", "speed": "instant", "bank_id_codes": ["GBDSC"]},
+		{"payment_scheme": "SWIFT", "speed": "standard"}
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Scheme{
+		{Name: "FPS", Currencies: []string{"GBP"}, MaxAmount: "250000", Speed: Instant, BankIDCodes: []string{"GBDSC"}},
+		{Name: "SWIFT", Speed: Standard},
+	}, table.Schemes)
+
+	for document, message := range map[string]string{
+		`[]`: "routing table: no schemes",
+		`[{"payment_scheme": "FPS", "speed": "fast"}]`:                        `routing table scheme 1: speed "fast" must be instant, same_day or standard`,
+		`[{"payment_scheme": "FPS", "speed": "instant", "max_amount": "1m"}]`: `routing table scheme 1: max_amount "1m" is not a decimal`,
+		`[{"speed": "instant"}]`:                                              "routing table scheme 1: payment_scheme is required",
+	} {
+		_, err := ParseTable(strings.NewReader(document))
+		assert.EqualError(t, err, message)
+	}
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/mandate"
+	"github.com/clD11/form3-payments/metrics"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/poll"
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"time"
+)
+
+// Statuses of a schedule
+const (
+	Scheduled = "scheduled"
+	Submitted = "submitted"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+const (
+	DefaultInterval    = 30 * time.Second
+	DefaultBatchSize   = 100
+	DefaultMaxAttempts = 5
+)
+
+// dateLayout is the format of processing dates, which are due from midnight UTC
+const dateLayout = "2006-01-02"
+
+var processed = metrics.NewCounterVec("scheduled_payments_processed_total",
+	"Scheduled payments the scheduler acted on by resulting status", "status")
+
+// Submitter acts on a payment on its processing date, in the transaction that marks it submitted
+type Submitter func(db orm.DB, payment model.Payment) error
+
+// Release is the default submitter. Releasing the payment to its scheme is the transition of its
+// schedule to submitted, schemes with a gateway can do more.
+func Release(db orm.DB, payment model.Payment) error {
+	return nil
+}
+
+// Add schedules a payment for its processing date. The scheduler is the only path to submission, so
+// a payment due today or earlier, or without a date, is scheduled too and submitted on the next run.
+func Add(db orm.DB, payment model.Payment, now time.Time) error {
+	schedule := newSchedule(payment, now)
+	return db.Insert(&schedule)
+}
+
+func newSchedule(payment model.Payment, now time.Time) model.PaymentSchedule {
+	date := payment.Attributes.ProcessingDate
+	if date == "" {
+		date = now.UTC().Format(dateLayout)
+	}
+	return model.PaymentSchedule{
+		PaymentID:      payment.ID,
+		ProcessingDate: date,
+		Status:         Scheduled,
+		NextAttemptAt:  now.UTC(),
+		CreatedAt:      now.UTC(),
+	}
+}
+
+// Reschedule moves the schedule of a payment that has not been submitted to its new processing
+// date, scheduling it if it had none. A payment the scheduler has already submitted, failed or
+// cancelled is not acted on again, so its date cannot change and an *attribute.Error says why.
+func Reschedule(db orm.DB, payment model.Payment, now time.Time) error {
+	schedule := model.PaymentSchedule{PaymentID: payment.ID}
+	err := db.Model(&schedule).WherePK().For("UPDATE").Select()
+	if err == pg.ErrNoRows {
+		return Add(db, payment, now)
+	}
+	if err != nil {
+		return err
+	}
+	if schedule.Status != Scheduled {
+		return &attribute.Error{Code: "schedule_closed", Member: "processing_date",
+			Message: fmt.Sprintf("The payment's schedule is %s so processing_date cannot change", schedule.Status)}
+	}
+	_, err = db.Model(&schedule).Set("processing_date = ?", newSchedule(payment, now).ProcessingDate).WherePK().Update()
+	return err
+}
+
+// Scheduler is a worker that acts on scheduled payments once their processing date arrives. Each
+// batch locks its schedules with SKIP LOCKED, so replicas share the work without acting on a
+// payment twice.
+type Scheduler struct {
+	DB          *pg.DB
+	Submit      Submitter
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	// Now is the clock, time.Now when nil
+	Now func() time.Time
+}
+
+func (s *Scheduler) Name() string { return "scheduler" }
+
+// Run acts on due payments every interval until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) error {
+	return poll.Run(ctx, s.Name(), poll.Interval(s.Interval, DefaultInterval), s.batchSize(), s.RunOnce)
+}
+
+func (s *Scheduler) batchSize() int {
+	return poll.BatchSize(s.BatchSize, DefaultBatchSize)
+}
+
+// RunOnce acts on a batch of due payments and returns how many it took
+func (s *Scheduler) RunOnce() (int, error) {
+	now := poll.Now(s.Now)
+	var schedules []model.PaymentSchedule
+	err := s.DB.RunInTransaction(func(tx *pg.Tx) error {
+		err := tx.Model(&schedules).
+			Where("status = ?", Scheduled).
+			Where("processing_date <= ?", now.Format(dateLayout)).
+			Where("next_attempt_at <= ?", now).
+			Order("processing_date", "payment_id").
+			Limit(s.batchSize()).
+			For("UPDATE SKIP LOCKED").
+			Select()
+		if err != nil {
+			return err
+		}
+		for i := range schedules {
+			if err := s.act(tx, &schedules[i], now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(schedules), err
+}
+
+// act submits one payment. A failed submission is retried with a growing delay until MaxAttempts,
+// and a Debit whose mandate no longer authorises it fails at once. Only database errors abort the
+// batch.
+func (s *Scheduler) act(tx *pg.Tx, schedule *model.PaymentSchedule, now time.Time) error {
+	payment := model.Payment{ID: schedule.PaymentID}
+	err := tx.Select(&payment)
+	if err == pg.ErrNoRows {
+		schedule.Status = Cancelled
+		processed.Inc(Cancelled)
+		return tx.Update(schedule)
+	}
+	if err != nil {
+		return err
+	}
+
+	submit := s.Submit
+	if submit == nil {
+		submit = Release
+	}
+	schedule.Attempts++
+	// a submission that fails part way is undone back to the savepoint, which also leaves the
+	// transaction usable to record the attempt after the submitter's own query failed
+	if _, err := tx.Exec("SAVEPOINT submission"); err != nil {
+		return err
+	}
+	// a Debit's mandate may have been cancelled since the payment was created, the check share locks
+	// it so it cannot be cancelled while the payment is submitted
+	err = mandate.Check(tx, payment)
+	_, refused := err.(*attribute.Error)
+	if err == nil {
+		err = submit(tx, payment)
+	}
+	if err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT submission"); rollbackErr != nil {
+			return rollbackErr
+		}
+		schedule.LastError = err.Error()
+		maxAttempts := s.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = DefaultMaxAttempts
+		}
+		// retrying cannot make a refused payment acceptable
+		if refused || schedule.Attempts >= maxAttempts {
+			schedule.Status = Failed
+			logging.Default.Error("scheduled payment failed", "payment_id", payment.ID, "attempts", schedule.Attempts, "error", err)
+		} else {
+			schedule.NextAttemptAt = now.Add(time.Duration(schedule.Attempts) * time.Minute)
+		}
+		processed.Inc(schedule.Status)
+		return tx.Update(schedule)
+	}
+	if _, err := tx.Exec("RELEASE SAVEPOINT submission"); err != nil {
+		return err
+	}
+
+	schedule.Status = Submitted
+	schedule.LastError = ""
+	schedule.SubmittedAt = &now
+	processed.Inc(Submitted)
+	logging.Default.Info("scheduled payment submitted", "payment_id", payment.ID,
+		"payment_scheme", payment.Attributes.PaymentScheme, "processing_date", schedule.ProcessingDate)
+	return tx.Update(schedule)
+}
@@ -0,0 +1,19 @@
+package scheduler
+
+import (
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewScheduleShouldScheduleDuePaymentsNow(t *testing.T) {
+	now := time.Date(2017, 1, 18, 23, 30, 0, 0, time.UTC)
+
+	for date, expected := range map[string]string{"": "2017-01-18", "2017-01-17": "2017-01-17", "2017-01-25": "2017-01-25"} {
+		schedule := newSchedule(model.Payment{Attributes: model.Attributes{ProcessingDate: date}}, now)
+		assert.Equal(t, expected, schedule.ProcessingDate, date)
+		assert.Equal(t, Scheduled, schedule.Status, date)
+		assert.Equal(t, now, schedule.NextAttemptAt, date)
+	}
+}
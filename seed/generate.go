@@ -0,0 +1,259 @@
+package seed
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	uuid "github.com/satori/go.uuid"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// namespace scopes generated payment IDs so the same seed always yields the same IDs
+var namespace = uuid.NewV5(uuid.NamespaceOID, "form3-payments/seed")
+
+var (
+	firstNames = []string{"Emelia", "Wilfred", "Amara", "Oliver", "Priya", "George", "Isla", "Mohammed", "Freya", "Arthur",
+		"Zara", "Henry", "Chloe", "Yusuf", "Maisie", "Theo", "Ava", "Kwame", "Lily", "Finn"}
+	lastNames = []string{"Brown", "Owens", "Okafor", "Smith", "Patel", "Jones", "Taylor", "Khan", "Williams", "Davies",
+		"Evans", "Wilson", "Thomas", "Roberts", "Hughes", "Clarke", "Walker", "Wright", "Edwards", "Green"}
+	streets = []string{"High Street", "Station Road", "Church Lane", "Victoria Road", "Park Avenue", "Mill Lane",
+		"Kings Road", "Queens Crescent", "The Green", "Manor Way"}
+	towns     = []string{"London EC1", "Leeds LS1", "Bristol BS1", "Manchester M1", "Glasgow G1", "Cardiff CF10", "York YO1", "Norwich NR1"}
+	bankCodes = []string{"NWBK", "BARC", "LOYD", "HBUK", "MIDL", "CITI", "MONZ", "SRLG"}
+	purposes  = []string{"Paying for goods/services", "Salary", "Rent", "Invoice settlement", "Gift", "Refund"}
+	bearers   = []string{"SHAR", "DEBT", "CRED"}
+)
+
+type fxRate struct {
+	currency string
+	rate     float64
+}
+
+// rates convert GBP into the original currency, matching the seed data where amount x rate = original amount
+var rates = []fxRate{{"USD", 1.27}, {"EUR", 1.17}, {"JPY", 190.4}, {"CHF", 1.12}}
+
+type scheme struct {
+	name       string
+	schemeType string
+	median     float64
+	weight     int
+}
+
+// schemes are weighted roughly by UK volumes with CHAPS carrying the large values
+var schemes = []scheme{
+	{"FPS", "ImmediatePayment", 60, 70},
+	{"Bacs", "", 250, 25},
+	{"CHAPS", "HighValue", 250000, 5},
+}
+
+// Generator produces realistic synthetic payments. The same seed always produces the same payments
+// in the same order.
+type Generator struct {
+	seed          int64
+	rand          *rand.Rand
+	count         int
+	organisations []uuid.UUID
+	start         time.Time
+}
+
+func NewGenerator(seed int64) *Generator {
+	g := &Generator{
+		seed:  seed,
+		rand:  rand.New(rand.NewSource(seed)),
+		start: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for i := 0; i < 5; i++ {
+		g.organisations = append(g.organisations, uuid.NewV5(namespace, fmt.Sprintf("%d/organisation/%d", seed, i)))
+	}
+	return g
+}
+
+// Next returns the next synthetic payment
+func (g *Generator) Next() model.Payment {
+	g.count++
+	s := g.scheme()
+	pence := g.amount(s.median)
+
+	debtor, beneficiary := g.name(), g.name()
+	debtorSortCode, beneficiarySortCode := g.digits(6), g.digits(6)
+	debtorAccount := g.digits(8)
+
+	a := model.Attributes{
+		Amount:   formatPence(pence),
+		Currency: "GBP",
+		BeneficiaryParty: model.BeneficiaryParty{
+			AccountName:       initials(beneficiary),
+			AccountNumber:     g.digits(8),
+			AccountNumberCode: "BBAN",
+			Address:           g.address(),
+			BankID:            beneficiarySortCode,
+			BankIDCode:        "GBDSC",
+			Name:              beneficiary,
+		},
+		DebtorParty: model.DebtorParty{
+			AccountName:       initials(debtor),
+			AccountNumber:     IBAN(g.pick(bankCodes), debtorSortCode, debtorAccount),
+			AccountNumberCode: "IBAN",
+			Address:           g.address(),
+			BankID:            debtorSortCode,
+			BankIDCode:        "GBDSC",
+			Name:              debtor,
+		},
+		ChargesInformation: g.charges(),
+		EndToEndReference:  fmt.Sprintf("E2E%010d", g.count),
+		NumericReference:   g.digits(7),
+		PaymentID:          g.digits(18),
+		PaymentPurpose:     g.pick(purposes),
+		PaymentScheme:      s.name,
+		PaymentType:        "Credit",
+		ProcessingDate:     g.processingDate(),
+		Reference:          fmt.Sprintf("INV %06d", g.rand.Intn(1000000)),
+		SchemePaymentType:  s.schemeType,
+		SponsorParty: model.SponsorParty{
+			AccountNumber: g.digits(8),
+			BankID:        g.digits(6),
+			BankIDCode:    "GBDSC",
+		},
+	}
+
+	// Bacs only carries domestic account numbers
+	if s.name == "Bacs" {
+		a.DebtorParty.AccountNumber = debtorAccount
+		a.DebtorParty.AccountNumberCode = "BBAN"
+	}
+	if s.name == "FPS" {
+		a.SchemePaymentSubType = "InternetBanking"
+	}
+	// a share of payments were converted from another currency
+	if g.rand.Intn(100) < 15 {
+		a.Fx = g.fx(pence)
+	}
+
+	return model.Payment{
+		Type:           "Payment",
+		ID:             uuid.NewV5(namespace, fmt.Sprintf("%d/payment/%d", g.seed, g.count)),
+		OrganisationID: g.organisations[g.rand.Intn(len(g.organisations))],
+		Attributes:     a,
+	}
+}
+
+func (g *Generator) scheme() scheme {
+	n := g.rand.Intn(100)
+	for _, s := range schemes {
+		if n < s.weight {
+			return s
+		}
+		n -= s.weight
+	}
+	return schemes[0]
+}
+
+// amount draws from a log-normal distribution around the scheme median, in pence
+func (g *Generator) amount(median float64) int64 {
+	pounds := median * math.Exp(g.rand.NormFloat64())
+	pence := int64(math.Round(pounds * 100))
+	if pence < 1 {
+		pence = 1
+	}
+	return pence
+}
+
+func (g *Generator) charges() model.ChargesInformation {
+	c := model.ChargesInformation{BearerCode: g.pick(bearers)}
+	if c.BearerCode != "CRED" {
+		c.SenderCharges = []model.Charge{{Amount: formatPence(int64(g.rand.Intn(1000))), Currency: "GBP"}}
+	}
+	if c.BearerCode != "DEBT" {
+		c.ReceiverChargesAmount = formatPence(int64(g.rand.Intn(500)))
+		c.ReceiverChargesCurrency = "GBP"
+	}
+	return c
+}
+
+func (g *Generator) fx(pence int64) model.Fx {
+	r := rates[g.rand.Intn(len(rates))]
+	rate := r.rate * (1 + (g.rand.Float64()-0.5)/50)
+	rate = math.Round(rate*100000) / 100000
+	return model.Fx{
+		ContractReference: fmt.Sprintf("FX%07d", g.rand.Intn(10000000)),
+		ExchangeRate:      strconv.FormatFloat(rate, 'f', 5, 64),
+		OriginalAmount:    formatPence(int64(math.Round(float64(pence) * rate))),
+		OriginalCurrency:  r.currency,
+	}
+}
+
+// processingDate picks a weekday within a year of the start date
+func (g *Generator) processingDate() string {
+	date := g.start.AddDate(0, 0, g.rand.Intn(365))
+	for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date.Format("2006-01-02")
+}
+
+func (g *Generator) name() string {
+	return g.pick(firstNames) + " " + g.pick(lastNames)
+}
+
+func (g *Generator) address() string {
+	return fmt.Sprintf("%d %s %s", 1+g.rand.Intn(200), g.pick(streets), g.pick(towns))
+}
+
+func (g *Generator) pick(values []string) string {
+	return values[g.rand.Intn(len(values))]
+}
+
+func (g *Generator) digits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + g.rand.Intn(10))
+	}
+	return string(b)
+}
+
+// initials shortens the first name as account names are in the seed data
+func initials(name string) string {
+	return name[:1] + name[strings.Index(name, " "):]
+}
+
+func formatPence(pence int64) string {
+	return fmt.Sprintf("%d.%02d", pence/100, pence%100)
+}
+
+// IBAN builds a GB IBAN from its bank code, sort code and account number with ISO 13616 check digits
+func IBAN(bankCode, sortCode, account string) string {
+	bban := bankCode + sortCode + account
+	return "GB" + fmt.Sprintf("%02d", 98-ibanRemainder(bban+"GB00")) + bban
+}
+
+// ValidIBAN reports whether the IBAN check digits are correct
+func ValidIBAN(iban string) bool {
+	if len(iban) < 5 {
+		return false
+	}
+	return ibanRemainder(iban[4:]+iban[:4]) == 1
+}
+
+// ibanRemainder converts letters to numbers, A being 10, and takes the value modulo 97 a digit at a
+// time. Characters that cannot appear in an IBAN give -1.
+func ibanRemainder(s string) int {
+	remainder := 0
+	for _, r := range s {
+		var value string
+		switch {
+		case r >= '0' && r <= '9':
+			value = string(r)
+		case r >= 'A' && r <= 'Z':
+			value = strconv.Itoa(int(r-'A') + 10)
+		default:
+			return -1
+		}
+		for _, d := range value {
+			remainder = (remainder*10 + int(d-'0')) % 97
+		}
+	}
+	return remainder
+}
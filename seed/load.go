@@ -0,0 +1,103 @@
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"github.com/go-pg/pg/orm"
+	"io"
+)
+
+const DefaultBatchSize = 500
+
+// Loader inserts payments in batches. Payments whose ID already exists are skipped so the same file
+// can be loaded any number of times.
+type Loader struct {
+	db        orm.DB
+	batchSize int
+	batch     []model.Payment
+	Inserted  int
+	Skipped   int
+}
+
+func NewLoader(db orm.DB, batchSize int) *Loader {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	return &Loader{db: db, batchSize: batchSize}
+}
+
+// Add validates the payment and queues it, inserting the batch once it is full
+func (l *Loader) Add(payment model.Payment) error {
+	if err := payment.Validate(); err != nil {
+		return err
+	}
+	l.batch = append(l.batch, payment)
+	if len(l.batch) >= l.batchSize {
+		return l.Flush()
+	}
+	return nil
+}
+
+// Flush inserts the queued payments
+func (l *Loader) Flush() error {
+	if len(l.batch) == 0 {
+		return nil
+	}
+	result, err := l.db.Model(&l.batch).OnConflict("DO NOTHING").Insert()
+	if err != nil {
+		return err
+	}
+	l.Inserted += result.RowsAffected()
+	l.Skipped += len(l.batch) - result.RowsAffected()
+	l.batch = l.batch[:0]
+	return nil
+}
+
+// Decode reads a JSON array of payments, the seeddata.json format, one payment at a time so files
+// larger than memory can be loaded
+func Decode(r io.Reader, fn func(model.Payment) error) error {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return errors.New("expected a JSON array of payments")
+	}
+	for i := 0; decoder.More(); i++ {
+		var payment model.Payment
+		if err := decoder.Decode(&payment); err != nil {
+			return fmt.Errorf("payment %d: %s", i, err)
+		}
+		if err := fn(payment); err != nil {
+			return fmt.Errorf("payment %d: %s", i, err)
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// Encode writes payments from next as a JSON array until it returns false, streaming rather than
+// holding them all in memory
+func Encode(w io.Writer, next func() (model.Payment, bool)) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		payment, ok := next()
+		if !ok {
+			break
+		}
+		data, err := json.Marshal(payment)
+		if err != nil {
+			return err
+		}
+		separator := ",\n"
+		if i == 0 {
+			separator = "\n"
+		}
+		if _, err := io.WriteString(w, separator+string(data)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
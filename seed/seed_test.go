@@ -0,0 +1,86 @@
+package seed
+
+import (
+	"bytes"
+	"github.com/clD11/form3-payments/bacs"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGeneratorShouldBeDeterministicForSeed(t *testing.T) {
+	first, second, other := NewGenerator(7), NewGenerator(7), NewGenerator(8)
+
+	for i := 0; i < 100; i++ {
+		payment := first.Next()
+		assert.Equal(t, payment, second.Next())
+		assert.NotEqual(t, payment.ID, other.Next().ID)
+	}
+}
+
+func TestGeneratorShouldProduceValidPayments(t *testing.T) {
+	generator := NewGenerator(42)
+	var bacsPayments []model.Payment
+
+	for i := 0; i < 2000; i++ {
+		payment := generator.Next()
+		assert.NoError(t, payment.Validate())
+
+		debtor := payment.Attributes.DebtorParty
+		if debtor.AccountNumberCode == "IBAN" {
+			assert.True(t, ValidIBAN(debtor.AccountNumber), debtor.AccountNumber)
+		}
+		if payment.Attributes.PaymentScheme == bacs.Scheme {
+			bacsPayments = append(bacsPayments, payment)
+		}
+	}
+
+	submission := bacs.Submission{ServiceUserNumber: "123456", SerialNumber: "000001", CreationDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	_, err := submission.Generate(bacsPayments)
+	assert.NoError(t, err)
+}
+
+func TestIBANShouldMatchPublishedExample(t *testing.T) {
+	assert.Equal(t, "GB29NWBK60161331926819", IBAN("NWBK", "601613", "31926819"))
+	assert.False(t, ValidIBAN("GB28NWBK60161331926819"))
+}
+
+func TestDecodeShouldReadSeedData(t *testing.T) {
+	file, err := os.Open("../seeddata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var payments []model.Payment
+	err = Decode(file, func(p model.Payment) error {
+		payments = append(payments, p)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, payments, 14)
+}
+
+func TestEncodeShouldRoundTripThroughDecode(t *testing.T) {
+	generator := NewGenerator(1)
+	expected := []model.Payment{generator.Next(), generator.Next()}
+	i := 0
+	var b bytes.Buffer
+	assert.NoError(t, Encode(&b, func() (model.Payment, bool) {
+		if i == len(expected) {
+			return model.Payment{}, false
+		}
+		i++
+		return expected[i-1], true
+	}))
+
+	var actual []model.Payment
+	assert.NoError(t, Decode(&b, func(p model.Payment) error {
+		actual = append(actual, p)
+		return nil
+	}))
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,152 @@
+package standingorder
+
+import (
+	"context"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/clD11/form3-payments/mandate"
+	"github.com/clD11/form3-payments/metrics"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/poll"
+	"github.com/clD11/form3-payments/prepare"
+	"github.com/clD11/form3-payments/scheduler"
+	"github.com/go-pg/pg"
+	uuid "github.com/satori/go.uuid"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultInterval  = time.Minute
+	DefaultBatchSize = 100
+)
+
+var generated = metrics.NewCounterVec("standing_order_payments_total",
+	"Occurrences of standing orders the generator acted on by outcome", "outcome")
+
+// Generator is a worker that makes the payments of active standing orders on the processing date
+// of each occurrence. Orders are locked with SKIP LOCKED, so replicas never make an occurrence
+// twice, and payment IDs are derived from the order and sequence.
+type Generator struct {
+	DB *pg.DB
+	// Preparer completes each payment as creating it through the API would, its calendars and
+	// routes also plan the occurrences
+	Preparer  prepare.Preparer
+	Interval  time.Duration
+	BatchSize int
+	// Now is the clock, time.Now when nil
+	Now func() time.Time
+}
+
+func (g *Generator) Name() string { return "standing-orders" }
+
+// Run makes due payments every interval until the context is cancelled
+func (g *Generator) Run(ctx context.Context) error {
+	return poll.Run(ctx, g.Name(), poll.Interval(g.Interval, DefaultInterval), g.batchSize(), g.RunOnce)
+}
+
+func (g *Generator) batchSize() int {
+	return poll.BatchSize(g.BatchSize, DefaultBatchSize)
+}
+
+// RunOnce makes the payments of a batch of due standing orders and returns how many it took
+func (g *Generator) RunOnce() (int, error) {
+	now := poll.Now(g.Now)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var orders []model.StandingOrder
+	err := g.DB.RunInTransaction(func(tx *pg.Tx) error {
+		err := tx.Model(&orders).
+			Where("status = ?", Active).
+			Where("next_processing_date <= ?", today.Format(calendar.DateLayout)).
+			Order("next_processing_date", "id").
+			Limit(g.batchSize()).
+			For("UPDATE SKIP LOCKED").
+			Select()
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			if err := g.generate(tx, &orders[i], now, today); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(orders), err
+}
+
+// generate makes the payment of the order's next occurrence and plans the one after. An occurrence
+// the template can no longer be routed, priced or collected under its mandate for is skipped with
+// the reason in last_error, only database errors abort the batch.
+func (g *Generator) generate(tx *pg.Tx, order *model.StandingOrder, now, today time.Time) error {
+	sequence := order.Occurrences + 1
+	payment := model.Payment{
+		Type:           "Payment",
+		ID:             uuid.NewV5(order.ID, strconv.Itoa(sequence)),
+		OrganisationID: order.OrganisationID,
+		Attributes:     order.Template,
+	}
+	payment.Attributes.ProcessingDate = order.NextProcessingDate
+	// an occurrence missed while the service was down is paid on the next date it can be
+	late := order.NextProcessingDate < today.Format(calendar.DateLayout)
+	if late {
+		payment.Attributes.ProcessingDate = today.Format(calendar.DateLayout)
+	}
+
+	order.LastError = ""
+	// the planned date already respects the order's business day adjustment, only a late one is
+	// checked against the calendar and rolled forward
+	preparer := g.Preparer
+	preparer.Calendars = nil
+	if late && g.Preparer.Calendars != nil {
+		calendars := *g.Preparer.Calendars
+		calendars.Rule = calendar.RollForward
+		preparer.Calendars = &calendars
+	}
+	_, reason := preparer.Prepare(tx, &payment, now)
+	if reason == nil {
+		// a recurring collection needs its mandate to be active on each occurrence
+		reason = mandate.Check(tx, payment)
+	}
+	if _, ok := reason.(*attribute.Error); reason != nil && !ok {
+		return reason
+	}
+	if reason != nil {
+		order.LastError = reason.Error()
+		generated.Inc("skipped")
+		logging.Default.Error("standing order occurrence skipped", "standing_order_id", order.ID, "date", order.NextDate, "error", reason)
+	} else {
+		if err := tx.Insert(&payment); err != nil {
+			return err
+		}
+		if err := scheduler.Add(tx, payment, now); err != nil {
+			return err
+		}
+		err := tx.Insert(&model.StandingOrderPayment{
+			StandingOrderID: order.ID,
+			Sequence:        sequence,
+			PaymentID:       payment.ID,
+			Date:            order.NextDate,
+			CreatedAt:       now,
+		})
+		if err != nil {
+			return err
+		}
+		order.Occurrences = sequence
+		order.LastProcessingDate = payment.Attributes.ProcessingDate
+		generated.Inc("created")
+		logging.Default.Info("standing order payment created", "standing_order_id", order.ID, "payment_id", payment.ID,
+			"processing_date", payment.Attributes.ProcessingDate)
+	}
+
+	if order.LastProcessingDate < order.NextProcessingDate {
+		order.LastProcessingDate = order.NextProcessingDate
+	}
+	order.NextIndex++
+	if err := Plan(order, g.Preparer.Calendars, Scheme(g.Preparer.Routes, order.Template), today); err != nil {
+		return err
+	}
+	order.UpdatedAt = now
+	return tx.Update(order)
+}
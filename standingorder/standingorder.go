@@ -0,0 +1,179 @@
+package standingorder
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	"time"
+)
+
+// Statuses of a standing order. Only active orders make payments, cancelled and completed orders
+// cannot be changed.
+const (
+	Active    = "active"
+	Paused    = "paused"
+	Cancelled = "cancelled"
+	Completed = "completed"
+)
+
+// Frequencies of the recurrence rule. Monthly orders fall on day_of_month, or the last day of
+// months shorter than that.
+const (
+	Weekly     = "weekly"
+	Monthly    = "monthly"
+	EndOfMonth = "end_of_month"
+)
+
+// Business day adjustments move an occurrence that falls on a day the scheme is closed to the
+// following or preceding business day, or leave it alone
+const (
+	Following    = "following"
+	Preceding    = "preceding"
+	NoAdjustment = "none"
+)
+
+// Validate checks the recurrence rule and the template, defaulting the business day adjustment to
+// following. A template without a scheme must be one the routing table can carry.
+func Validate(order *model.StandingOrder, table *routing.Table) error {
+	switch order.Frequency {
+	case Weekly, EndOfMonth:
+		if order.DayOfMonth != 0 {
+			return &attribute.Error{Code: "invalid_standing_order", Member: "day_of_month", Message: "day_of_month is only for monthly standing orders"}
+		}
+	case Monthly:
+		if order.DayOfMonth < 1 || order.DayOfMonth > 31 {
+			return &attribute.Error{Code: "invalid_standing_order", Member: "day_of_month", Message: fmt.Sprintf("day_of_month %d must be from 1 to 31", order.DayOfMonth)}
+		}
+	default:
+		return &attribute.Error{Code: "invalid_standing_order", Member: "frequency",
+			Message: fmt.Sprintf("frequency %q must be %s, %s or %s", order.Frequency, Weekly, Monthly, EndOfMonth)}
+	}
+	if _, err := time.Parse(calendar.DateLayout, order.StartDate); err != nil {
+		return &attribute.Error{Code: "invalid_standing_order", Member: "start_date", Message: fmt.Sprintf("start_date %q is not in YYYY-MM-DD format", order.StartDate)}
+	}
+	if order.EndDate != "" {
+		if _, err := time.Parse(calendar.DateLayout, order.EndDate); err != nil {
+			return &attribute.Error{Code: "invalid_standing_order", Member: "end_date", Message: fmt.Sprintf("end_date %q is not in YYYY-MM-DD format", order.EndDate)}
+		}
+		if order.EndDate < order.StartDate {
+			return &attribute.Error{Code: "invalid_standing_order", Member: "end_date", Message: fmt.Sprintf("end_date %s is before start_date %s", order.EndDate, order.StartDate)}
+		}
+	}
+	if order.Count < 0 {
+		return &attribute.Error{Code: "invalid_standing_order", Member: "count", Message: fmt.Sprintf("count %d must not be negative", order.Count)}
+	}
+	switch order.BusinessDayAdjustment {
+	case "":
+		order.BusinessDayAdjustment = Following
+	case Following, Preceding, NoAdjustment:
+	default:
+		return &attribute.Error{Code: "invalid_standing_order", Member: "business_day_adjustment", Message: fmt.Sprintf("business_day_adjustment %q must be %s, %s or %s",
+			order.BusinessDayAdjustment, Following, Preceding, NoAdjustment)}
+	}
+	return validateTemplate(order, table)
+}
+
+func validateTemplate(order *model.StandingOrder, table *routing.Table) error {
+	t := order.Template
+	if t.ProcessingDate != "" {
+		return &attribute.Error{Code: "invalid_standing_order", Member: "template/processing_date", Message: "processing_date is set by each occurrence of the standing order"}
+	}
+	if t.Fx != (model.Fx{}) {
+		return &attribute.Error{Code: "invalid_standing_order", Member: "template/fx", Message: "standing orders are paid in the template currency without conversion"}
+	}
+	payment := model.Payment{ID: order.ID, OrganisationID: order.OrganisationID, Attributes: t}
+	if err := payment.Validate(); err != nil {
+		return &attribute.Error{Code: "invalid_standing_order", Member: "template", Message: "template " + err.Error()}
+	}
+	if t.PaymentScheme != "" || table == nil {
+		return nil
+	}
+	if _, err := table.Route(t); err != nil {
+		e := err.(*attribute.Error)
+		return &attribute.Error{Code: "invalid_standing_order", Member: "template/" + e.Member, Message: e.Message}
+	}
+	return nil
+}
+
+// Scheme is the scheme the template pays by, the one it is routed to when it names none. Unknown
+// schemes keep the weekday calendar.
+func Scheme(table *routing.Table, template model.Attributes) string {
+	if template.PaymentScheme != "" || table == nil {
+		return template.PaymentScheme
+	}
+	decision, err := table.Route(template)
+	if err != nil {
+		return ""
+	}
+	return decision.Scheme
+}
+
+// Occurrence returns the date of the standing order's occurrence with index i, counting from zero
+// at the first date of the rule on or after the start date
+func Occurrence(order *model.StandingOrder, i int) time.Time {
+	start, _ := time.Parse(calendar.DateLayout, order.StartDate)
+	if order.Frequency == Weekly {
+		return start.AddDate(0, 0, 7*i)
+	}
+	day := order.DayOfMonth
+	if order.Frequency == EndOfMonth {
+		day = 31
+	}
+	if monthDay(start.Year(), start.Month(), day).Before(start) {
+		i++
+	}
+	return monthDay(start.Year(), start.Month()+time.Month(i), day)
+}
+
+// monthDay is the day of the month, or its last day when the month is shorter
+func monthDay(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// adjust moves a date the scheme is closed on by the order's business day adjustment
+func adjust(calendars *calendar.Calendars, order *model.StandingOrder, scheme string, date time.Time) (time.Time, error) {
+	if calendars.Closed(scheme, order.Template.Currency, date) == "" {
+		return date, nil
+	}
+	switch order.BusinessDayAdjustment {
+	case Preceding:
+		return calendars.PreviousBusinessDay(scheme, order.Template.Currency, date)
+	case NoAdjustment:
+		return date, nil
+	}
+	return calendars.NextBusinessDay(scheme, order.Template.Currency, date)
+}
+
+// Plan finds the next occurrence from NextIndex whose processing date is today or later and after
+// the last payment the order made. An order past its end date or count is completed.
+func Plan(order *model.StandingOrder, calendars *calendar.Calendars, scheme string, today time.Time) error {
+	for i := order.NextIndex; ; i++ {
+		date := Occurrence(order, i)
+		if (order.Count > 0 && order.Occurrences >= order.Count) ||
+			(order.EndDate != "" && date.Format(calendar.DateLayout) > order.EndDate) {
+			order.Status = Completed
+			order.NextDate = ""
+			order.NextProcessingDate = ""
+			return nil
+		}
+		processing, err := adjust(calendars, order, scheme, date)
+		if err != nil {
+			return err
+		}
+		day := processing.Format(calendar.DateLayout)
+		if processing.Before(today) || day <= order.LastProcessingDate {
+			continue
+		}
+		order.NextIndex = i
+		order.NextDate = date.Format(calendar.DateLayout)
+		order.NextProcessingDate = day
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package standingorder
+
+import (
+	"github.com/clD11/form3-payments/attribute"
+	"github.com/clD11/form3-payments/calendar"
+	"github.com/clD11/form3-payments/model"
+	"github.com/clD11/form3-payments/routing"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse(calendar.DateLayout, s)
+	return d
+}
+
+func order(frequency string, dayOfMonth int, start string) *model.StandingOrder {
+	return &model.StandingOrder{
+		ID:                    uuid.NewV4(),
+		OrganisationID:        uuid.NewV4(),
+		Frequency:             frequency,
+		DayOfMonth:            dayOfMonth,
+		StartDate:             start,
+		BusinessDayAdjustment: Following,
+		Template: model.Attributes{
+			Amount:           "250.00",
+			Currency:         "GBP",
+			PaymentScheme:    "Bacs",
+			DebtorParty:      model.DebtorParty{AccountNumber: "12345678"},
+			BeneficiaryParty: model.BeneficiaryParty{AccountNumber: "87654321"},
+		},
+	}
+}
+
+func TestOccurrenceShouldFollowRule(t *testing.T) {
+	for _, c := range []struct {
+		order    *model.StandingOrder
+		index    int
+		expected string
+	}{
+		{order(Weekly, 0, "2027-01-15"), 0, "2027-01-15"},
+		{order(Weekly, 0, "2027-01-15"), 2, "2027-01-29"},
+		{order(Monthly, 31, "2027-01-10"), 0, "2027-01-31"},
+		{order(Monthly, 31, "2027-01-10"), 1, "2027-02-28"},
+		{order(Monthly, 31, "2027-01-10"), 3, "2027-04-30"},
+		{order(Monthly, 5, "2027-01-10"), 0, "2027-02-05"},
+		{order(EndOfMonth, 0, "2027-02-28"), 0, "2027-02-28"},
+		{order(EndOfMonth, 0, "2027-02-28"), 1, "2027-03-31"},
+	} {
+		assert.Equal(t, c.expected, Occurrence(c.order, c.index).Format(calendar.DateLayout), "%s %d", c.order.Frequency, c.index)
+	}
+}
+
+func TestPlanShouldAdjustOccurrencesToBusinessDays(t *testing.T) {
+	calendars, err := calendar.Load("../calendar/holidays")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		order      *model.StandingOrder
+		adjustment string
+		nominal    string
+		processing string
+	}{
+		{order(EndOfMonth, 0, "2027-01-01"), Following, "2027-01-31", "2027-02-01"},
+		{order(EndOfMonth, 0, "2027-01-01"), Preceding, "2027-01-31", "2027-01-29"},
+		{order(EndOfMonth, 0, "2027-01-01"), NoAdjustment, "2027-01-31", "2027-01-31"},
+		{order(Monthly, 25, "2026-12-01"), Following, "2026-12-25", "2026-12-29"},
+	} {
+		c.order.BusinessDayAdjustment = c.adjustment
+		assert.NoError(t, Plan(c.order, calendars, "Bacs", date("2026-12-01")))
+		assert.NotEqual(t, Completed, c.order.Status)
+		assert.Equal(t, c.nominal, c.order.NextDate, c.adjustment)
+		assert.Equal(t, c.processing, c.order.NextProcessingDate, c.adjustment)
+	}
+}
+
+func TestPlanShouldSkipPastOccurrencesAndCompleteAtEnd(t *testing.T) {
+	calendars, err := calendar.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weekly := order(Weekly, 0, "2027-01-01")
+	weekly.Status = Active
+	assert.NoError(t, Plan(weekly, calendars, "Bacs", date("2027-01-20")))
+	assert.Equal(t, 3, weekly.NextIndex)
+	assert.Equal(t, "2027-01-22", weekly.NextProcessingDate)
+
+	// an occurrence is not paid twice on the same date
+	weekly.NextIndex = 0
+	weekly.LastProcessingDate = "2027-01-22"
+	assert.NoError(t, Plan(weekly, calendars, "Bacs", date("2027-01-20")))
+	assert.Equal(t, "2027-01-29", weekly.NextProcessingDate)
+
+	counted := order(Weekly, 0, "2027-01-01")
+	counted.Status = Active
+	counted.Count = 3
+	counted.Occurrences = 3
+	assert.NoError(t, Plan(counted, calendars, "Bacs", date("2027-01-20")))
+	assert.Equal(t, Completed, counted.Status)
+	assert.Empty(t, counted.NextProcessingDate)
+
+	ended := order(Weekly, 0, "2027-01-01")
+	ended.Status = Active
+	ended.EndDate = "2027-01-21"
+	assert.NoError(t, Plan(ended, calendars, "Bacs", date("2027-01-20")))
+	assert.Equal(t, Completed, ended.Status)
+}
+
+func TestValidateShouldRejectInvalidRulesAndTemplates(t *testing.T) {
+	for _, c := range []struct {
+		change func(*model.StandingOrder)
+		member string
+	}{
+		{func(o *model.StandingOrder) { o.Frequency = "daily" }, "frequency"},
+		{func(o *model.StandingOrder) { o.DayOfMonth = 32 }, "day_of_month"},
+		{func(o *model.StandingOrder) { o.Frequency = Weekly }, "day_of_month"},
+		{func(o *model.StandingOrder) { o.StartDate = "01/02/2027" }, "start_date"},
+		{func(o *model.StandingOrder) { o.EndDate = "2026-12-31" }, "end_date"},
+		{func(o *model.StandingOrder) { o.Count = -1 }, "count"},
+		{func(o *model.StandingOrder) { o.BusinessDayAdjustment = "nearest" }, "business_day_adjustment"},
+		{func(o *model.StandingOrder) { o.Template.ProcessingDate = "2027-01-05" }, "template/processing_date"},
+		{func(o *model.StandingOrder) { o.Template.Fx.ExchangeRate = "1.2" }, "template/fx"},
+		{func(o *model.StandingOrder) { o.Template.Amount = "ten" }, "template"},
+		{func(o *model.StandingOrder) { o.Template.PaymentScheme = ""; o.Template.RequestedSpeed = "never" }, "template/requested_speed"},
+	} {
+		o := order(Monthly, 5, "2027-01-01")
+		c.change(o)
+		err := Validate(o, routing.DefaultTable())
+		if assert.Error(t, err, c.member) {
+			assert.Equal(t, c.member, err.(*attribute.Error).Member)
+		}
+	}
+
+	o := order(Monthly, 5, "2027-01-01")
+	o.BusinessDayAdjustment = ""
+	assert.NoError(t, Validate(o, routing.DefaultTable()))
+	assert.Equal(t, Following, o.BusinessDayAdjustment)
+}
@@ -0,0 +1,144 @@
+package strictjson
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Check reports the first member of the value that encoding/json would ignore or fail to decode
+// into t: members no field is named after and values of the wrong type. Null is accepted anywhere
+// as encoding/json leaves the field unchanged. Types that decode themselves are not looked into.
+func Check(v *Value, t reflect.Type, pointer string) error {
+	if v.Kind == Null {
+		return nil
+	}
+	if t.Kind() != reflect.Ptr {
+		if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+			return nil
+		}
+		if reflect.PtrTo(t).Implements(textUnmarshaler) {
+			return expect(v, String, pointer)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return Check(v, t.Elem(), pointer)
+	case reflect.Interface:
+		return nil
+	case reflect.String:
+		return expect(v, String, pointer)
+	case reflect.Bool:
+		return expect(v, Bool, pointer)
+	case reflect.Float32, reflect.Float64:
+		return expect(v, Number, pointer)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if err := expect(v, Number, pointer); err != nil {
+			return err
+		}
+		if strings.ContainsAny(v.Literal, ".eE") {
+			return mismatch(v, pointer, "an integer")
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if err := expect(v, Number, pointer); err != nil {
+			return err
+		}
+		if strings.ContainsAny(v.Literal, "-.eE") {
+			return mismatch(v, pointer, "a non-negative integer")
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return expect(v, String, pointer)
+		}
+		if err := expect(v, Array, pointer); err != nil {
+			return err
+		}
+		for i, item := range v.Items {
+			if err := Check(item, t.Elem(), fmt.Sprintf("%s/%d", pointer, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if err := expect(v, Object, pointer); err != nil {
+			return err
+		}
+		for _, member := range v.Members {
+			if err := Check(member.Value, t.Elem(), pointer+"/"+Escape(member.Name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if err := expect(v, Object, pointer); err != nil {
+			return err
+		}
+		fields := fields(t)
+		for _, member := range v.Members {
+			memberPointer := pointer + "/" + Escape(member.Name)
+			field, ok := fields[member.Name]
+			if !ok {
+				return &Error{Kind: UnknownMember, Pointer: memberPointer, Offset: member.Offset,
+					Message: fmt.Sprintf("%q is not a known member", member.Name)}
+			}
+			if err := Check(member.Value, field, memberPointer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func expect(v *Value, kind Kind, pointer string) error {
+	if v.Kind != kind {
+		return mismatch(v, pointer, kind.String())
+	}
+	return nil
+}
+
+func mismatch(v *Value, pointer, expected string) error {
+	return &Error{Kind: TypeMismatch, Pointer: pointer, Offset: v.Offset,
+		Message: fmt.Sprintf("Expected %s but found %s", expected, v.Kind)}
+}
+
+// fields maps the JSON names of a struct's exported fields, including those of embedded structs,
+// to their types. Names must match exactly unlike encoding/json's case insensitive fallback.
+func fields(t reflect.Type) map[string]reflect.Type {
+	names := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for n, ft := range fields(embedded) {
+					if _, ok := names[n]; !ok {
+						names[n] = ft
+					}
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = field.Type
+	}
+	return names
+}
@@ -0,0 +1,309 @@
+package strictjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Kind is the JSON type of a value
+type Kind int
+
+const (
+	Null Kind = iota
+	Bool
+	Number
+	String
+	Array
+	Object
+)
+
+var kindNames = []string{"null", "a boolean", "a number", "a string", "an array", "an object"}
+
+func (k Kind) String() string { return kindNames[k] }
+
+// Value is a parsed JSON value that remembers where it started in the document
+type Value struct {
+	Kind    Kind
+	Offset  int64
+	Literal string
+	Members []Member
+	Items   []*Value
+}
+
+// Member is a name value pair of an object in document order, Offset is where the name starts
+type Member struct {
+	Name   string
+	Offset int64
+	Value  *Value
+}
+
+// Member returns the value of the named member of an object, or nil
+func (v *Value) Member(name string) *Value {
+	for _, member := range v.Members {
+		if member.Name == name {
+			return member.Value
+		}
+	}
+	return nil
+}
+
+// ErrorKind says why a document was rejected
+type ErrorKind int
+
+const (
+	SyntaxError ErrorKind = iota
+	DuplicateMember
+	UnknownMember
+	TypeMismatch
+)
+
+// Error locates a problem by JSON pointer and byte offset into the document
+type Error struct {
+	Kind    ErrorKind
+	Pointer string
+	Offset  int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Message, e.Offset)
+}
+
+// maxDepth bounds nesting so a hostile document cannot exhaust the stack
+const maxDepth = 64
+
+// Parse reads exactly one JSON value, rejecting syntax errors, objects that repeat a member name and
+// anything but whitespace after the value
+func Parse(data []byte) (*Value, error) {
+	p := &parser{data: data}
+	p.skipSpace()
+	v, err := p.value("", 0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		return nil, p.errorf("", "Unexpected data after the document")
+	}
+	return v, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func (p *parser) errorf(pointer, format string, args ...interface{}) *Error {
+	return &Error{Kind: SyntaxError, Pointer: pointer, Offset: int64(p.pos), Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) value(pointer string, depth int) (*Value, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf(pointer, "Unexpected end of the document")
+	}
+	if depth > maxDepth {
+		return nil, p.errorf(pointer, "Document is nested more than %d levels deep", maxDepth)
+	}
+
+	v := &Value{Offset: int64(p.pos)}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		v.Kind = Object
+		return v, p.object(v, pointer, depth)
+	case c == '[':
+		v.Kind = Array
+		return v, p.array(v, pointer, depth)
+	case c == '"':
+		v.Kind = String
+		s, err := p.str(pointer)
+		v.Literal = s
+		return v, err
+	case c == '-' || (c >= '0' && c <= '9'):
+		v.Kind = Number
+		n, err := p.number(pointer)
+		v.Literal = n
+		return v, err
+	case p.literal("true"), p.literal("false"):
+		v.Kind = Bool
+		return v, nil
+	case p.literal("null"):
+		v.Kind = Null
+		return v, nil
+	default:
+		return nil, p.errorf(pointer, "Unexpected character %q", c)
+	}
+}
+
+func (p *parser) literal(word string) bool {
+	if bytes.HasPrefix(p.data[p.pos:], []byte(word)) {
+		p.pos += len(word)
+		return true
+	}
+	return false
+}
+
+func (p *parser) object(v *Value, pointer string, depth int) error {
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return p.errorf(pointer, "Expected a member name")
+		}
+		start := p.pos
+		name, err := p.str(pointer)
+		if err != nil {
+			return err
+		}
+		memberPointer := pointer + "/" + Escape(name)
+		if seen[name] {
+			return &Error{Kind: DuplicateMember, Pointer: memberPointer, Offset: int64(start),
+				Message: fmt.Sprintf("Member %q appears more than once", name)}
+		}
+		seen[name] = true
+
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return p.errorf(memberPointer, "Expected ':' after member name")
+		}
+		p.pos++
+		p.skipSpace()
+		member, err := p.value(memberPointer, depth+1)
+		if err != nil {
+			return err
+		}
+		v.Members = append(v.Members, Member{Name: name, Offset: int64(start), Value: member})
+
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return p.errorf(pointer, "Unexpected end of the document")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return nil
+		default:
+			return p.errorf(pointer, "Expected ',' or '}' after member")
+		}
+	}
+}
+
+func (p *parser) array(v *Value, pointer string, depth int) error {
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return nil
+	}
+
+	for {
+		p.skipSpace()
+		item, err := p.value(fmt.Sprintf("%s/%d", pointer, len(v.Items)), depth+1)
+		if err != nil {
+			return err
+		}
+		v.Items = append(v.Items, item)
+
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return p.errorf(pointer, "Unexpected end of the document")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return nil
+		default:
+			return p.errorf(pointer, "Expected ',' or ']' after item")
+		}
+	}
+}
+
+// str finds the end of the string and lets encoding/json decode its escapes
+func (p *parser) str(pointer string) (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '\\':
+			p.pos += 2
+		case c == '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal(p.data[start:p.pos], &s); err != nil {
+				p.pos = start
+				return "", p.errorf(pointer, "Invalid string")
+			}
+			return s, nil
+		case c < 0x20:
+			return "", p.errorf(pointer, "Control character in string")
+		default:
+			p.pos++
+		}
+	}
+	return "", p.errorf(pointer, "Unterminated string")
+}
+
+func (p *parser) number(pointer string) (string, error) {
+	start := p.pos
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	switch {
+	case p.pos < len(p.data) && p.data[p.pos] == '0':
+		p.pos++
+	case !p.digits():
+		return "", p.errorf(pointer, "Invalid number")
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '.' {
+		p.pos++
+		if !p.digits() {
+			return "", p.errorf(pointer, "Invalid number")
+		}
+	}
+	if p.pos < len(p.data) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if !p.digits() {
+			return "", p.errorf(pointer, "Invalid number")
+		}
+	}
+	return string(p.data[start:p.pos]), nil
+}
+
+func (p *parser) digits() bool {
+	start := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// Escape encodes a member name as a JSON pointer reference token
+func Escape(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,80 @@
+package strictjson
+
+import (
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func TestParseShouldLocateErrors(t *testing.T) {
+	for document, expected := range map[string]Error{
+		`{"a":1,}`:                  {Kind: SyntaxError, Pointer: "", Offset: 7, Message: "Expected a member name"},
+		`{"a":{"b":tru}}`:           {Kind: SyntaxError, Pointer: "/a/b", Offset: 10, Message: "Unexpected character 't'"},
+		`{"a":[1,2,01]}`:            {Kind: SyntaxError, Pointer: "/a", Offset: 11, Message: "Expected ',' or ']' after item"},
+		`{"a":1,"b":{"c":1,"c":2}}`: {Kind: DuplicateMember, Pointer: "/b/c", Offset: 18, Message: `Member "c" appears more than once`},
+		`{"a/b":1,"a/b":2}`:         {Kind: DuplicateMember, Pointer: "/a~1b", Offset: 9, Message: `Member "a/b" appears more than once`},
+		`{"a":1} {"a":2}`:           {Kind: SyntaxError, Pointer: "", Offset: 8, Message: "Unexpected data after the document"},
+		`{"a":"b`:                   {Kind: SyntaxError, Pointer: "/a", Offset: 7, Message: "Unterminated string"},
+		``:                          {Kind: SyntaxError, Pointer: "", Offset: 0, Message: "Unexpected end of the document"},
+	} {
+		_, err := Parse([]byte(document))
+
+		assert.Equal(t, &expected, err, document)
+	}
+}
+
+func TestParseShouldKeepMembersInOrder(t *testing.T) {
+	v, err := Parse([]byte(` {"b": [true, null, -1.5e3], "a": "é"} `))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Object, v.Kind)
+	assert.Equal(t, int64(1), v.Offset)
+	assert.Equal(t, "b", v.Members[0].Name)
+	assert.Equal(t, []Kind{Bool, Null, Number}, []Kind{v.Members[0].Value.Items[0].Kind, v.Members[0].Value.Items[1].Kind, v.Members[0].Value.Items[2].Kind})
+	assert.Equal(t, "-1.5e3", v.Members[0].Value.Items[2].Literal)
+	assert.Equal(t, "é", v.Member("a").Literal)
+}
+
+type party struct {
+	Name    string `json:"name"`
+	Account uint   `json:"account"`
+}
+
+type embedded struct {
+	Reference string `json:"reference"`
+}
+
+type payment struct {
+	embedded
+	ID      uuid.UUID `json:"id"`
+	Parties []party   `json:"parties"`
+	Meta    *struct {
+		Version *uint `json:"version"`
+	} `json:"meta"`
+	Ignored string `json:"-"`
+}
+
+func TestCheckShouldRejectUnknownMembersAndWrongTypes(t *testing.T) {
+	for document, expected := range map[string]*Error{
+		`{"reference":"r","id":"x","parties":[{"name":"a","account":1}],"meta":{"version":2}}`: nil,
+		`{"reference":null,"meta":null}`:        {},
+		`{"parties":[{"name":"a","acount":1}]}`: {Kind: UnknownMember, Pointer: "/parties/0/acount", Offset: 24, Message: `"acount" is not a known member`},
+		`{"Ignored":"x"}`:                       {Kind: UnknownMember, Pointer: "/Ignored", Offset: 1, Message: `"Ignored" is not a known member`},
+		`{"id":1}`:                              {Kind: TypeMismatch, Pointer: "/id", Offset: 6, Message: "Expected a string but found a number"},
+		`{"parties":{}}`:                        {Kind: TypeMismatch, Pointer: "/parties", Offset: 11, Message: "Expected an array but found an object"},
+		`{"parties":[{"account":-1}]}`:          {Kind: TypeMismatch, Pointer: "/parties/0/account", Offset: 23, Message: "Expected a non-negative integer but found a number"},
+		`{"meta":{"version":"1"}}`:              {Kind: TypeMismatch, Pointer: "/meta/version", Offset: 19, Message: "Expected a number but found a string"},
+	} {
+		v, err := Parse([]byte(document))
+		assert.NoError(t, err, document)
+
+		err = Check(v, reflect.TypeOf(payment{}), "")
+
+		if expected == nil || *expected == (Error{}) {
+			assert.NoError(t, err, document)
+			continue
+		}
+		assert.Equal(t, expected, err, document)
+	}
+}
@@ -0,0 +1,308 @@
+package swift
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/model"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MT103 is a single customer credit transfer exchanged between the sender and receiver institutions
+type MT103 struct {
+	// Sender and Receiver are the BICs used in the basic and application header blocks
+	Sender   string
+	Receiver string
+	Payment  model.Payment
+}
+
+const lineBreak = "\r\n"
+
+var (
+	// SWIFT "x" character set
+	xCharset   = regexp.MustCompile(`^[A-Za-z0-9/\-?:().,'+ ]*$`)
+	bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	blockRegex = regexp.MustCompile(`(?s)\{1:F01([A-Z0-9]{12})[0-9]{10}\}\{2:I103([A-Z0-9]{12})[NUS]?[0-9]{0,3}\}(?:\{3:.*?\})?\{4:\r?\n(.*?)\r?\n-\}`)
+	fieldRegex = regexp.MustCompile(`(?m)^:([0-9]{2}[A-Z]?):`)
+	amountRe   = regexp.MustCompile(`^([A-Z]{3})([0-9]{1,12},[0-9]{0,5})$`)
+)
+
+var bearerCodes = map[string]string{
+	"SHAR": "SHA",
+	"DEBT": "OUR",
+	"CRED": "BEN",
+}
+
+// Render formats the payment as an MT103 message with basic, application and text blocks
+func (m MT103) Render() (string, error) {
+	sender, err := logicalTerminal(m.Sender)
+	if err != nil {
+		return "", err
+	}
+	receiver, err := logicalTerminal(m.Receiver)
+	if err != nil {
+		return "", err
+	}
+
+	a := m.Payment.Attributes
+	w := &textBlock{}
+
+	w.field("20", 16, 1, a.EndToEndReference)
+	w.field("23B", 4, 1, "CRED")
+
+	valueDate, err := time.Parse("2006-01-02", a.ProcessingDate)
+	if err != nil {
+		return "", fmt.Errorf("processing_date %q is not a valid date", a.ProcessingDate)
+	}
+	w.field("32A", 24, 1, valueDate.Format("060102")+currencyAmount(a.Currency, a.Amount))
+
+	if a.Fx.OriginalCurrency != "" {
+		w.field("33B", 18, 1, currencyAmount(a.Fx.OriginalCurrency, a.Fx.OriginalAmount))
+	}
+	if a.Fx.ExchangeRate != "" {
+		w.field("36", 12, 1, toSwiftDecimal(a.Fx.ExchangeRate))
+	}
+
+	w.field("50K", 35, 5, party(a.DebtorParty.AccountNumber, a.DebtorParty.Name, a.DebtorParty.Address)...)
+	w.field("59", 35, 5, party(a.BeneficiaryParty.AccountNumber, a.BeneficiaryParty.Name, a.BeneficiaryParty.Address)...)
+
+	if a.Reference != "" {
+		w.field("70", 35, 4, wrap(a.Reference, 35)...)
+	}
+
+	charges := a.ChargesInformation
+	bearer, ok := bearerCodes[charges.BearerCode]
+	if !ok {
+		return "", fmt.Errorf("bearer_code %q has no MT103 equivalent", charges.BearerCode)
+	}
+	w.field("71A", 3, 1, bearer)
+	for _, charge := range charges.SenderCharges {
+		w.field("71F", 18, 1, currencyAmount(charge.Currency, charge.Amount))
+	}
+	if charges.ReceiverChargesAmount != "" {
+		w.field("71G", 18, 1, currencyAmount(charges.ReceiverChargesCurrency, charges.ReceiverChargesAmount))
+	}
+
+	if w.err != nil {
+		return "", w.err
+	}
+
+	return fmt.Sprintf("{1:F01%s0000000000}{2:I103%sN}{4:%s%s-}", sender, receiver, lineBreak, w.String()), nil
+}
+
+// ParseMT103 reads an MT103 message back into a payment. Fields that MT103 cannot carry, such as
+// the payment and organisation IDs, are left empty.
+func ParseMT103(message string) (MT103, error) {
+	blocks := blockRegex.FindStringSubmatch(message)
+	if blocks == nil {
+		return MT103{}, fmt.Errorf("message is not an MT103 with basic, application and text blocks")
+	}
+
+	m := MT103{
+		Sender:   bic(blocks[1]),
+		Receiver: bic(blocks[2]),
+		Payment:  model.Payment{Type: "Payment"},
+	}
+	a := &m.Payment.Attributes
+
+	seen := map[string]bool{}
+	for _, f := range splitFields(blocks[3]) {
+		seen[f.tag] = true
+		for _, line := range f.lines {
+			if !xCharset.MatchString(line) {
+				return MT103{}, fmt.Errorf("field %s contains characters outside the SWIFT x character set", f.tag)
+			}
+		}
+
+		value := strings.Join(f.lines, "\n")
+		switch f.tag {
+		case "20":
+			a.EndToEndReference = value
+		case "23B":
+			if value != "CRED" {
+				return MT103{}, fmt.Errorf("unsupported bank operation code %q", value)
+			}
+		case "32A":
+			if len(value) < 6 {
+				return MT103{}, fmt.Errorf("field 32A is too short")
+			}
+			date, err := time.Parse("060102", value[:6])
+			if err != nil {
+				return MT103{}, fmt.Errorf("field 32A has invalid value date %q", value[:6])
+			}
+			a.ProcessingDate = date.Format("2006-01-02")
+			if a.Currency, a.Amount, err = parseCurrencyAmount(f.tag, value[6:]); err != nil {
+				return MT103{}, err
+			}
+		case "33B":
+			var err error
+			if a.Fx.OriginalCurrency, a.Fx.OriginalAmount, err = parseCurrencyAmount(f.tag, value); err != nil {
+				return MT103{}, err
+			}
+		case "36":
+			a.Fx.ExchangeRate = fromSwiftDecimal(value)
+		case "50K":
+			a.DebtorParty.AccountNumber, a.DebtorParty.Name, a.DebtorParty.Address = parseParty(f.lines)
+		case "59":
+			a.BeneficiaryParty.AccountNumber, a.BeneficiaryParty.Name, a.BeneficiaryParty.Address = parseParty(f.lines)
+		case "70":
+			a.Reference = strings.Join(f.lines, "")
+		case "71A":
+			for code, swiftCode := range bearerCodes {
+				if swiftCode == value {
+					a.ChargesInformation.BearerCode = code
+				}
+			}
+			if a.ChargesInformation.BearerCode == "" {
+				return MT103{}, fmt.Errorf("unsupported details of charges %q", value)
+			}
+		case "71F":
+			currency, amount, err := parseCurrencyAmount(f.tag, value)
+			if err != nil {
+				return MT103{}, err
+			}
+			a.ChargesInformation.SenderCharges = append(a.ChargesInformation.SenderCharges, model.Charge{Amount: amount, Currency: currency})
+		case "71G":
+			var err error
+			if a.ChargesInformation.ReceiverChargesCurrency, a.ChargesInformation.ReceiverChargesAmount, err = parseCurrencyAmount(f.tag, value); err != nil {
+				return MT103{}, err
+			}
+		}
+	}
+
+	for _, required := range []string{"20", "23B", "32A", "50K", "59", "71A"} {
+		if !seen[required] {
+			return MT103{}, fmt.Errorf("mandatory field %s is missing", required)
+		}
+	}
+
+	return m, nil
+}
+
+type textBlock struct {
+	strings.Builder
+	err error
+}
+
+// field writes a tag with up to maxLines lines of maxLength characters, recording the first violation
+func (w *textBlock) field(tag string, maxLength, maxLines int, lines ...string) {
+	if w.err != nil {
+		return
+	}
+	if len(lines) == 0 || lines[0] == "" {
+		w.err = fmt.Errorf("field %s is mandatory", tag)
+		return
+	}
+	if len(lines) > maxLines {
+		w.err = fmt.Errorf("field %s has %d lines, maximum is %d", tag, len(lines), maxLines)
+		return
+	}
+	for _, line := range lines {
+		if len(line) > maxLength {
+			w.err = fmt.Errorf("field %s line %q exceeds %d characters", tag, line, maxLength)
+			return
+		}
+		if !xCharset.MatchString(line) {
+			w.err = fmt.Errorf("field %s contains characters outside the SWIFT x character set", tag)
+			return
+		}
+	}
+	w.WriteString(":" + tag + ":" + strings.Join(lines, lineBreak) + lineBreak)
+}
+
+type field struct {
+	tag   string
+	lines []string
+}
+
+func splitFields(text string) []field {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	var fields []field
+	locations := fieldRegex.FindAllStringSubmatchIndex(text, -1)
+	for i, loc := range locations {
+		end := len(text)
+		if i+1 < len(locations) {
+			end = locations[i+1][0]
+		}
+		value := strings.TrimRight(text[loc[1]:end], "\n")
+		fields = append(fields, field{tag: text[loc[2]:loc[3]], lines: strings.Split(value, "\n")})
+	}
+	return fields
+}
+
+func logicalTerminal(code string) (string, error) {
+	if !bicPattern.MatchString(code) {
+		return "", fmt.Errorf("%q is not a valid BIC", code)
+	}
+	branch := "XXX"
+	if len(code) == 11 {
+		branch = code[8:]
+	}
+	return code[:8] + "X" + branch, nil
+}
+
+func bic(terminal string) string {
+	if terminal[9:] == "XXX" {
+		return terminal[:8]
+	}
+	return terminal[:8] + terminal[9:]
+}
+
+func currencyAmount(currency, amount string) string {
+	return currency + toSwiftDecimal(amount)
+}
+
+func parseCurrencyAmount(tag, value string) (currency string, amount string, err error) {
+	match := amountRe.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", fmt.Errorf("field %s has invalid currency and amount %q", tag, value)
+	}
+	return match[1], fromSwiftDecimal(match[2]), nil
+}
+
+// toSwiftDecimal uses the comma decimal separator SWIFT requires, which must always be present
+func toSwiftDecimal(amount string) string {
+	if !strings.Contains(amount, ".") {
+		return amount + ","
+	}
+	return strings.Replace(amount, ".", ",", 1)
+}
+
+func fromSwiftDecimal(amount string) string {
+	return strings.TrimSuffix(strings.Replace(amount, ",", ".", 1), ".")
+}
+
+func party(account, name, address string) []string {
+	lines := []string{"/" + account, name}
+	return append(lines, wrap(address, 35)...)
+}
+
+func parseParty(lines []string) (account, name, address string) {
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "/") {
+		account = strings.TrimPrefix(lines[0], "/")
+		lines = lines[1:]
+	}
+	if len(lines) > 0 {
+		name = lines[0]
+		address = strings.Join(lines[1:], "")
+	}
+	return
+}
+
+// wrap splits text into lines of at most width characters, breaking after spaces where possible.
+// The space stays at the end of the line so joining the lines gives back the original text.
+func wrap(text string, width int) []string {
+	var lines []string
+	for len(text) > width {
+		cut := strings.LastIndex(text[:width], " ") + 1
+		if cut == 0 {
+			cut = width
+		}
+		lines = append(lines, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		lines = append(lines, text)
+	}
+	return lines
+}
@@ -0,0 +1,97 @@
+package swift
+
+import (
+	"github.com/clD11/form3-payments/internal/fixture"
+	"github.com/clD11/form3-payments/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestMT103ShouldRoundTripSeedData(t *testing.T) {
+	for _, payment := range fixture.SeedPayments(t) {
+		message, err := MT103{Sender: "NWBKGB2L", Receiver: "BARCGB22", Payment: payment}.Render()
+		if err != nil {
+			t.Fatalf("Could not render payment %s - %s", payment.ID, err.Error())
+		}
+
+		parsed, err := ParseMT103(message)
+		if err != nil {
+			t.Fatalf("Could not parse message for payment %s - %s", payment.ID, err.Error())
+		}
+
+		assert.Equal(t, "NWBKGB2L", parsed.Sender)
+		assert.Equal(t, "BARCGB22", parsed.Receiver)
+		assert.Equal(t, carried(payment), parsed.Payment)
+	}
+}
+
+func TestMT103ShouldRenderFields(t *testing.T) {
+	payment := fixture.SeedPayments(t)[0]
+
+	message, err := MT103{Sender: "NWBKGB2L", Receiver: "BARCGB22XXX", Payment: payment}.Render()
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(message, "{1:F01NWBKGB2LXXXX0000000000}{2:I103BARCGB22XXXXN}{4:\r\n:20:Wil piano Jan\r\n"))
+	for _, field := range []string{":23B:CRED", ":32A:170118GBP100,21", ":33B:USD200,42", ":36:2,00000", ":71A:SHA", ":71F:GBP5,00", ":71F:USD10,00", ":71G:USD1,00"} {
+		assert.Contains(t, message, field+"\r\n")
+	}
+	assert.True(t, strings.HasSuffix(message, "\r\n-}"))
+}
+
+func TestMT103RenderShouldRejectCharactersOutsideCharset(t *testing.T) {
+	payment := fixture.SeedPayments(t)[0]
+	payment.Attributes.Reference = "Payment for piano lessons & more"
+
+	_, err := MT103{Sender: "NWBKGB2L", Receiver: "BARCGB22", Payment: payment}.Render()
+
+	assert.EqualError(t, err, "field 70 contains characters outside the SWIFT x character set")
+}
+
+func TestMT103RenderShouldRejectFieldsThatAreTooLong(t *testing.T) {
+	payment := fixture.SeedPayments(t)[0]
+	payment.Attributes.EndToEndReference = "End to end reference longer than sixteen"
+
+	_, err := MT103{Sender: "NWBKGB2L", Receiver: "BARCGB22", Payment: payment}.Render()
+
+	assert.EqualError(t, err, `field 20 line "End to end reference longer than sixteen" exceeds 16 characters`)
+}
+
+func TestParseMT103ShouldFailWhenMandatoryFieldMissing(t *testing.T) {
+	message := "{1:F01NWBKGB2LXXXX0000000000}{2:I103BARCGB22XXXXN}{4:\r\n:20:REF\r\n:23B:CRED\r\n-}"
+
+	_, err := ParseMT103(message)
+
+	assert.EqualError(t, err, "mandatory field 32A is missing")
+}
+
+// carried keeps only the parts of a payment an MT103 can represent
+func carried(p model.Payment) model.Payment {
+	a := p.Attributes
+	return model.Payment{
+		Type: "Payment",
+		Attributes: model.Attributes{
+			Amount: a.Amount,
+			BeneficiaryParty: model.BeneficiaryParty{
+				AccountNumber: a.BeneficiaryParty.AccountNumber,
+				Address:       a.BeneficiaryParty.Address,
+				Name:          a.BeneficiaryParty.Name,
+			},
+			ChargesInformation: a.ChargesInformation,
+			Currency:           a.Currency,
+			DebtorParty: model.DebtorParty{
+				AccountNumber: a.DebtorParty.AccountNumber,
+				Address:       a.DebtorParty.Address,
+				Name:          a.DebtorParty.Name,
+			},
+			EndToEndReference: a.EndToEndReference,
+			Fx: model.Fx{
+				ExchangeRate:     a.Fx.ExchangeRate,
+				OriginalAmount:   a.Fx.OriginalAmount,
+				OriginalCurrency: a.Fx.OriginalCurrency,
+			},
+			ProcessingDate: a.ProcessingDate,
+			Reference:      a.Reference,
+		},
+	}
+}
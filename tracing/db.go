@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"github.com/clD11/form3-payments/metrics"
+	"github.com/go-pg/pg"
+)
+
+// QueryHook records a client span for every go-pg query made with a context that is being traced,
+// handlers pass the request context with db.WithContext. Queries outside a trace, such as
+// migrations and seeding, are not recorded.
+type QueryHook struct{}
+
+type querySpanKey struct{}
+
+func (QueryHook) BeforeQuery(event *pg.QueryEvent) {
+	db, ok := event.DB.(interface{ Context() context.Context })
+	if !ok || db.Context() == nil || SpanFromContext(db.Context()) == nil {
+		return
+	}
+
+	operation := metrics.Operation(event)
+	_, span := Default.Start(db.Context(), operation, KindClient)
+	span.Start = event.StartTime
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.operation", operation)
+	// the unformatted query has placeholders in place of values so no payment data is recorded
+	if query, err := event.UnformattedQuery(); err == nil {
+		span.SetAttribute("db.statement", query)
+	}
+
+	if event.Data == nil {
+		event.Data = map[interface{}]interface{}{}
+	}
+	event.Data[querySpanKey{}] = span
+}
+
+func (QueryHook) AfterQuery(event *pg.QueryEvent) {
+	span, ok := event.Data[querySpanKey{}].(*Span)
+	if !ok {
+		return
+	}
+	if event.Error != nil && event.Error != pg.ErrNoRows {
+		span.SetError(event.Error)
+	}
+	if event.Result != nil {
+		span.SetAttribute("db.rows_affected", event.Result.RowsAffected())
+	}
+	span.Finish()
+}
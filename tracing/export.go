@@ -0,0 +1,252 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/clD11/form3-payments/logging"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriterExporter writes each span as a JSON line, it is meant for local debugging
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+func (e *WriterExporter) ExportSpan(span *Span) {
+	attributes := map[string]interface{}{}
+	for _, attribute := range span.Attributes() {
+		attributes[attribute.Key] = attribute.Value
+	}
+	line := struct {
+		TraceID    string                 `json:"trace_id"`
+		SpanID     string                 `json:"span_id"`
+		ParentID   string                 `json:"parent_span_id,omitempty"`
+		Name       string                 `json:"name"`
+		Start      time.Time              `json:"start"`
+		Duration   float64                `json:"duration_seconds"`
+		Attributes map[string]interface{} `json:"attributes,omitempty"`
+		Error      string                 `json:"error,omitempty"`
+	}{
+		TraceID:    span.TraceID.String(),
+		SpanID:     span.SpanID.String(),
+		Name:       span.Name,
+		Start:      span.Start.UTC(),
+		Duration:   span.End.Sub(span.Start).Seconds(),
+		Attributes: attributes,
+		Error:      span.ErrorMessage(),
+	}
+	if span.ParentID.IsValid() {
+		line.ParentID = span.ParentID.String()
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(append(data, '\n'))
+}
+
+const (
+	otlpQueueSize     = 2048
+	otlpBatchSize     = 512
+	otlpFlushInterval = 5 * time.Second
+	otlpSendTimeout   = 10 * time.Second
+)
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector over OTLP/HTTP with JSON
+// encoding. Spans are queued and sent by Run, they are dropped when the queue is full rather than
+// slowing requests down.
+type OTLPExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	queue       chan *Span
+}
+
+// NewOTLPExporter sends to the collector at endpoint, such as http://localhost:4318
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		url:         strings.TrimRight(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: otlpSendTimeout},
+		queue:       make(chan *Span, otlpQueueSize),
+	}
+}
+
+func (e *OTLPExporter) ExportSpan(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+func (e *OTLPExporter) Name() string { return "otlp-exporter" }
+
+// Run sends queued spans every few seconds or once a batch is full, and flushes what is left when
+// the context is cancelled
+func (e *OTLPExporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				e.send(context.Background(), batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(context.Background(), batch)
+			batch = nil
+		case <-ctx.Done():
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					e.send(context.Background(), batch)
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (e *OTLPExporter) send(ctx context.Context, batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		logging.Default.Warn("could not encode spans", "error", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		logging.Default.Warn("could not export spans", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		logging.Default.Warn("could not export spans", "spans", len(batch), "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logging.Default.Warn("collector rejected spans", "spans", len(batch), "status", resp.StatusCode)
+	}
+}
+
+// The types below are the subset of the OTLP JSON encoding of ExportTraceServiceRequest we send
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpStatus codes are 0 unset, 1 ok and 2 error
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const otlpStatusError = 2
+
+func (e *OTLPExporter) request(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, len(batch))
+	for i, span := range batch {
+		spans[i] = otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		if span.ParentID.IsValid() {
+			spans[i].ParentSpanID = span.ParentID.String()
+		}
+		for _, attribute := range span.Attributes() {
+			spans[i].Attributes = append(spans[i].Attributes, otlpAttribute(attribute.Key, attribute.Value))
+		}
+		if message := span.ErrorMessage(); message != "" {
+			spans[i].Status = otlpStatus{Code: otlpStatusError, Message: message}
+		}
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpAttribute("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/clD11/form3-payments/tracing"}, Spans: spans}},
+	}}}
+}
+
+// otlpAttribute wraps the value in its OTLP AnyValue member, 64 bit integers are strings in OTLP JSON
+func otlpAttribute(key string, value interface{}) otlpKeyValue {
+	var any map[string]interface{}
+	switch v := value.(type) {
+	case string:
+		any = map[string]interface{}{"stringValue": v}
+	case bool:
+		any = map[string]interface{}{"boolValue": v}
+	case int:
+		any = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		any = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		any = map[string]interface{}{"doubleValue": v}
+	default:
+		any = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return otlpKeyValue{Key: key, Value: any}
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"fmt"
+	"github.com/clD11/form3-payments/httpstatus"
+	"github.com/clD11/form3-payments/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// Middleware starts a server span for every request, continuing the caller's trace when it sends a
+// valid traceparent. The trace ID is added to the request's logger so logs and traces can be joined.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := r.Context()
+		if parent, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			ctx = ContextWithRemoteParent(ctx, parent)
+		}
+		ctx, span := Default.Start(ctx, r.Method+" "+route, KindServer)
+		defer span.Finish()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+
+		logger := logging.FromContext(ctx).With("trace_id", span.TraceID.String(), "span_id", span.SpanID.String())
+		ctx = logging.NewContext(ctx, logger)
+
+		recorder := httpstatus.NewRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", recorder.Status)
+		if recorder.Status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", recorder.Status, http.StatusText(recorder.Status)))
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies every span of one trace across services
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies one span within a trace
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanKind follows the OTLP numbering
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// SpanContext is the part of a span that is propagated to children and other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Span times one operation, methods are safe to call on a nil span so callers need not check
+// whether the request is traced
+type Span struct {
+	SpanContext
+	ParentID SpanID
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+	End      time.Time
+
+	tracer     *Tracer
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	keys       []string
+	err        string
+	ended      bool
+}
+
+// SetAttribute records a string, bool, integer or float value on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.attributes[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// Finish ends the span and hands it to the exporter if the trace is sampled
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = s.tracer.now()
+	s.mu.Unlock()
+
+	if s.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(s)
+	}
+}
+
+// Attribute is a recorded key value pair in the order it was first set
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attributes returns the recorded attributes in the order they were first set
+func (s *Span) Attributes() []Attribute {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attributes := make([]Attribute, len(s.keys))
+	for i, key := range s.keys {
+		attributes[i] = Attribute{Key: key, Value: s.attributes[key]}
+	}
+	return attributes
+}
+
+// ErrorMessage is the message passed to SetError, empty if the span succeeded
+func (s *Span) ErrorMessage() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Exporter receives every finished, sampled span
+type Exporter interface {
+	ExportSpan(*Span)
+}
+
+// Tracer creates spans and passes them to its exporter, without an exporter spans are still created
+// so trace IDs propagate and appear in the logs
+type Tracer struct {
+	exporter Exporter
+	now      func() time.Time
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter, now: time.Now}
+}
+
+// Default is used by the HTTP middleware and query hook
+var Default = NewTracer(nil)
+
+// Start begins a span that is a child of the span in the context, or of the remote parent, or the
+// root of a new trace
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      t.now(),
+		tracer:     t,
+		attributes: map[string]interface{}{},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+		span.Sampled = parent.Sampled
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		span.TraceID = remote.TraceID
+		span.ParentID = remote.SpanID
+		span.Sampled = remote.Sampled
+	} else {
+		rand.Read(span.TraceID[:])
+		span.Sampled = true
+	}
+	rand.Read(span.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// ContextWithSpan returns a context carrying the span as the parent of spans started from it
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the active span of the context, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a context whose next span continues a trace started by a caller
+func ContextWithRemoteParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, parent)
+}
@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) ExportSpan(span *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// useRecorder points the default tracer at a recorder until restore is called
+func useRecorder() (rec *recorder, restore func()) {
+	rec = &recorder{}
+	previous := Default
+	Default = NewTracer(rec)
+	return rec, func() { Default = previous }
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ParseTraceparent(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestStartShouldCreateChildOfSpanInContext(t *testing.T) {
+	rec, restore := useRecorder()
+	defer restore()
+
+	ctx, parent := Default.Start(context.Background(), "parent", KindServer)
+	_, child := Default.Start(ctx, "child", KindClient)
+	child.Finish()
+	parent.Finish()
+
+	assert.Equal(t, parent.TraceID, child.TraceID)
+	assert.Equal(t, parent.SpanID, child.ParentID)
+	assert.False(t, parent.ParentID.IsValid())
+	assert.Len(t, rec.spans, 2)
+}
+
+func TestMiddlewareShouldContinueTraceAndRecordRequest(t *testing.T) {
+	rec, restore := useRecorder()
+	defer restore()
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/v1/payments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SpanFromContext(r.Context()).SetAttribute("payment.id", mux.Vars(r)["id"])
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/payments/42", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Len(t, rec.spans, 1)
+	span := rec.spans[0]
+	assert.Equal(t, "PUT /v1/payments/{id}", span.Name)
+	assert.Equal(t, KindServer, span.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentID.String())
+	assert.Equal(t, []Attribute{
+		{Key: "http.method", Value: "PUT"},
+		{Key: "http.route", Value: "/v1/payments/{id}"},
+		{Key: "http.target", Value: "/v1/payments/42"},
+		{Key: "payment.id", Value: "42"},
+		{Key: "http.status_code", Value: 500},
+	}, span.Attributes())
+	assert.Equal(t, "500 Internal Server Error", span.ErrorMessage())
+}
+
+func TestMiddlewareShouldNotExportUnsampledTrace(t *testing.T) {
+	rec, restore := useRecorder()
+	defer restore()
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Empty(t, rec.spans)
+}
+
+func TestWriterExporterShouldWriteJSONLine(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewWriterExporter(&buf))
+	tracer.now = func() time.Time { return time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	_, span := tracer.Start(context.Background(), "SELECT", KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.Finish()
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "SELECT", line["name"])
+	assert.Equal(t, span.TraceID.String(), line["trace_id"])
+	assert.Equal(t, "2019-05-01T12:00:00Z", line["start"])
+	assert.Equal(t, map[string]interface{}{"db.system": "postgresql"}, line["attributes"])
+	assert.True(t, strings.HasSuffix(buf.String(), "}\n"))
+}
+
+func TestOTLPExporterShouldSendBatchOnShutdown(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL+"/", "payments")
+	tracer := NewTracer(exporter)
+	tracer.now = func() time.Time { return time.Unix(1556712000, 0) }
+	_, span := tracer.Start(context.Background(), "GET /v1/payments/{id}", KindServer)
+	span.SetAttribute("http.status_code", 404)
+	span.SetError(assert.AnError)
+	span.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, exporter.Run(ctx))
+
+	assert.JSONEq(t, `{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"payments"}}]},
+		"scopeSpans":[{"scope":{"name":"github.com/clD11/form3-payments/tracing"},"spans":[{
+			"traceId":"`+span.TraceID.String()+`","spanId":"`+span.SpanID.String()+`",
+			"name":"GET /v1/payments/{id}","kind":2,
+			"startTimeUnixNano":"1556712000000000000","endTimeUnixNano":"1556712000000000000",
+			"attributes":[{"key":"http.status_code","value":{"intValue":"404"}}],
+			"status":{"code":2,"message":"`+assert.AnError.Error()+`"}}]}]}]}`, string(<-received))
+}